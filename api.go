@@ -1,10 +1,14 @@
 package main
 
 import (
+	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/dimaskiddo/play-with-docker/audit"
 	"github.com/dimaskiddo/play-with-docker/config"
 	"github.com/dimaskiddo/play-with-docker/docker"
 	"github.com/dimaskiddo/play-with-docker/event"
@@ -17,12 +21,18 @@ import (
 	"github.com/dimaskiddo/play-with-docker/scheduler"
 	"github.com/dimaskiddo/play-with-docker/scheduler/task"
 	"github.com/dimaskiddo/play-with-docker/storage"
+	"github.com/dimaskiddo/play-with-docker/webhook"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "storage" {
+		storageCommand(os.Args[2:])
+		return
+	}
+
 	config.ParseFlags()
 
-	e := initEvent()
+	e, startEvent := initEvent()
 	s := initStorage()
 	df := initDockerFactory(s)
 	kf := initK8sFactory(s)
@@ -31,6 +41,12 @@ func main() {
 	sp := provisioner.NewOverlaySessionProvisioner(df)
 
 	core := pwd.NewPWD(df, e, s, sp, ipf)
+	a := initAudit(e, s)
+	w := initWebhooks(e, s)
+	h := event.NewHistory(e, config.EventHistorySize, config.EventHistoryRetention)
+	st := task.NewStatsHistory(e, config.InstanceStatsHistorySize)
+	core.SetUsageSummarizer(st)
+	core.StartExpirySweeper(config.ExpirySweepInterval)
 
 	tasks := []scheduler.Task{
 		task.NewCheckPorts(e, df),
@@ -41,24 +57,51 @@ func main() {
 		task.NewCheckK8sClusterExposedPorts(e, kf),
 	}
 
-	sch, err := scheduler.NewScheduler(tasks, s, e, core)
+	var lock scheduler.Lock
+	if config.SchedulerLeaseTTL > 0 {
+		hostname, _ := os.Hostname()
+		lock = scheduler.NewStorageLock(s, "scheduler", fmt.Sprintf("%s-%d", hostname, os.Getpid()))
+	}
+
+	sch, err := scheduler.NewScheduler(tasks, s, e, core, config.SchedulerWorkers, lock, config.SchedulerLeaseTTL)
 	if err != nil {
 		log.Fatal("Error initializing the scheduler: ", err)
 	}
 
 	sch.Start()
+	startEvent()
 
 	d, err := time.ParseDuration(config.SessionDuration)
 	if err != nil {
 		log.Fatalf("Cannot parse duration Got: %v", err)
 	}
 
+	var warnings []time.Duration
+	for _, v := range strings.Split(config.SessionExpiryWarnings, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+
+		warning, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Cannot parse session expiry warning %s. Got: %v", v, err)
+		}
+		warnings = append(warnings, warning)
+	}
+
 	playground := types.Playground{
 		Domain:                      config.PlaygroundDomain,
 		DefaultDinDInstanceImage:    config.DINDImage,
 		AvailableDinDInstanceImages: []string{config.DINDImage},
 		AllowWindowsInstances:       config.NoWindows,
 		DefaultSessionDuration:      d,
+		IdleTimeout:                 config.SessionIdleTimeout,
+		IdleGracePeriod:             config.SessionIdleGracePeriod,
+		MaxSessionLifetime:          config.SessionMaxLifetime,
+		MaxSessionExtensions:        config.SessionMaxExtensions,
+		ExpiryWarnings:              warnings,
+		HibernateOnIdle:             config.SessionHibernateOnIdle,
+		HibernationStopsExpiry:      config.SessionHibernationStopsExpiry,
 		Extras:                      map[string]interface{}{"LoginRedirect": "http://localhost:3000"},
 		Privileged:                  true,
 		Tasks:                       []string{".*"},
@@ -80,21 +123,96 @@ func main() {
 		log.Fatalf("Cannot create default playground. Got: %v", err)
 	}
 
-	handlers.Bootstrap(core, e)
+	handlers.Bootstrap(core, e, a, w, h, st, sch)
 	handlers.Register(nil)
 }
 
 func initStorage() storage.StorageApi {
-	s, err := storage.NewFileStorage(config.SessionsFile)
+	var s storage.StorageApi
+	var err error
+
+	switch config.SessionsStorage {
+	case "file":
+		s, err = storage.NewFileStorage(config.SessionsFile)
+	case "bolt":
+		s, err = storage.NewBoltStorage(config.SessionsBoltFile)
+	case "redis":
+		s, err = storage.NewRedisStorage(config.SessionsRedisURL, config.SessionsRedisPrefix)
+	default:
+		log.Fatalf("Unknown session storage backend %s", config.SessionsStorage)
+	}
+
 	if err != nil && !os.IsNotExist(err) {
 		log.Fatal("Error initializing StorageAPI: ", err)
 	}
 
+	keys, err := storage.ReadKeyring(config.SessionsKey, config.SessionsKeyFile)
+	if err != nil {
+		log.Fatal("Error reading session storage keys: ", err)
+	}
+
+	if keys != nil {
+		s = storage.NewEncryptedStorage(s, keys)
+	}
+
 	return s
 }
 
-func initEvent() event.EventApi {
-	return event.NewLocalBroker()
+func initAudit(e event.EventApi, s storage.StorageApi) audit.AuditApi {
+	if config.AuditFile == "" {
+		return nil
+	}
+
+	a, err := audit.NewFileLog(config.AuditFile)
+	if err != nil {
+		log.Fatal("Error initializing the audit log: ", err)
+	}
+
+	audit.Subscribe(a, e, s)
+
+	return a
+}
+
+func initWebhooks(e event.EventApi, s storage.StorageApi) *webhook.Dispatcher {
+	w := webhook.NewDispatcher(&http.Client{Timeout: config.WebhookTimeout}, config.WebhookMaxAttempts, config.WebhookBackoff)
+	webhook.Subscribe(w, e, s)
+
+	return w
+}
+
+// initEvent returns the event broker along with a function to call once the
+// handlers that must not miss any event are registered.
+func initEvent() (event.EventApi, func()) {
+	policy, err := event.ParseQueuePolicy(config.EventQueuePolicy)
+	if err != nil {
+		log.Fatalf("Unknown event queue policy %s", config.EventQueuePolicy)
+	}
+
+	opts := []event.Option{event.WithQueueSize(config.EventQueueSize), event.WithQueuePolicy(policy)}
+
+	switch config.EventBroker {
+	case "local":
+		return event.NewLocalBroker(opts...), func() {}
+	case "redis":
+		replica := config.EventReplicaId
+		if replica == "" {
+			replica, _ = os.Hostname()
+		}
+
+		b, err := event.NewRedisBroker(config.EventRedisURL, config.EventRedisPrefix, replica, opts...)
+		if err != nil {
+			log.Fatal("Error initializing the event broker: ", err)
+		}
+
+		return b, func() {
+			if err := b.Start(); err != nil {
+				log.Fatal("Error starting the event broker: ", err)
+			}
+		}
+	default:
+		log.Fatalf("Unknown event broker backend %s", config.EventBroker)
+		return nil, nil
+	}
 }
 
 func initDockerFactory(s storage.StorageApi) docker.FactoryApi {
@@ -0,0 +1,73 @@
+package audit
+
+import "time"
+
+type Action string
+
+const (
+	SESSION_NEW       = Action("session new")
+	SESSION_END       = Action("session end")
+	SESSION_CLOSE     = Action("session close")
+	SESSION_EXTEND    = Action("session extend")
+	SESSION_HIBERNATE = Action("session hibernate")
+	SESSION_RESUME    = Action("session resume")
+	INSTANCE_NEW      = Action("instance new")
+	INSTANCE_DELETE   = Action("instance delete")
+	INSTANCE_EXEC     = Action("instance exec")
+	INSTANCE_UPLOAD   = Action("instance upload")
+	PLAYGROUND_NEW    = Action("playground new")
+	PLAYGROUND_PUT    = Action("playground put")
+	USER_LOGIN        = Action("user login")
+	SCHEDULER_TASK    = Action("scheduler task")
+)
+
+// Actor who performed an action authenticated with the admin token.
+const ADMIN = "admin"
+
+// Entry is a single audited action. Actor is the user that performed it and
+// is empty for the actions of the server itself, such as closing expired
+// sessions. UserId is the owner of the session it happened in.
+type Entry struct {
+	Time         time.Time         `json:"time"`
+	Action       Action            `json:"action"`
+	Actor        string            `json:"actor,omitempty"`
+	IP           string            `json:"ip,omitempty"`
+	UserId       string            `json:"user_id,omitempty"`
+	PlaygroundId string            `json:"playground_id,omitempty"`
+	SessionId    string            `json:"session_id,omitempty"`
+	Instance     string            `json:"instance,omitempty"`
+	Details      map[string]string `json:"details,omitempty"`
+}
+
+// Query selects entries. Empty fields match every entry, UserId matches both
+// the actor and the session owner, and the time range includes From and
+// excludes To.
+type Query struct {
+	SessionId string
+	UserId    string
+	From      time.Time
+	To        time.Time
+	Limit     int
+}
+
+func (q Query) Match(e *Entry) bool {
+	if q.SessionId != "" && e.SessionId != q.SessionId {
+		return false
+	}
+	if q.UserId != "" && e.UserId != q.UserId && e.Actor != q.UserId {
+		return false
+	}
+	if !q.From.IsZero() && e.Time.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !e.Time.Before(q.To) {
+		return false
+	}
+
+	return true
+}
+
+type AuditApi interface {
+	Record(e *Entry) error
+	Find(q Query) ([]*Entry, error)
+}
@@ -0,0 +1,60 @@
+package audit
+
+import (
+	"log"
+	"strconv"
+
+	"github.com/dimaskiddo/play-with-docker/event"
+	"github.com/dimaskiddo/play-with-docker/storage"
+)
+
+// Subscribe records the session, instance and playground lifecycle events
+// emitted on e. With a broker shared by several replicas, each event is
+// recorded by one of them only.
+func Subscribe(a AuditApi, e event.EventApi, s storage.StorageApi) {
+	record := func(entry *Entry) {
+		if err := a.Record(entry); err != nil {
+			log.Printf("Error recording audit entry %s. Got: %v\n", entry.Action, err)
+		}
+	}
+
+	event.SessionNewEvent.On(e, func(id string, _ event.Empty) {
+		entry := &Entry{Action: SESSION_NEW, SessionId: id}
+
+		if session, err := s.SessionGet(id); err == nil {
+			entry.Actor = session.UserId
+			entry.UserId = session.UserId
+			entry.PlaygroundId = session.PlaygroundId
+		}
+
+		record(entry)
+	}, event.Once())
+
+	// The usage is kept here, as the session is deleted when it ends.
+	event.SessionEndEvent.On(e, func(id string, payload event.SessionEnd) {
+		entry := &Entry{Action: SESSION_END, SessionId: id, UserId: payload.UserId, PlaygroundId: payload.PlaygroundId}
+
+		if usage := payload.Usage; usage != nil {
+			entry.Details = map[string]string{
+				"peak_cpu_sum": strconv.FormatFloat(usage.PeakCpuSum, 'f', 2, 64),
+				"peak_mem_sum": strconv.FormatUint(usage.PeakMemSum, 10),
+				"net_rx":       strconv.FormatUint(usage.NetRx, 10),
+				"net_tx":       strconv.FormatUint(usage.NetTx, 10),
+			}
+		}
+
+		record(entry)
+	}, event.Once())
+
+	event.InstanceNewEvent.On(e, func(id string, payload event.InstanceNew) {
+		record(&Entry{Action: INSTANCE_NEW, SessionId: id, Instance: payload.Name})
+	}, event.Once())
+
+	event.InstanceDeleteEvent.On(e, func(id string, payload event.InstanceDelete) {
+		record(&Entry{Action: INSTANCE_DELETE, SessionId: id, Instance: payload.Name})
+	}, event.Once())
+
+	event.PlaygroundNewEvent.On(e, func(id string, _ event.Empty) {
+		record(&Entry{Action: PLAYGROUND_NEW, PlaygroundId: id})
+	}, event.Once())
+}
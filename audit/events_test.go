@@ -0,0 +1,62 @@
+package audit
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dimaskiddo/play-with-docker/event"
+	"github.com/dimaskiddo/play-with-docker/pwd/types"
+	"github.com/dimaskiddo/play-with-docker/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscribe(t *testing.T) {
+	l, err := NewFileLog(filepath.Join(t.TempDir(), "audit"))
+	assert.Nil(t, err)
+
+	_s := &storage.Mock{}
+	_s.On("SessionGet", "s1").Return(&types.Session{Id: "s1", UserId: "u1", PlaygroundId: "p1"}, nil)
+
+	e := event.NewLocalBroker()
+	Subscribe(l, e, _s)
+
+	// Handlers run concurrently, so the session has to be recorded before the
+	// events that are attributed to its owner.
+	e.Emit(event.SESSION_NEW, "s1")
+	assert.Eventually(t, func() bool {
+		entries, err := l.Find(Query{SessionId: "s1"})
+		return err == nil && len(entries) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	e.Emit(event.INSTANCE_NEW, "s1", "i1", "10.0.0.1", "node1", "proxy")
+	e.Emit(event.INSTANCE_DELETE, "s1", "i1")
+	event.SessionEndEvent.Emit(e, "s1", event.SessionEnd{PlaygroundId: "p1", UserId: "u1", Usage: &types.SessionUsage{PeakCpuSum: 1.5, PeakMemSum: 300, NetRx: 20, NetTx: 10}})
+
+	var entries []*Entry
+	assert.Eventually(t, func() bool {
+		entries, err = l.Find(Query{UserId: "u1"})
+		return err == nil && len(entries) == 4
+	}, time.Second, 10*time.Millisecond)
+	assert.Len(t, entries, 4)
+
+	actions := map[Action]*Entry{}
+	for _, entry := range entries {
+		actions[entry.Action] = entry
+	}
+
+	assert.Equal(t, "u1", actions[SESSION_NEW].Actor)
+	assert.Equal(t, "i1", actions[INSTANCE_NEW].Instance)
+	assert.Equal(t, "i1", actions[INSTANCE_DELETE].Instance)
+	assert.Equal(t, "", actions[SESSION_END].Actor)
+	assert.Equal(t, "p1", actions[SESSION_END].PlaygroundId)
+
+	// The usage outlives the session in the log.
+	entries, err = l.Find(Query{SessionId: "s1"})
+	assert.Nil(t, err)
+	for _, entry := range entries {
+		if entry.Action == SESSION_END {
+			assert.Equal(t, map[string]string{"peak_cpu_sum": "1.50", "peak_mem_sum": "300", "net_rx": "20", "net_tx": "10"}, entry.Details)
+		}
+	}
+}
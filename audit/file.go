@@ -0,0 +1,161 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+type session struct {
+	userId       string
+	playgroundId string
+}
+
+// fileLog appends entries as JSON lines to a file that is never rewritten.
+type fileLog struct {
+	mx       sync.Mutex
+	path     string
+	file     *os.File
+	sessions map[string]session
+}
+
+func NewFileLog(path string) (AuditApi, error) {
+	l := &fileLog{path: path, sessions: map[string]session{}}
+
+	size, err := l.scan(func(e *Entry) bool {
+		l.remember(e)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	l.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	// Drop a last entry cut short by a crash, new ones would be appended to it.
+	err = l.file.Truncate(size)
+	if err != nil {
+		l.file.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// remember keeps who owns each session, so the entries of actions that were
+// not triggered by its owner are still found when querying by user.
+func (l *fileLog) remember(e *Entry) {
+	if e.SessionId == "" {
+		return
+	}
+
+	s := l.sessions[e.SessionId]
+	if s.userId == "" {
+		s.userId = e.UserId
+	}
+	if s.playgroundId == "" {
+		s.playgroundId = e.PlaygroundId
+	}
+
+	l.sessions[e.SessionId] = s
+}
+
+func (l *fileLog) Record(e *Entry) error {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	if s, found := l.sessions[e.SessionId]; found {
+		if e.UserId == "" {
+			e.UserId = s.userId
+		}
+		if e.PlaygroundId == "" {
+			e.PlaygroundId = s.playgroundId
+		}
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = l.file.Write(append(b, '\n'))
+	if err != nil {
+		return err
+	}
+
+	l.remember(e)
+
+	return l.file.Sync()
+}
+
+// Find reads the log through its own file, without holding up Record, and
+// returns the newest q.Limit matching entries, oldest first. Entries still
+// being written are left out.
+func (l *fileLog) Find(q Query) ([]*Entry, error) {
+	entries := []*Entry{}
+
+	_, err := l.scan(func(e *Entry) bool {
+		if q.Match(e) {
+			if q.Limit > 0 && len(entries) == q.Limit {
+				entries = append(entries[1:], e)
+			} else {
+				entries = append(entries, e)
+			}
+		}
+
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// scan calls fn with every complete entry in order until it returns false and
+// returns the size of the entries read.
+func (l *fileLog) scan(fn func(e *Entry) bool) (int64, error) {
+	f, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+
+	size := int64(0)
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			return size, nil
+		}
+		if err != nil {
+			return size, err
+		}
+
+		var e *Entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return size, fmt.Errorf("audit log %s: line %d: %v", l.path, n, err)
+		}
+
+		size += int64(len(line))
+
+		if !fn(e) {
+			return size, nil
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit")
+
+	l, err := NewFileLog(path)
+	assert.Nil(t, err)
+
+	start := time.Now()
+
+	assert.Nil(t, l.Record(&Entry{Time: start, Action: SESSION_NEW, Actor: "u1", UserId: "u1", PlaygroundId: "p1", SessionId: "s1"}))
+	assert.Nil(t, l.Record(&Entry{Time: start.Add(time.Minute), Action: INSTANCE_EXEC, Actor: "u2", IP: "10.0.0.1", SessionId: "s1", Instance: "i1"}))
+	assert.Nil(t, l.Record(&Entry{Time: start.Add(2 * time.Minute), Action: SESSION_END, SessionId: "s1"}))
+	assert.Nil(t, l.Record(&Entry{Time: start.Add(3 * time.Minute), Action: SESSION_NEW, Actor: "u2", UserId: "u2", SessionId: "s2"}))
+
+	// Reopening keeps the session owners for the entries recorded later.
+	l, err = NewFileLog(path)
+	assert.Nil(t, err)
+	assert.Nil(t, l.Record(&Entry{Time: start.Add(4 * time.Minute), Action: SESSION_CLOSE, Actor: "u3", SessionId: "s1"}))
+
+	entries, err := l.Find(Query{SessionId: "s1"})
+	assert.Nil(t, err)
+	assert.Len(t, entries, 4)
+	for _, e := range entries {
+		assert.Equal(t, "u1", e.UserId)
+		assert.Equal(t, "p1", e.PlaygroundId)
+	}
+
+	entries, err = l.Find(Query{UserId: "u2"})
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, INSTANCE_EXEC, entries[0].Action)
+	assert.Equal(t, "10.0.0.1", entries[0].IP)
+	assert.Equal(t, "s2", entries[1].SessionId)
+
+	entries, err = l.Find(Query{From: start.Add(time.Minute), To: start.Add(3 * time.Minute)})
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+
+	// The newest entries are kept.
+	entries, err = l.Find(Query{Limit: 2})
+	assert.Nil(t, err)
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, "s2", entries[0].SessionId)
+		assert.Equal(t, SESSION_CLOSE, entries[1].Action)
+	}
+}
+
+func TestFileLogTornEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit")
+
+	l, err := NewFileLog(path)
+	assert.Nil(t, err)
+	assert.Nil(t, l.Record(&Entry{Action: SESSION_NEW, SessionId: "s1"}))
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	assert.Nil(t, err)
+	_, err = f.WriteString(`{"action":"sess`)
+	assert.Nil(t, err)
+	f.Close()
+
+	l, err = NewFileLog(path)
+	assert.Nil(t, err)
+	assert.Nil(t, l.Record(&Entry{Action: SESSION_END, SessionId: "s1"}))
+
+	entries, err := l.Find(Query{})
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+}
@@ -0,0 +1,17 @@
+package audit
+
+import "github.com/stretchr/testify/mock"
+
+type Mock struct {
+	mock.Mock
+}
+
+func (m *Mock) Record(e *Entry) error {
+	args := m.Called(e)
+	return args.Error(0)
+}
+
+func (m *Mock) Find(q Query) ([]*Entry, error) {
+	args := m.Called(q)
+	return args.Get(0).([]*Entry), args.Error(1)
+}
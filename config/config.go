@@ -3,6 +3,7 @@ package config
 import (
 	"flag"
 	"regexp"
+	"time"
 
 	"github.com/gorilla/securecookie"
 
@@ -27,7 +28,7 @@ var (
 
 var (
 	PortNumber, PlaygroundDomain, PWDContainerName, L2ContainerName, L2RouterIP, L2Subdomain, L2SSHPort,
-	SessionsFile, SessionDuration, HashKey, CookieHashKey, CookieBlockKey, SSHKeyPath,
+	SessionsFile, SessionsBoltFile, SessionsStorage, SessionsRedisURL, SessionsRedisPrefix, SessionsKey, SessionsKeyFile, SessionDuration, SessionExpiryWarnings, EventBroker, EventRedisURL, EventRedisPrefix, EventReplicaId, EventQueuePolicy, AuditFile, HashKey, CookieHashKey, CookieBlockKey, SSHKeyPath,
 	LetsEncryptCertsDir, DINDImage, DINDAppArmor, AdminToken, SegmentId string
 )
 
@@ -36,11 +37,19 @@ var (
 	// intended to be used in development. For example, it allows the caller to
 	// specify the Docker networks to join.
 	UseLetsEncrypt, ForceTLS, ExternalDindVolume, NoOOMKill, NoWindows, Unsafe bool
+	SessionHibernateOnIdle, SessionHibernationStopsExpiry                      bool
 	ExternalDindVolumeSize, ExternalDataDir                                    string
 	DefaultLimitCPU, DefaultMaxLimitCPU, MaxLoadAvg                            float64
 	DefaultLimitMemory, DefaultMaxLimitMemory                                  int64
 	DefaultMaxLimitProcess                                                     int64
 	RateLimitRPS, RateLimitBurst                                               int
+	WebhookMaxAttempts, EventHistorySize, EventQueueSize, SchedulerWorkers     int
+	InstanceStatsHistorySize                                                   int
+	LoginRequestTTL, ClientTTL, ExpirySweepInterval                            time.Duration
+	SessionIdleTimeout, SessionIdleGracePeriod, SessionMaxLifetime             time.Duration
+	SessionMaxExtensions                                                       int
+	WebhookBackoff, WebhookTimeout, SchedulerLeaseTTL                          time.Duration
+	EventHistoryRetention                                                      time.Duration
 	SecureCookie                                                               *securecookie.SecureCookie
 	RateLimiter                                                                *rate.Limiter
 )
@@ -83,7 +92,43 @@ func ParseFlags() {
 	flag.StringVar(&L2SSHPort, "l2-ssh-port", GetEnvString("PWD_L2_SSH_PORT", "2222"), "L2 Router Custom SSH Port")
 
 	flag.StringVar(&SessionsFile, "session-file", GetAbsoultePath(GetEnvString("PWD_SESSION_FILE", "./sessions/session")), "Path Where Session File will be Stored")
+	flag.StringVar(&SessionsBoltFile, "session-bolt-file", GetAbsoultePath(GetEnvString("PWD_SESSION_BOLT_FILE", "./sessions/session.db")), "Path Where the Bolt Session Storage Database will be Stored")
+	flag.StringVar(&SessionsStorage, "session-storage", GetEnvString("PWD_SESSION_STORAGE", "file"), "Session Storage Backend (file, bolt or redis)")
+	flag.StringVar(&SessionsRedisURL, "session-redis-url", GetEnvString("PWD_SESSION_REDIS_URL", "redis://localhost:6379/0"), "URL of the Redis Server Used by the Redis Session Storage")
+	flag.StringVar(&SessionsRedisPrefix, "session-redis-prefix", GetEnvString("PWD_SESSION_REDIS_PREFIX", "pwd:"), "Prefix of the Keys Used by the Redis Session Storage")
+	flag.StringVar(&SessionsKey, "session-key", GetEnvString("PWD_SESSION_KEY", ""), "Base64 Encoded 32 Bytes Key to Encrypt Secrets in the Session Storage")
+	flag.StringVar(&SessionsKeyFile, "session-key-file", GetEnvString("PWD_SESSION_KEY_FILE", ""), "Path of a File with One Base64 Encoded Session Storage Key Per Line, the First One Encrypts")
 	flag.StringVar(&SessionDuration, "max-session-duration", GetEnvString("PWD_MAX_SESSION_DURATION", "4h"), "Maximum Session Duration Per-User")
+	flag.DurationVar(&SessionIdleTimeout, "session-idle-timeout", GetEnvDuration("PWD_SESSION_IDLE_TIMEOUT", 0), "Time Without Clients After Which a Session is Closed, 0 to Keep It Until It Expires")
+	flag.DurationVar(&SessionIdleGracePeriod, "session-idle-grace-period", GetEnvDuration("PWD_SESSION_IDLE_GRACE_PERIOD", 5*time.Minute), "Time Between the Idle Warning and the Closing of a Session")
+	flag.DurationVar(&SessionMaxLifetime, "session-max-lifetime", GetEnvDuration("PWD_SESSION_MAX_LIFETIME", 8*time.Hour), "Maximum Time a Session can be Extended to Since It was Created")
+	flag.IntVar(&SessionMaxExtensions, "session-max-extensions", GetEnvInt("PWD_SESSION_MAX_EXTENSIONS", 2), "Maximum Number of Extensions Per-Session, 0 to Disable Extensions")
+	flag.StringVar(&SessionExpiryWarnings, "session-expiry-warnings", GetEnvString("PWD_SESSION_EXPIRY_WARNINGS", "15m,5m"), "Comma Separated Times Before the Expiry of a Session When It is Warned")
+	flag.BoolVar(&SessionHibernateOnIdle, "session-hibernate-on-idle", GetEnvBool("PWD_SESSION_HIBERNATE_ON_IDLE", false), "Hibernate Idle Sessions by Pausing Their Instances Instead of Closing Them")
+	flag.BoolVar(&SessionHibernationStopsExpiry, "session-hibernation-stops-expiry", GetEnvBool("PWD_SESSION_HIBERNATION_STOPS_EXPIRY", false), "Do Not Count the Time a Session is Hibernated Against Its Duration")
+
+	flag.StringVar(&EventBroker, "event-broker", GetEnvString("PWD_EVENT_BROKER", "local"), "Event Broker Backend (local or redis)")
+	flag.StringVar(&EventRedisURL, "event-redis-url", GetEnvString("PWD_EVENT_REDIS_URL", "redis://localhost:6379/0"), "URL of the Redis Server Used by the Redis Event Broker")
+	flag.StringVar(&EventRedisPrefix, "event-redis-prefix", GetEnvString("PWD_EVENT_REDIS_PREFIX", "pwd:"), "Prefix of the Keys Used by the Redis Event Broker")
+	flag.StringVar(&EventReplicaId, "event-replica-id", GetEnvString("PWD_EVENT_REPLICA_ID", ""), "Name of This Replica in the Redis Event Broker, Defaults to the Hostname")
+	flag.IntVar(&EventQueueSize, "event-queue-size", GetEnvInt("PWD_EVENT_QUEUE_SIZE", 1000), "Number of Events Queued Per-Handler")
+	flag.StringVar(&EventQueuePolicy, "event-queue-policy", GetEnvString("PWD_EVENT_QUEUE_POLICY", "block"), "What to Do When the Queue of a Handler is Full (block or drop), Browser Connections Always Drop and Reconnect")
+	flag.IntVar(&EventHistorySize, "event-history-size", GetEnvInt("PWD_EVENT_HISTORY_SIZE", 100), "Number of Events Kept Per-Session to Resume Event Streams")
+	flag.DurationVar(&EventHistoryRetention, "event-history-retention", GetEnvDuration("PWD_EVENT_HISTORY_RETENTION", 2*time.Minute), "Time the Events of a Session are Kept After It Ends")
+	flag.IntVar(&InstanceStatsHistorySize, "instance-stats-history-size", GetEnvInt("PWD_INSTANCE_STATS_HISTORY_SIZE", 360), "Number of Stats Samples Kept Per-Instance")
+
+	flag.IntVar(&SchedulerWorkers, "scheduler-workers", GetEnvInt("PWD_SCHEDULER_WORKERS", 20), "Maximum Number of Scheduler Tasks Running at the Same Time")
+	flag.DurationVar(&SchedulerLeaseTTL, "scheduler-lease-ttl", GetEnvDuration("PWD_SCHEDULER_LEASE_TTL", 15*time.Second), "Time a Replica Leads the Scheduler Without Renewing Its Lease, 0 to Always Run the Scheduler")
+
+	flag.StringVar(&AuditFile, "audit-file", GetEnvString("PWD_AUDIT_FILE", "./sessions/audit"), "Path Where the Audit Log will be Stored, Empty to Disable It")
+
+	flag.IntVar(&WebhookMaxAttempts, "webhook-max-attempts", GetEnvInt("PWD_WEBHOOK_MAX_ATTEMPTS", 5), "Maximum Number of Attempts to Deliver a Webhook")
+	flag.DurationVar(&WebhookBackoff, "webhook-backoff", GetEnvDuration("PWD_WEBHOOK_BACKOFF", time.Second), "Time Before the First Webhook Retry, Doubled on Each Retry")
+	flag.DurationVar(&WebhookTimeout, "webhook-timeout", GetEnvDuration("PWD_WEBHOOK_TIMEOUT", 10*time.Second), "Timeout of Each Webhook Delivery Attempt")
+
+	flag.DurationVar(&LoginRequestTTL, "login-request-ttl", GetEnvDuration("PWD_LOGIN_REQUEST_TTL", 15*time.Minute), "Time an Unfinished OAuth Login Request is Kept, Forever if 0")
+	flag.DurationVar(&ClientTTL, "client-ttl", GetEnvDuration("PWD_CLIENT_TTL", 2*time.Minute), "Time a Client is Kept Without a Live WebSocket, Forever if 0")
+	flag.DurationVar(&ExpirySweepInterval, "expiry-sweep-interval", GetEnvDuration("PWD_EXPIRY_SWEEP_INTERVAL", time.Minute), "Interval to Purge Expired Login Requests and Clients, Never if 0")
 
 	flag.StringVar(&DINDImage, "dind-image-name", GetEnvString("PWD_DIND_IMAGE_NAME", "franela/dind:latest"), "Docker-in-Docker (DIND) Image Name")
 	flag.StringVar(&DINDAppArmor, "dind-apparmor-profile", GetEnvString("PWD_DIND_APPARMOR_PROFILE", ""), "Docker-in-Docker (DIND) AppArmor Profile Name")
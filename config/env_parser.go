@@ -5,6 +5,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	_ "github.com/joho/godotenv/autoload"
 )
@@ -114,3 +115,17 @@ func GetEnvFloat64(envName string, envDefault float64) float64 {
 
 	return float64(retValue)
 }
+
+func GetEnvDuration(envName string, envDefault time.Duration) time.Duration {
+	envValue, err := SanitizeEnv(envName)
+	if err != nil {
+		return envDefault
+	}
+
+	retValue, err := time.ParseDuration(envValue)
+	if err != nil {
+		return envDefault
+	}
+
+	return retValue
+}
@@ -40,13 +40,16 @@ type DockerApi interface {
 	DaemonInfo() (types.Info, error)
 	DaemonHost() string
 
-	GetSwarmPorts() ([]string, []uint16, error)
-	GetPorts() ([]uint16, error)
+	GetSwarmPorts(ctx context.Context) ([]string, []uint16, error)
+	GetPorts(ctx context.Context) ([]uint16, error)
 
-	ContainerStats(name string) (io.ReadCloser, error)
+	ContainerStats(ctx context.Context, name string) (io.ReadCloser, error)
+	ContainerCPUs(ctx context.Context, name string) (float64, error)
 	ContainerResize(name string, rows, cols uint) error
 	ContainerRename(old, new string) error
 	ContainerDelete(name string) error
+	ContainerPause(name string) error
+	ContainerUnpause(name string) error
 	ContainerCreate(opts CreateContainerOpts) error
 	ContainerIPs(id string) (map[string]string, error)
 	ExecAttach(instanceName string, command []string, out io.Writer) (int, error)
@@ -145,12 +148,12 @@ func (d *docker) DaemonHost() string {
 	return d.c.DaemonHost()
 }
 
-func (d *docker) GetSwarmPorts() ([]string, []uint16, error) {
+func (d *docker) GetSwarmPorts(ctx context.Context) ([]string, []uint16, error) {
 	hosts := []string{}
 	ports := []uint16{}
 
 	nodesIdx := map[string]string{}
-	nodes, nodesErr := d.c.NodeList(context.Background(), types.NodeListOptions{})
+	nodes, nodesErr := d.c.NodeList(ctx, types.NodeListOptions{})
 	if nodesErr != nil {
 		return nil, nil, nodesErr
 	}
@@ -160,7 +163,7 @@ func (d *docker) GetSwarmPorts() ([]string, []uint16, error) {
 		hosts = append(hosts, n.Description.Hostname)
 	}
 
-	services, err := d.c.ServiceList(context.Background(), types.ServiceListOptions{})
+	services, err := d.c.ServiceList(ctx, types.ServiceListOptions{})
 	if err != nil {
 		return nil, nil, err
 	}
@@ -174,9 +177,9 @@ func (d *docker) GetSwarmPorts() ([]string, []uint16, error) {
 	return hosts, ports, nil
 }
 
-func (d *docker) GetPorts() ([]uint16, error) {
+func (d *docker) GetPorts(ctx context.Context) ([]uint16, error) {
 	opts := types.ContainerListOptions{}
-	containers, err := d.c.ContainerList(context.Background(), opts)
+	containers, err := d.c.ContainerList(ctx, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -194,11 +197,23 @@ func (d *docker) GetPorts() ([]uint16, error) {
 	return openPorts, nil
 }
 
-func (d *docker) ContainerStats(name string) (io.ReadCloser, error) {
-	stats, err := d.c.ContainerStats(context.Background(), name, true)
+// ContainerStats streams the stats of the container until ctx is done or the
+// returned reader is closed.
+func (d *docker) ContainerStats(ctx context.Context, name string) (io.ReadCloser, error) {
+	stats, err := d.c.ContainerStats(ctx, name, true)
 	return stats.Body, err
 }
 
+// ContainerCPUs returns the CPUs the container is limited to, 0 if it is not.
+func (d *docker) ContainerCPUs(ctx context.Context, name string) (float64, error) {
+	container, err := d.c.ContainerInspect(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+
+	return float64(container.HostConfig.NanoCPUs) / 1e9, nil
+}
+
 func (d *docker) ContainerResize(name string, rows, cols uint) error {
 	return d.c.ContainerResize(context.Background(), name, types.ResizeOptions{Height: rows, Width: cols})
 }
@@ -266,6 +281,14 @@ func (d *docker) ContainerDelete(name string) error {
 	return err
 }
 
+func (d *docker) ContainerPause(name string) error {
+	return d.c.ContainerPause(context.Background(), name)
+}
+
+func (d *docker) ContainerUnpause(name string) error {
+	return d.c.ContainerUnpause(context.Background(), name)
+}
+
 type CreateContainerOpts struct {
 	Image          string
 	SessionId      string
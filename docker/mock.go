@@ -1,6 +1,7 @@
 package docker
 
 import (
+	"context"
 	"io"
 	"net"
 	"time"
@@ -24,8 +25,8 @@ func (m *Mock) NetworkCreate(id string, opts types.NetworkCreate) error {
 	return args.Error(0)
 }
 
-func (m *Mock) NetworkConnect(container, network, ip string) (string, error) {
-	args := m.Called(container, network, ip)
+func (m *Mock) NetworkConnect(container, network, ip string, aliases []string) (string, error) {
+	args := m.Called(container, network, ip, aliases)
 	return args.String(0), args.Error(1)
 }
 
@@ -44,21 +45,26 @@ func (m *Mock) DaemonHost() string {
 	return args.String(0)
 }
 
-func (m *Mock) GetSwarmPorts() ([]string, []uint16, error) {
+func (m *Mock) GetSwarmPorts(ctx context.Context) ([]string, []uint16, error) {
 	args := m.Called()
 	return args.Get(0).([]string), args.Get(1).([]uint16), args.Error(2)
 }
 
-func (m *Mock) GetPorts() ([]uint16, error) {
+func (m *Mock) GetPorts(ctx context.Context) ([]uint16, error) {
 	args := m.Called()
 	return args.Get(0).([]uint16), args.Error(1)
 }
 
-func (m *Mock) ContainerStats(name string) (io.ReadCloser, error) {
+func (m *Mock) ContainerStats(ctx context.Context, name string) (io.ReadCloser, error) {
 	args := m.Called(name)
 	return args.Get(0).(io.ReadCloser), args.Error(1)
 }
 
+func (m *Mock) ContainerCPUs(ctx context.Context, name string) (float64, error) {
+	args := m.Called(name)
+	return args.Get(0).(float64), args.Error(1)
+}
+
 func (m *Mock) ContainerResize(name string, rows, cols uint) error {
 	args := m.Called(name, rows, cols)
 	return args.Error(0)
@@ -89,6 +95,16 @@ func (m *Mock) ContainerDelete(id string) error {
 	return args.Error(0)
 }
 
+func (m *Mock) ContainerPause(name string) error {
+	args := m.Called(name)
+	return args.Error(0)
+}
+
+func (m *Mock) ContainerUnpause(name string) error {
+	args := m.Called(name)
+	return args.Error(0)
+}
+
 func (m *Mock) ContainerCreate(opts CreateContainerOpts) error {
 	args := m.Called(opts)
 	return args.Error(0)
@@ -173,3 +189,13 @@ func (m *MockConn) SetReadDeadline(t time.Time) error {
 func (m *MockConn) SetWriteDeadline(t time.Time) error {
 	return nil
 }
+
+func (m *Mock) VolumeCreate(name string, labels map[string]string) error {
+	args := m.Called(name, labels)
+	return args.Error(0)
+}
+
+func (m *Mock) VolumeInspect(name string) (types.Volume, error) {
+	args := m.Called(name)
+	return args.Get(0).(types.Volume), args.Error(1)
+}
@@ -1,5 +1,12 @@
 package event
 
+import (
+	"errors"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
 type EventType string
 
 func (e EventType) String() string {
@@ -15,14 +22,141 @@ var (
 	SESSION_END              = EventType("session end")
 	SESSION_READY            = EventType("session ready")
 	SESSION_BUILDER_OUT      = EventType("session builder out")
+	SESSION_IDLE             = EventType("session idle")
+	SESSION_EXPIRING         = EventType("session expiring")
+	SESSION_EXTENDED         = EventType("session extended")
+	SESSION_HIBERNATED       = EventType("session hibernated")
+	SESSION_RESUMED          = EventType("session resumed")
 	PLAYGROUND_NEW           = EventType("playground_new")
 )
 
 type Handler func(id string, args ...interface{})
 type AnyHandler func(eventType EventType, id string, args ...interface{})
 
+// Label of the handlers gauge for the handlers registered with OnAny.
+const anyLabel = "any"
+
+var (
+	handlersGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pwd_event_handlers",
+		Help: "Event handlers currently registered, by event",
+	}, []string{"event"})
+	queueGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pwd_event_queue_depth",
+		Help: "Events waiting in the queues of the handlers, by event the handlers are registered for",
+	}, []string{"event"})
+	droppedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pwd_event_dropped_total",
+		Help: "Events dropped because the queue of a handler was full, by event",
+	}, []string{"event"})
+)
+
+func init() {
+	prometheus.MustRegister(handlersGauge, queueGauge, droppedCounter)
+}
+
 type EventApi interface {
 	Emit(name EventType, id string, args ...interface{})
-	On(name EventType, handler Handler)
-	OnAny(handler AnyHandler)
+	On(name EventType, handler Handler, opts ...Option) Subscription
+	OnAny(handler AnyHandler, opts ...Option) Subscription
+}
+
+// QueuePolicy is what happens to an event when the queue of a handler is
+// full.
+type QueuePolicy int
+
+const (
+	// Block makes Emit wait for room in the queue.
+	Block QueuePolicy = iota
+	// Drop discards the event for that handler.
+	Drop
+)
+
+const DefaultQueueSize = 1000
+
+var UnknownQueuePolicyError = errors.New("UnknownQueuePolicy")
+
+// ParseQueuePolicy returns the policy named s, either block or drop.
+func ParseQueuePolicy(s string) (QueuePolicy, error) {
+	switch s {
+	case "block":
+		return Block, nil
+	case "drop":
+		return Drop, nil
+	}
+
+	return Block, UnknownQueuePolicyError
+}
+
+type options struct {
+	size   int
+	policy QueuePolicy
+	once   bool
+	onDrop func(name EventType, sessionId string)
+}
+
+func newOptions(opts []Option) options {
+	o := options{size: DefaultQueueSize, policy: Block}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
+// Option sets how events are queued for a handler.
+type Option func(o *options)
+
+func WithQueueSize(size int) Option {
+	return func(o *options) {
+		if size > 0 {
+			o.size = size
+		}
+	}
+}
+
+func WithQueuePolicy(policy QueuePolicy) Option {
+	return func(o *options) {
+		o.policy = policy
+	}
+}
+
+// OnDrop calls fn when an event is dropped because the queue of the handler
+// is full. It is called by Emit, so it must not block.
+func OnDrop(fn func(name EventType, sessionId string)) Option {
+	return func(o *options) {
+		o.onDrop = fn
+	}
+}
+
+// Once calls the handler on a single replica for each lifecycle event, instead
+// of on all of them. It is meant for handlers with effects outside of the
+// replica, such as sending webhooks. Other events are still delivered to the
+// handler on every replica.
+func Once() Option {
+	return func(o *options) {
+		o.once = true
+	}
+}
+
+// Subscription is returned when registering a handler. Unsubscribe removes
+// the handler, which is not called for the events emitted afterwards. It can
+// be called more than once.
+type Subscription interface {
+	Unsubscribe()
+}
+
+type subscription struct {
+	once   sync.Once
+	cancel func()
+}
+
+// NewSubscription returns a Subscription that calls cancel on its first
+// Unsubscribe.
+func NewSubscription(cancel func()) Subscription {
+	return &subscription{cancel: cancel}
+}
+
+func (s *subscription) Unsubscribe() {
+	s.once.Do(s.cancel)
 }
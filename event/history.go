@@ -0,0 +1,144 @@
+package event
+
+import (
+	"sync"
+	"time"
+)
+
+// Record is an event kept in the history of its session. Ids start at 1 and
+// increase by one with each event of the session.
+type Record struct {
+	Id   uint64
+	Name EventType
+	Args []interface{}
+}
+
+// History keeps the last events of each session, so that a client that
+// reconnects can get the ones it missed before following the new ones. The
+// history of a session is dropped some time after it ends.
+type History struct {
+	size      int
+	retention time.Duration
+
+	mx       sync.Mutex
+	sessions map[string]*sessionHistory
+}
+
+type sessionHistory struct {
+	// Ring of the last records, the one with id n is at (n-1) % size.
+	records  []Record
+	last     uint64
+	watchers map[chan Record]bool
+}
+
+// NewHistory records the events emitted on e, keeping the last size events
+// of each session, and forgets a session retention after it ends.
+func NewHistory(e EventApi, size int, retention time.Duration) *History {
+	if size < 1 {
+		size = 1
+	}
+
+	h := &History{size: size, retention: retention, sessions: map[string]*sessionHistory{}}
+
+	e.OnAny(h.record)
+
+	return h
+}
+
+func (h *History) session(id string) *sessionHistory {
+	s, found := h.sessions[id]
+	if !found {
+		s = &sessionHistory{records: make([]Record, h.size), watchers: map[chan Record]bool{}}
+		h.sessions[id] = s
+	}
+
+	return s
+}
+
+func (h *History) record(name EventType, sessionId string, args ...interface{}) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	s := h.session(sessionId)
+
+	s.last++
+	r := Record{Id: s.last, Name: name, Args: args}
+	s.records[(r.Id-1)%uint64(h.size)] = r
+
+	for c := range s.watchers {
+		select {
+		case c <- r:
+		default:
+			// Too slow to follow, it has to catch up from the history.
+			delete(s.watchers, c)
+			close(c)
+		}
+	}
+
+	if name == SESSION_END {
+		time.AfterFunc(h.retention, func() {
+			h.forget(sessionId, s)
+		})
+	}
+}
+
+func (h *History) forget(sessionId string, s *sessionHistory) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	if h.sessions[sessionId] != s {
+		return
+	}
+
+	delete(h.sessions, sessionId)
+	for c := range s.watchers {
+		delete(s.watchers, c)
+		close(c)
+	}
+}
+
+// Watch returns the events of the session kept after the one with id after,
+// all of them if after is unknown, and a channel that receives the next ones.
+// The channel is closed once the session is forgotten, or if the receiver
+// falls more than the history size behind. It must be unsubscribed when no
+// longer read.
+func (h *History) Watch(sessionId string, after uint64) ([]Record, <-chan Record, Subscription) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	s := h.session(sessionId)
+
+	first := uint64(1)
+	if s.last > uint64(h.size) {
+		first = s.last - uint64(h.size) + 1
+	}
+	if after < s.last && after >= first {
+		first = after + 1
+	} else if after == s.last {
+		first = s.last + 1
+	}
+
+	var records []Record
+	for id := first; id <= s.last; id++ {
+		records = append(records, s.records[(id-1)%uint64(h.size)])
+	}
+
+	c := make(chan Record, h.size)
+	s.watchers[c] = true
+
+	return records, c, NewSubscription(func() {
+		h.mx.Lock()
+		defer h.mx.Unlock()
+
+		if s.watchers[c] {
+			delete(s.watchers, c)
+			close(c)
+		}
+
+		// Watching a session without events, such as one that is gone,
+		// does not keep its history.
+		if s.last == 0 && len(s.watchers) == 0 && h.sessions[sessionId] == s {
+			delete(h.sessions, sessionId)
+		}
+	})
+}
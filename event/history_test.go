@@ -0,0 +1,99 @@
+package event
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func ids(records []Record) []uint64 {
+	r := []uint64{}
+	for _, record := range records {
+		r = append(r, record.Id)
+	}
+	return r
+}
+
+func TestHistory_Watch(t *testing.T) {
+	h := NewHistory(NewLocalBroker(), 3, time.Minute)
+
+	h.record(SESSION_READY, "s1", true)
+	h.record(INSTANCE_NEW, "s2", "i1")
+	for i := 0; i < 4; i++ {
+		h.record(SESSION_BUILDER_OUT, "s1", "out")
+	}
+
+	records, _, sub := h.Watch("s1", 0)
+	defer sub.Unsubscribe()
+	assert.Equal(t, []uint64{3, 4, 5}, ids(records))
+	assert.Equal(t, Record{Id: 5, Name: SESSION_BUILDER_OUT, Args: []interface{}{"out"}}, records[2])
+
+	records, _, sub = h.Watch("s1", 3)
+	defer sub.Unsubscribe()
+	assert.Equal(t, []uint64{4, 5}, ids(records))
+
+	records, _, sub = h.Watch("s1", 5)
+	defer sub.Unsubscribe()
+	assert.Empty(t, records)
+
+	// Ids older than the history or from before a restart get all of it.
+	records, _, sub = h.Watch("s1", 1)
+	defer sub.Unsubscribe()
+	assert.Equal(t, []uint64{3, 4, 5}, ids(records))
+
+	records, c, sub := h.Watch("s2", 42)
+	assert.Equal(t, []uint64{1}, ids(records))
+
+	h.record(INSTANCE_DELETE, "s2", "i1")
+	assert.Equal(t, Record{Id: 2, Name: INSTANCE_DELETE, Args: []interface{}{"i1"}}, <-c)
+
+	sub.Unsubscribe()
+	_, open := <-c
+	assert.False(t, open)
+}
+
+func TestHistory_SlowWatcher(t *testing.T) {
+	h := NewHistory(NewLocalBroker(), 2, time.Minute)
+
+	_, c, sub := h.Watch("s1", 0)
+	defer sub.Unsubscribe()
+
+	for i := 0; i < 3; i++ {
+		h.record(SESSION_BUILDER_OUT, "s1", "out")
+	}
+
+	assert.Equal(t, uint64(1), (<-c).Id)
+	assert.Equal(t, uint64(2), (<-c).Id)
+	_, open := <-c
+	assert.False(t, open)
+}
+
+func TestHistory_SessionEnd(t *testing.T) {
+	broker := NewLocalBroker()
+	h := NewHistory(broker, 10, 10*time.Millisecond)
+
+	_, c, sub := h.Watch("s1", 0)
+	defer sub.Unsubscribe()
+
+	broker.Emit(SESSION_END, "s1")
+	assert.Equal(t, SESSION_END, (<-c).Name)
+
+	_, open := <-c
+	assert.False(t, open)
+
+	records, _, sub := h.Watch("s1", 0)
+	defer sub.Unsubscribe()
+	assert.Empty(t, records)
+}
+
+func TestHistory_WatchWithoutEvents(t *testing.T) {
+	h := NewHistory(NewLocalBroker(), 10, time.Minute)
+
+	_, _, sub := h.Watch("gone", 0)
+	sub.Unsubscribe()
+
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	assert.Empty(t, h.sessions)
+}
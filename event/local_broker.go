@@ -1,49 +1,243 @@
 package event
 
-import "sync"
+import (
+	"log"
+	"runtime/debug"
+	"sync"
+)
+
+type delivery struct {
+	name      EventType
+	sessionId string
+	args      []interface{}
+	// Called once the handler returned, or the event was dropped.
+	done func()
+}
+
+// subscriber receives the events of a handler in its own queue, so a slow
+// handler only delays its own events.
+type subscriber struct {
+	label  string
+	policy QueuePolicy
+	once   bool
+	onDrop func(name EventType, sessionId string)
+	queue  chan delivery
+	stop   chan struct{}
+	call   func(d delivery)
+}
 
 type localBroker struct {
-	sync.Mutex
+	options options
 
-	handlers    map[EventType][]Handler
-	anyHandlers []AnyHandler
+	mx          sync.RWMutex
+	handlers    map[EventType][]*subscriber
+	anyHandlers []*subscriber
 }
 
-func NewLocalBroker() *localBroker {
-	return &localBroker{handlers: map[EventType][]Handler{}, anyHandlers: []AnyHandler{}}
+// NewLocalBroker returns a broker that delivers events to the handlers of
+// this process. Each handler gets its own queue, whose size and policy are
+// set by opts unless overridden when registering the handler.
+func NewLocalBroker(opts ...Option) *localBroker {
+	return &localBroker{options: newOptions(opts), handlers: map[EventType][]*subscriber{}, anyHandlers: []*subscriber{}}
 }
 
-func (b *localBroker) On(name EventType, handler Handler) {
-	b.Lock()
-	defer b.Unlock()
+func (b *localBroker) subscribe(label string, opts []Option, call func(d delivery)) *subscriber {
+	o := b.options
+	for _, opt := range opts {
+		opt(&o)
+	}
 
-	if b.handlers[name] == nil {
-		b.handlers[name] = []Handler{}
+	s := &subscriber{
+		label:  label,
+		policy: o.policy,
+		once:   o.once,
+		onDrop: o.onDrop,
+		queue:  make(chan delivery, o.size),
+		stop:   make(chan struct{}),
+		call:   call,
 	}
 
-	b.handlers[name] = append(b.handlers[name], handler)
+	handlersGauge.WithLabelValues(label).Inc()
+	go s.run()
+
+	return s
+}
+
+func (s *subscriber) run() {
+	for {
+		select {
+		case d := <-s.queue:
+			queueGauge.WithLabelValues(s.label).Dec()
+			s.deliver(d)
+		case <-s.stop:
+			// Events already queued are dropped along with the handler.
+			for {
+				select {
+				case d := <-s.queue:
+					queueGauge.WithLabelValues(s.label).Dec()
+					if d.done != nil {
+						d.done()
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
 }
 
-func (b *localBroker) OnAny(handler AnyHandler) {
-	b.Lock()
-	defer b.Unlock()
+func (s *subscriber) deliver(d delivery) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Recovered from panic in handler of event %s. Got: %v\n%s", d.name, r, debug.Stack())
+		}
+		if d.done != nil {
+			d.done()
+		}
+	}()
 
-	b.anyHandlers = append(b.anyHandlers, handler)
+	s.call(d)
 }
 
-func (b *localBroker) Emit(name EventType, sessionId string, args ...interface{}) {
-	go func() {
-		b.Lock()
-		defer b.Unlock()
+func (s *subscriber) enqueue(d delivery) {
+	queueGauge.WithLabelValues(s.label).Inc()
 
-		for _, handler := range b.anyHandlers {
-			handler(name, sessionId, args...)
+	if s.policy == Block {
+		select {
+		case s.queue <- d:
+			return
+		case <-s.stop:
+		}
+	} else {
+		select {
+		case s.queue <- d:
+			return
+		case <-s.stop:
+		default:
+			droppedCounter.WithLabelValues(d.name.String()).Inc()
+			if s.onDrop != nil {
+				s.onDrop(d.name, d.sessionId)
+			}
 		}
+	}
+
+	queueGauge.WithLabelValues(s.label).Dec()
+	if d.done != nil {
+		d.done()
+	}
+}
 
-		if b.handlers[name] != nil {
-			for _, handler := range b.handlers[name] {
-				handler(sessionId, args...)
+func (s *subscriber) close() {
+	close(s.stop)
+	handlersGauge.WithLabelValues(s.label).Dec()
+}
+
+func (b *localBroker) On(name EventType, handler Handler, opts ...Option) Subscription {
+	s := b.subscribe(name.String(), opts, func(d delivery) {
+		handler(d.sessionId, d.args...)
+	})
+
+	b.mx.Lock()
+	b.handlers[name] = append(b.handlers[name], s)
+	b.mx.Unlock()
+
+	return NewSubscription(func() {
+		b.mx.Lock()
+		defer b.mx.Unlock()
+
+		for i, registered := range b.handlers[name] {
+			if registered == s {
+				b.handlers[name] = append(b.handlers[name][:i:i], b.handlers[name][i+1:]...)
+				s.close()
+				break
 			}
 		}
-	}()
+
+		if len(b.handlers[name]) == 0 {
+			delete(b.handlers, name)
+		}
+	})
+}
+
+func (b *localBroker) OnAny(handler AnyHandler, opts ...Option) Subscription {
+	s := b.subscribe(anyLabel, opts, func(d delivery) {
+		handler(d.name, d.sessionId, d.args...)
+	})
+
+	b.mx.Lock()
+	b.anyHandlers = append(b.anyHandlers, s)
+	b.mx.Unlock()
+
+	return NewSubscription(func() {
+		b.mx.Lock()
+		defer b.mx.Unlock()
+
+		for i, registered := range b.anyHandlers {
+			if registered == s {
+				b.anyHandlers = append(b.anyHandlers[:i:i], b.anyHandlers[i+1:]...)
+				s.close()
+				break
+			}
+		}
+	})
+}
+
+// scope selects the handlers an event is dispatched to.
+type scope int
+
+const (
+	allHandlers scope = iota
+	// Handlers called on every replica.
+	replicaHandlers
+	// Handlers registered with Once.
+	onceHandlers
+)
+
+func (s scope) includes(sub *subscriber) bool {
+	switch s {
+	case replicaHandlers:
+		return !sub.once
+	case onceHandlers:
+		return sub.once
+	}
+
+	return true
+}
+
+// Emit queues the event for each handler. It only waits for handlers with
+// the Block policy whose queue is full.
+func (b *localBroker) Emit(name EventType, sessionId string, args ...interface{}) {
+	b.dispatch(name, sessionId, args, allHandlers, nil)
+}
+
+// dispatch queues the event for each handler in scope, calling done once
+// every one of them returned or dropped it.
+func (b *localBroker) dispatch(name EventType, sessionId string, args []interface{}, sc scope, done func()) {
+	var subscribers []*subscriber
+
+	b.mx.RLock()
+	for _, s := range append(append([]*subscriber{}, b.anyHandlers...), b.handlers[name]...) {
+		if sc.includes(s) {
+			subscribers = append(subscribers, s)
+		}
+	}
+	b.mx.RUnlock()
+
+	var wg sync.WaitGroup
+	d := delivery{name: name, sessionId: sessionId, args: args}
+	if done != nil {
+		wg.Add(len(subscribers))
+		d.done = wg.Done
+	}
+
+	for _, s := range subscribers {
+		s.enqueue(d)
+	}
+
+	if done != nil {
+		go func() {
+			wg.Wait()
+			done()
+		}()
+	}
 }
@@ -4,6 +4,7 @@ import (
 	"sync"
 	"testing"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -60,3 +61,117 @@ func TestLocalBroker_OnAny(t *testing.T) {
 	assert.Equal(t, "1", receivedSessionId)
 	assert.Equal(t, expectedArgs, receivedArgs)
 }
+
+func TestLocalBroker_Unsubscribe(t *testing.T) {
+	broker := NewLocalBroker()
+
+	handlers := testutil.ToFloat64(handlersGauge.WithLabelValues(SESSION_END.String()))
+
+	called := make(chan string, 10)
+
+	sub := broker.On(SESSION_END, func(sessionId string, args ...interface{}) {
+		called <- "on"
+	})
+	anySub := broker.OnAny(func(eventType EventType, sessionId string, args ...interface{}) {
+		called <- "any"
+	})
+	broker.On(SESSION_END, func(sessionId string, args ...interface{}) {
+		called <- "kept"
+	})
+
+	assert.Equal(t, handlers+2, testutil.ToFloat64(handlersGauge.WithLabelValues(SESSION_END.String())))
+
+	sub.Unsubscribe()
+	sub.Unsubscribe()
+	anySub.Unsubscribe()
+
+	assert.Equal(t, handlers+1, testutil.ToFloat64(handlersGauge.WithLabelValues(SESSION_END.String())))
+
+	broker.Emit(SESSION_END, "1")
+
+	assert.Equal(t, "kept", <-called)
+	assert.Len(t, called, 0)
+}
+
+func TestLocalBroker_UnsubscribeFromHandler(t *testing.T) {
+	broker := NewLocalBroker()
+
+	called := make(chan string, 10)
+
+	var sub Subscription
+	sub = broker.On(SESSION_END, func(sessionId string, args ...interface{}) {
+		sub.Unsubscribe()
+		called <- "once " + sessionId
+	})
+	broker.On(SESSION_END, func(sessionId string, args ...interface{}) {
+		called <- "kept " + sessionId
+	})
+
+	broker.Emit(SESSION_END, "1")
+	assert.ElementsMatch(t, []string{"once 1", "kept 1"}, []string{<-called, <-called})
+
+	broker.Emit(SESSION_END, "2")
+	assert.Equal(t, "kept 2", <-called)
+}
+
+func TestLocalBroker_SlowHandler(t *testing.T) {
+	broker := NewLocalBroker(WithQueueSize(1))
+
+	dropped := testutil.ToFloat64(droppedCounter.WithLabelValues(INSTANCE_STATS.String()))
+	queued := testutil.ToFloat64(queueGauge.WithLabelValues(anyLabel))
+
+	started := make(chan string, 10)
+	block := make(chan struct{})
+	slow := make(chan string, 10)
+	var drops []string
+	broker.OnAny(func(eventType EventType, sessionId string, args ...interface{}) {
+		started <- sessionId
+		<-block
+		slow <- sessionId
+	}, WithQueuePolicy(Drop), OnDrop(func(name EventType, sessionId string) {
+		drops = append(drops, sessionId)
+	}))
+
+	fast := make(chan string, 10)
+	broker.On(INSTANCE_STATS, func(sessionId string, args ...interface{}) {
+		fast <- sessionId
+	})
+
+	// The slow handler holds the first event, queues the second and drops
+	// the third, while the fast one gets all of them in order.
+	broker.Emit(INSTANCE_STATS, "1")
+	assert.Equal(t, "1", <-started)
+
+	for _, id := range []string{"2", "3"} {
+		broker.Emit(INSTANCE_STATS, id)
+	}
+	for _, id := range []string{"1", "2", "3"} {
+		assert.Equal(t, id, <-fast)
+	}
+
+	assert.Equal(t, dropped+1, testutil.ToFloat64(droppedCounter.WithLabelValues(INSTANCE_STATS.String())))
+	assert.Equal(t, queued+1, testutil.ToFloat64(queueGauge.WithLabelValues(anyLabel)))
+	assert.Equal(t, []string{"3"}, drops)
+
+	close(block)
+	assert.Equal(t, "1", <-slow)
+	assert.Equal(t, "2", <-slow)
+	assert.Len(t, slow, 0)
+}
+
+func TestLocalBroker_Panic(t *testing.T) {
+	broker := NewLocalBroker()
+
+	called := make(chan string, 10)
+	broker.On(SESSION_NEW, func(sessionId string, args ...interface{}) {
+		if sessionId == "1" {
+			panic("handler failed")
+		}
+		called <- sessionId
+	})
+
+	broker.Emit(SESSION_NEW, "1")
+	broker.Emit(SESSION_NEW, "2")
+
+	assert.Equal(t, "2", <-called)
+}
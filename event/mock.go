@@ -10,10 +10,12 @@ func (m *Mock) Emit(name EventType, sessionId string, args ...interface{}) {
 	m.M.Called(name, sessionId, args)
 }
 
-func (m *Mock) On(name EventType, handler Handler) {
+func (m *Mock) On(name EventType, handler Handler, opts ...Option) Subscription {
 	m.M.Called(name, handler)
+	return NewSubscription(func() {})
 }
 
-func (m *Mock) OnAny(handler AnyHandler) {
+func (m *Mock) OnAny(handler AnyHandler, opts ...Option) Subscription {
 	m.M.Called(handler)
+	return NewSubscription(func() {})
 }
@@ -0,0 +1,81 @@
+package event
+
+import (
+	"time"
+
+	"github.com/dimaskiddo/play-with-docker/pwd/types"
+)
+
+// Empty is the payload of the events emitted without arguments.
+type Empty struct{}
+
+type InstanceNew struct {
+	Name      string
+	IP        string
+	Hostname  string
+	ProxyHost string
+}
+
+type InstanceDelete struct {
+	Name string
+}
+
+type ViewportResize struct {
+	Cols uint
+	Rows uint
+}
+
+// SessionEnd carries the owners of the session, which is already deleted
+// from the storage when it is emitted, and the resources its instances used
+// if they were collected.
+type SessionEnd struct {
+	PlaygroundId string
+	UserId       string
+	Usage        *types.SessionUsage
+}
+
+type SessionReady struct {
+	Ready bool
+}
+
+type SessionBuilderOut struct {
+	Data string
+}
+
+// SessionIdle warns that the session is closed at ClosesAt unless a client
+// comes back before.
+type SessionIdle struct {
+	ClosesAt time.Time
+}
+
+// SessionExpiring warns that the session is closed at ExpiresAt unless it is
+// extended.
+type SessionExpiring struct {
+	ExpiresAt time.Time
+}
+
+type SessionExtended struct {
+	ExpiresAt time.Time
+}
+
+// SessionResumed is emitted once the instances of a hibernated session run
+// again. ExpiresAt is later than before if the expiry stopped meanwhile.
+type SessionResumed struct {
+	ExpiresAt time.Time
+}
+
+var (
+	InstanceNewEvent       = Register[InstanceNew](INSTANCE_NEW, 1, Positional)
+	InstanceDeleteEvent    = Register[InstanceDelete](INSTANCE_DELETE, 1, Positional)
+	ViewportResizeEvent    = Register[ViewportResize](INSTANCE_VIEWPORT_RESIZE, 1, Positional)
+	SessionNewEvent        = Register[Empty](SESSION_NEW, 1, Positional)
+	SessionEndEvent        = Register[SessionEnd](SESSION_END, 3, Positional)
+	SessionReadyEvent      = Register[SessionReady](SESSION_READY, 1, Positional)
+	SessionBuilderOutEvent = Register[SessionBuilderOut](SESSION_BUILDER_OUT, 1, Positional)
+	SessionIdleEvent       = Register[SessionIdle](SESSION_IDLE, 1, Positional)
+	SessionExpiringEvent   = Register[SessionExpiring](SESSION_EXPIRING, 1, Positional)
+	SessionExtendedEvent   = Register[SessionExtended](SESSION_EXTENDED, 1, Positional)
+	SessionHibernatedEvent = Register[Empty](SESSION_HIBERNATED, 1, Positional)
+	SessionResumedEvent    = Register[SessionResumed](SESSION_RESUMED, 1, Positional)
+	PlaygroundNewEvent     = Register[Empty](PLAYGROUND_NEW, 1, Positional)
+)
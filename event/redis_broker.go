@@ -0,0 +1,384 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Approximate number of lifecycle events kept in the stream. A replica
+	// that falls further behind misses the oldest ones.
+	redisStreamMaxLen = 10000
+)
+
+var (
+	redisRetryInterval = time.Second
+	// Time after which the lifecycle events read by a replica for its Once
+	// handlers without being acknowledged are taken over by another one.
+	redisClaimIdle = time.Minute
+	// The consumer group of a replica is destroyed once the replica did not
+	// refresh its key for redisGroupTTL. Replicas refresh their key and look
+	// for stale groups every redisGroupSweepInterval.
+	redisGroupTTL           = 24 * time.Hour
+	redisGroupSweepInterval = time.Hour
+)
+
+// lifecycleEvents are delivered at least once to every replica, even if it
+// was disconnected or restarted when they were emitted, so their handlers
+// run on every replica and may be called more than once for the same event.
+// Handlers registered with Once get them on one of the replicas only, still
+// at least once. The other events are delivered to the replicas connected at
+// the time, at most once. A replica stopped for longer than redisGroupTTL
+// loses its group, and starts again from the new events.
+var lifecycleEvents = map[EventType]bool{
+	SESSION_NEW:      true,
+	SESSION_END:      true,
+	SESSION_READY:    true,
+	SESSION_EXTENDED: true,
+	SESSION_RESUMED:  true,
+	INSTANCE_NEW:     true,
+	INSTANCE_DELETE:  true,
+	PLAYGROUND_NEW:   true,
+}
+
+type redisMessage struct {
+	Name    EventType     `json:"name"`
+	Version int           `json:"version,omitempty"`
+	Id      string        `json:"id"`
+	Args    []interface{} `json:"args"`
+}
+
+// redisBroker delivers the events emitted by any replica to the handlers of
+// every replica. Lifecycle events go through a stream read by one consumer
+// group per replica, and by a group shared by all of them for the Once
+// handlers, the others through a pub/sub channel. Arguments are
+// encoded as JSON and decoded back into the payload registered for the event,
+// or into plain JSON values if there is none. Events whose payload version
+// differs from the registered one are dropped.
+type redisBroker struct {
+	local     *localBroker
+	client    *redis.Client
+	stream    string
+	channel   string
+	replica   string
+	onceGroup string
+	// Prefix of the keys refreshed by the running replicas.
+	replicas string
+
+	ctx    context.Context
+	sub    *redis.PubSub
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewRedisBroker connects to the Redis server at url and keeps its stream and
+// channel under prefix. replica identifies
+// this replica across restarts, so that it gets the lifecycle events emitted
+// while it was stopped. Events are dispatched to the handlers once Start is
+// called, queued as set by opts.
+func NewRedisBroker(url, prefix, replica string, opts ...Option) (*redisBroker, error) {
+	redisOpts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &redisBroker{
+		local:     NewLocalBroker(opts...),
+		client:    redis.NewClient(redisOpts),
+		stream:    prefix + "events",
+		channel:   prefix + "events",
+		replica:   replica,
+		onceGroup: prefix + "once",
+		replicas:  prefix + "replicas:",
+	}
+
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+
+	// Claimed before the group is created, so that it is not swept meanwhile.
+	if err := b.client.Set(b.ctx, b.replicas+b.replica, time.Now().Unix(), redisGroupTTL).Err(); err != nil {
+		b.Close()
+		return nil, err
+	}
+
+	for _, group := range []string{b.replica, b.onceGroup} {
+		if err := b.createGroup(b.ctx, group); err != nil {
+			b.Close()
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+// Start dispatches the events to the handlers registered so far and to the
+// ones registered afterwards.
+func (b *redisBroker) Start() error {
+	b.sub = b.client.Subscribe(b.ctx, b.channel)
+	if _, err := b.sub.Receive(b.ctx); err != nil {
+		return err
+	}
+
+	b.wg.Add(4)
+	go b.receive()
+	go b.consume(b.ctx, b.replica, replicaHandlers)
+	go b.consume(b.ctx, b.onceGroup, onceHandlers)
+	go b.sweep(b.ctx)
+
+	return nil
+}
+
+func (b *redisBroker) sweep(ctx context.Context) {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(redisGroupSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		b.sweepGroups(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sweepGroups refreshes the key of this replica and destroys the groups of
+// the replicas whose key expired, so that the stream does not keep their
+// pending events forever.
+func (b *redisBroker) sweepGroups(ctx context.Context) {
+	if err := b.client.Set(ctx, b.replicas+b.replica, time.Now().Unix(), redisGroupTTL).Err(); err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Error refreshing replica %s. Got: %v\n", b.replica, err)
+		}
+		return
+	}
+
+	groups, err := b.client.XInfoGroups(ctx, b.stream).Result()
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Error listing event consumer groups. Got: %v\n", err)
+		}
+		return
+	}
+
+	for _, group := range groups {
+		if group.Name == b.replica || group.Name == b.onceGroup {
+			continue
+		}
+
+		alive, err := b.client.Exists(ctx, b.replicas+group.Name).Result()
+		if err != nil || alive > 0 {
+			continue
+		}
+
+		log.Printf("Destroying the event consumer group of replica %s, stopped for more than %s\n", group.Name, redisGroupTTL)
+		if err := b.client.XGroupDestroy(ctx, b.stream, group.Name).Err(); err != nil && ctx.Err() == nil {
+			log.Printf("Error destroying event consumer group %s. Got: %v\n", group.Name, err)
+		}
+	}
+}
+
+func (b *redisBroker) createGroup(ctx context.Context, group string) error {
+	err := b.client.XGroupCreateMkStream(ctx, b.stream, group, "$").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+
+	return nil
+}
+
+func (b *redisBroker) On(name EventType, handler Handler, opts ...Option) Subscription {
+	return b.local.On(name, handler, opts...)
+}
+
+func (b *redisBroker) OnAny(handler AnyHandler, opts ...Option) Subscription {
+	return b.local.OnAny(handler, opts...)
+}
+
+func (b *redisBroker) Emit(name EventType, sessionId string, args ...interface{}) {
+	m := redisMessage{Name: name, Id: sessionId, Args: args}
+	if r, found := lookup(name); found {
+		m.Version = r.version
+	}
+
+	payload, err := json.Marshal(m)
+	if err != nil {
+		log.Printf("Error encoding event %s. Got: %v\n", name, err)
+		return
+	}
+
+	ctx := context.Background()
+
+	if lifecycleEvents[name] {
+		err = b.client.XAdd(ctx, &redis.XAddArgs{
+			Stream: b.stream,
+			MaxLen: redisStreamMaxLen,
+			Approx: true,
+			Values: map[string]interface{}{"event": payload},
+		}).Err()
+	} else {
+		err = b.client.Publish(ctx, b.channel, payload).Err()
+	}
+
+	if err != nil {
+		log.Printf("Error emitting event %s. Got: %v\n", name, err)
+	}
+}
+
+// Close stops receiving events and disconnects from the server.
+func (b *redisBroker) Close() error {
+	b.cancel()
+	if b.sub != nil {
+		b.sub.Close()
+	}
+	b.wg.Wait()
+
+	return b.client.Close()
+}
+
+// decode returns the event encoded in payload, with the arguments decoded
+// into the registered payload, if any.
+func (b *redisBroker) decode(payload string) (redisMessage, bool) {
+	var m redisMessage
+	if err := json.Unmarshal([]byte(payload), &m); err != nil {
+		log.Printf("Error decoding event. Got: %v\n", err)
+		return m, false
+	}
+
+	if r, found := lookup(m.Name); found {
+		if m.Version != r.version {
+			log.Printf("Dropping event %s with payload version %d, expected %d\n", m.Name, m.Version, r.version)
+			return m, false
+		}
+
+		args, err := r.normalize(m.Args)
+		if err != nil {
+			log.Printf("Error decoding event. Got: %v\n", err)
+			return m, false
+		}
+		m.Args = args
+	}
+
+	return m, true
+}
+
+func (b *redisBroker) receive() {
+	defer b.wg.Done()
+
+	for msg := range b.sub.Channel() {
+		if m, ok := b.decode(msg.Payload); ok {
+			b.local.dispatch(m.Name, m.Id, m.Args, allHandlers, nil)
+		}
+	}
+}
+
+// consume dispatches the lifecycle events read through group to the handlers
+// in scope and acknowledges them once they returned. It starts with the events
+// read before a restart that were never acknowledged. The events of the shared
+// group left unacknowledged by a replica that stopped are taken over.
+func (b *redisBroker) consume(ctx context.Context, group string, sc scope) {
+	defer b.wg.Done()
+
+	start := "0"
+
+	for ctx.Err() == nil {
+		streams, err := b.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    group,
+			Consumer: b.replica,
+			Streams:  []string{b.stream, start},
+			Count:    100,
+			Block:    time.Second,
+		}).Result()
+		if err == redis.Nil {
+			if group == b.onceGroup {
+				b.claim(ctx)
+			}
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			log.Printf("Error reading events. Got: %v\n", err)
+
+			// The group is gone if the server lost its data.
+			if strings.HasPrefix(err.Error(), "NOGROUP") {
+				b.createGroup(ctx, group)
+			}
+
+			select {
+			case <-time.After(redisRetryInterval):
+			case <-ctx.Done():
+			}
+			continue
+		}
+
+		for _, stream := range streams {
+			if start != ">" && len(stream.Messages) == 0 {
+				start = ">"
+			}
+
+			if !b.handle(ctx, group, sc, stream.Messages) {
+				return
+			}
+
+			if start != ">" && len(stream.Messages) > 0 {
+				start = stream.Messages[len(stream.Messages)-1].ID
+			}
+		}
+	}
+}
+
+// claim takes over the events of the shared group that another replica read
+// but did not acknowledge for a while.
+func (b *redisBroker) claim(ctx context.Context) {
+	messages, _, err := b.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   b.stream,
+		Group:    b.onceGroup,
+		Consumer: b.replica,
+		MinIdle:  redisClaimIdle,
+		Start:    "0-0",
+		Count:    100,
+	}).Result()
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Error claiming events. Got: %v\n", err)
+		}
+		return
+	}
+
+	b.handle(ctx, b.onceGroup, onceHandlers, messages)
+}
+
+// handle dispatches messages and acknowledges each one once its handlers
+// returned. It returns false if ctx was canceled meanwhile.
+func (b *redisBroker) handle(ctx context.Context, group string, sc scope, messages []redis.XMessage) bool {
+	for _, msg := range messages {
+		payload, _ := msg.Values["event"].(string)
+		if m, ok := b.decode(payload); ok {
+			done := make(chan struct{})
+			b.local.dispatch(m.Name, m.Id, m.Args, sc, func() { close(done) })
+
+			select {
+			case <-done:
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		if err := b.client.XAck(ctx, b.stream, group, msg.ID).Err(); err != nil && ctx.Err() == nil {
+			log.Printf("Error acknowledging event %s. Got: %v\n", msg.ID, err)
+		}
+	}
+
+	return true
+}
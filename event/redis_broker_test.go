@@ -0,0 +1,229 @@
+package event
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dimaskiddo/play-with-docker/pwd/types"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+type received struct {
+	name EventType
+	id   string
+	args []interface{}
+}
+
+func newRedisTestBroker(t *testing.T, server *miniredis.Miniredis, replica string) *redisBroker {
+	b, err := NewRedisBroker("redis://"+server.Addr()+"/0", "pwd:", replica)
+	assert.Nil(t, err)
+
+	return b
+}
+
+func receiveAll(t *testing.T, b *redisBroker) chan received {
+	c := make(chan received, 10)
+
+	b.OnAny(func(name EventType, id string, args ...interface{}) {
+		c <- received{name, id, args}
+	})
+	assert.Nil(t, b.Start())
+
+	return c
+}
+
+func nextReceived(t *testing.T, c chan received) received {
+	t.Helper()
+
+	select {
+	case r := <-c:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+		return received{}
+	}
+}
+
+func TestRedisBroker(t *testing.T) {
+	server := miniredis.RunT(t)
+
+	a := newRedisTestBroker(t, server, "a")
+	defer a.Close()
+	b := newRedisTestBroker(t, server, "b")
+	defer b.Close()
+
+	fromA := receiveAll(t, a)
+	fromB := receiveAll(t, b)
+
+	a.Emit(INSTANCE_NEW, "s1", "i1", "10.0.0.1", "node1", "proxy")
+	for _, c := range []chan received{fromA, fromB} {
+		assert.Equal(t, received{INSTANCE_NEW, "s1", []interface{}{"i1", "10.0.0.1", "node1", "proxy"}}, nextReceived(t, c))
+	}
+
+	// Registered payloads are decoded into their types.
+	ViewportResizeEvent.Emit(a, "s1", ViewportResize{Cols: 80, Rows: 24})
+	for _, c := range []chan received{fromA, fromB} {
+		assert.Equal(t, received{INSTANCE_VIEWPORT_RESIZE, "s1", []interface{}{uint(80), uint(24)}}, nextReceived(t, c))
+	}
+
+	// Payloads from a replica with another version of the event are dropped.
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	assert.Nil(t, client.Publish(context.Background(), "pwd:events", `{"name":"instance viewport resize","version":2,"id":"s1","args":[{"cols":80,"rows":24}]}`).Err())
+
+	b.Emit(INSTANCE_STATS, "s1", struct {
+		Instance string `json:"instance"`
+		Mem      uint   `json:"mem"`
+	}{"i1", 42})
+	for _, c := range []chan received{fromA, fromB} {
+		assert.Equal(t, received{INSTANCE_STATS, "s1", []interface{}{map[string]interface{}{"instance": "i1", "mem": float64(42)}}}, nextReceived(t, c))
+	}
+}
+
+func TestRedisBrokerRestart(t *testing.T) {
+	server := miniredis.RunT(t)
+
+	a := newRedisTestBroker(t, server, "a")
+	defer a.Close()
+
+	b := newRedisTestBroker(t, server, "b")
+	receiveAll(t, b)
+	assert.Nil(t, b.Close())
+
+	// Lifecycle events emitted while b is stopped are delivered once it
+	// is back, the others are not.
+	a.Emit(SESSION_BUILDER_OUT, "s1", "building")
+	a.Emit(SESSION_NEW, "s1")
+	a.Emit(SESSION_END, "s1", "p1", "u1", nil)
+	a.Emit(SESSION_READY, "s2", true)
+
+	// b read some of them but stopped before acknowledging them.
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	_, err := client.XReadGroup(context.Background(), &redis.XReadGroupArgs{Group: "b", Consumer: "b", Streams: []string{"pwd:events", ">"}, Count: 2}).Result()
+	assert.Nil(t, err)
+
+	b = newRedisTestBroker(t, server, "b")
+	defer b.Close()
+	c := receiveAll(t, b)
+
+	assert.Equal(t, received{SESSION_NEW, "s1", nil}, nextReceived(t, c))
+	assert.Equal(t, received{SESSION_END, "s1", []interface{}{"p1", "u1", (*types.SessionUsage)(nil)}}, nextReceived(t, c))
+	assert.Equal(t, received{SESSION_READY, "s2", []interface{}{true}}, nextReceived(t, c))
+
+	a.Emit(INSTANCE_DELETE, "s2", "i1")
+	assert.Equal(t, received{INSTANCE_DELETE, "s2", []interface{}{"i1"}}, nextReceived(t, c))
+
+	assert.Eventually(t, func() bool {
+		pending, err := client.XPending(context.Background(), "pwd:events", "b").Result()
+		return err == nil && pending.Count == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestRedisBrokerOnce(t *testing.T) {
+	defer func(idle time.Duration) { redisClaimIdle = idle }(redisClaimIdle)
+	redisClaimIdle = 100 * time.Millisecond
+
+	server := miniredis.RunT(t)
+
+	once := make(chan string, 10)
+	start := func(replica string) (*redisBroker, chan received) {
+		b := newRedisTestBroker(t, server, replica)
+		b.On(SESSION_NEW, func(id string, args ...interface{}) {
+			once <- replica + " " + id
+		}, Once())
+
+		return b, receiveAll(t, b)
+	}
+
+	nextOnce := func() string {
+		t.Helper()
+
+		select {
+		case called := <-once:
+			return called
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the Once handler")
+			return ""
+		}
+	}
+
+	a, fromA := start("a")
+	b, fromB := start("b")
+
+	// Handlers without Once still get the event on every replica.
+	a.Emit(SESSION_NEW, "s1")
+	for _, c := range []chan received{fromA, fromB} {
+		assert.Equal(t, received{SESSION_NEW, "s1", nil}, nextReceived(t, c))
+	}
+
+	assert.Contains(t, []string{"a s1", "b s1"}, nextOnce())
+	select {
+	case called := <-once:
+		t.Fatalf("Once handler called again: %s", called)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	assert.Nil(t, a.Close())
+	assert.Nil(t, b.Close())
+
+	// An event read by a replica that stopped before handling it is taken
+	// over by another one.
+	c := newRedisTestBroker(t, server, "c")
+	defer c.Close()
+	c.Emit(SESSION_NEW, "s2")
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	_, err := client.XReadGroup(context.Background(), &redis.XReadGroupArgs{Group: "pwd:once", Consumer: "b", Streams: []string{"pwd:events", ">"}, Count: 10}).Result()
+	assert.Nil(t, err)
+
+	a, _ = start("a")
+	defer a.Close()
+
+	assert.Equal(t, "a s2", nextOnce())
+}
+
+func TestRedisBrokerSweepGroups(t *testing.T) {
+	server := miniredis.RunT(t)
+
+	a := newRedisTestBroker(t, server, "a")
+	defer a.Close()
+	b := newRedisTestBroker(t, server, "b")
+
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	groups := func() []string {
+		infos, err := client.XInfoGroups(context.Background(), "pwd:events").Result()
+		assert.Nil(t, err)
+
+		names := []string{}
+		for _, info := range infos {
+			names = append(names, info.Name)
+		}
+		sort.Strings(names)
+
+		return names
+	}
+
+	// Running replicas keep their group.
+	a.sweepGroups(context.Background())
+	assert.Equal(t, []string{"a", "b", "pwd:once"}, groups())
+
+	assert.Nil(t, b.Close())
+	server.FastForward(2 * redisGroupTTL)
+
+	a.sweepGroups(context.Background())
+	assert.Equal(t, []string{"a", "pwd:once"}, groups())
+
+	// The group of a replica is created again when it restarts.
+	b = newRedisTestBroker(t, server, "b")
+	defer b.Close()
+
+	a.sweepGroups(context.Background())
+	assert.Equal(t, []string{"a", "b", "pwd:once"}, groups())
+}
@@ -0,0 +1,158 @@
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+)
+
+// Layout is how a payload is passed as the arguments of an event, which is
+// also how WebSocket clients receive it.
+type Layout int
+
+const (
+	// Single passes the payload as the only argument.
+	Single Layout = iota
+	// Positional passes each field of the payload struct as an argument, in
+	// the order they are declared.
+	Positional
+)
+
+type registration struct {
+	version   int
+	normalize func(args []interface{}) ([]interface{}, error)
+}
+
+var (
+	registryMx sync.RWMutex
+	registry   = map[EventType]registration{}
+)
+
+// Typed emits and subscribes to an event whose arguments are described by the
+// payload type T.
+type Typed[T any] struct {
+	Type    EventType
+	Version int
+	Layout  Layout
+}
+
+// Register declares T as the payload of the events of type t. The version
+// must be increased whenever the payload changes in a way that handlers
+// built with the previous one cannot decode. It panics if t is already
+// registered or if a Positional payload is not a struct.
+func Register[T any](t EventType, version int, layout Layout) Typed[T] {
+	e := Typed[T]{Type: t, Version: version, Layout: layout}
+
+	if layout == Positional && reflect.TypeOf((*T)(nil)).Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("positional payload of event %s is not a struct", t))
+	}
+
+	registryMx.Lock()
+	defer registryMx.Unlock()
+
+	if _, found := registry[t]; found {
+		panic(fmt.Sprintf("event %s registered twice", t))
+	}
+
+	registry[t] = registration{version: version, normalize: func(args []interface{}) ([]interface{}, error) {
+		payload, err := e.Decode(args)
+		if err != nil {
+			return nil, err
+		}
+
+		return e.Args(payload), nil
+	}}
+
+	return e
+}
+
+func lookup(t EventType) (registration, bool) {
+	registryMx.RLock()
+	defer registryMx.RUnlock()
+
+	r, found := registry[t]
+	return r, found
+}
+
+// Args returns the arguments payload is emitted with.
+func (e Typed[T]) Args(payload T) []interface{} {
+	if e.Layout == Single {
+		return []interface{}{payload}
+	}
+
+	var args []interface{}
+
+	v := reflect.ValueOf(payload)
+	for i := 0; i < v.NumField(); i++ {
+		args = append(args, v.Field(i).Interface())
+	}
+
+	return args
+}
+
+// Decode builds the payload from the arguments of an event, converting them
+// through JSON when they do not have the expected types, as is the case for
+// events received from another process.
+func (e Typed[T]) Decode(args []interface{}) (T, error) {
+	var payload T
+
+	v := reflect.ValueOf(&payload).Elem()
+
+	if e.Layout == Single {
+		if len(args) != 1 {
+			return payload, fmt.Errorf("event %s: expected 1 argument, got %d", e.Type, len(args))
+		}
+
+		if err := convert(args[0], v); err != nil {
+			return payload, fmt.Errorf("event %s: %v", e.Type, err)
+		}
+
+		return payload, nil
+	}
+
+	if len(args) != v.NumField() {
+		return payload, fmt.Errorf("event %s: expected %d arguments, got %d", e.Type, v.NumField(), len(args))
+	}
+
+	for i := range args {
+		if err := convert(args[i], v.Field(i)); err != nil {
+			return payload, fmt.Errorf("event %s: argument %d: %v", e.Type, i, err)
+		}
+	}
+
+	return payload, nil
+}
+
+func convert(arg interface{}, into reflect.Value) error {
+	if arg != nil && reflect.TypeOf(arg).AssignableTo(into.Type()) {
+		into.Set(reflect.ValueOf(arg))
+		return nil
+	}
+
+	b, err := json.Marshal(arg)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, into.Addr().Interface())
+}
+
+func (e Typed[T]) Emit(api EventApi, id string, payload T) {
+	api.Emit(e.Type, id, e.Args(payload)...)
+}
+
+// On registers a handler for the event. Events whose arguments cannot be
+// decoded into T are logged and skipped.
+func (e Typed[T]) On(api EventApi, handler func(id string, payload T), opts ...Option) Subscription {
+	return api.On(e.Type, func(id string, args ...interface{}) {
+		payload, err := e.Decode(args)
+		if err != nil {
+			log.Printf("Error decoding event payload. Got: %v\n", err)
+			return
+		}
+
+		handler(id, payload)
+	}, opts...)
+}
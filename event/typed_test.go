@@ -0,0 +1,58 @@
+package event
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testStats struct {
+	Instance string `json:"instance"`
+	Mem      uint64 `json:"mem"`
+}
+
+var testStatsEvent = Register[testStats](EventType("test stats"), 1, Single)
+
+func TestTypedArgs(t *testing.T) {
+	assert.Equal(t, []interface{}{"i1", "10.0.0.1", "node1", "proxy"}, InstanceNewEvent.Args(InstanceNew{Name: "i1", IP: "10.0.0.1", Hostname: "node1", ProxyHost: "proxy"}))
+	assert.Nil(t, SessionNewEvent.Args(Empty{}))
+	assert.Equal(t, []interface{}{testStats{Instance: "i1", Mem: 1}}, testStatsEvent.Args(testStats{Instance: "i1", Mem: 1}))
+}
+
+func TestTypedDecode(t *testing.T) {
+	resize, err := ViewportResizeEvent.Decode([]interface{}{float64(80), float64(24)})
+	assert.Nil(t, err)
+	assert.Equal(t, ViewportResize{Cols: 80, Rows: 24}, resize)
+
+	_, err = ViewportResizeEvent.Decode([]interface{}{"80", float64(24)})
+	assert.NotNil(t, err)
+
+	_, err = ViewportResizeEvent.Decode([]interface{}{float64(80)})
+	assert.NotNil(t, err)
+
+	stats, err := testStatsEvent.Decode([]interface{}{map[string]interface{}{"instance": "i1", "mem": float64(42)}})
+	assert.Nil(t, err)
+	assert.Equal(t, testStats{Instance: "i1", Mem: 42}, stats)
+
+	stats, err = testStatsEvent.Decode([]interface{}{testStats{Instance: "i2"}})
+	assert.Nil(t, err)
+	assert.Equal(t, testStats{Instance: "i2"}, stats)
+
+	assert.Panics(t, func() { Register[testStats](EventType("test stats"), 2, Single) })
+	assert.Panics(t, func() { Register[string](EventType("test string"), 1, Positional) })
+}
+
+func TestTypedOn(t *testing.T) {
+	broker := NewLocalBroker()
+
+	received := make(chan InstanceNew, 1)
+	InstanceNewEvent.On(broker, func(id string, payload InstanceNew) {
+		received <- payload
+	})
+
+	// Events with arguments that do not match the payload are skipped.
+	broker.Emit(INSTANCE_NEW, "s1", 42)
+	InstanceNewEvent.Emit(broker, "s1", InstanceNew{Name: "i1"})
+
+	assert.Equal(t, InstanceNew{Name: "i1"}, <-received)
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dimaskiddo/play-with-docker/audit"
+)
+
+// recordAudit records entry with the address of req and, unless it is already
+// set, the logged in user as the actor.
+func recordAudit(req *http.Request, entry *audit.Entry) {
+	if auditLog == nil {
+		return
+	}
+
+	ip, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		ip = req.RemoteAddr
+	}
+	entry.IP = ip
+
+	if entry.Actor == "" {
+		if cookie, err := ReadCookie(req); err == nil {
+			entry.Actor = cookie.Id
+		}
+	}
+
+	if err := auditLog.Record(entry); err != nil {
+		log.Printf("Error recording audit entry %s. Got: %v\n", entry.Action, err)
+	}
+}
+
+func ListAudit(rw http.ResponseWriter, req *http.Request) {
+	if !ValidateToken(req) {
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	if auditLog == nil {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	query := req.URL.Query()
+
+	q := audit.Query{
+		SessionId: query.Get("session_id"),
+		UserId:    query.Get("user_id"),
+	}
+
+	var err error
+
+	if from := query.Get("from"); from != "" {
+		if q.From, err = time.Parse(time.RFC3339, from); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(rw, "Invalid from. Got: %v", err)
+			return
+		}
+	}
+
+	if to := query.Get("to"); to != "" {
+		if q.To, err = time.Parse(time.RFC3339, to); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(rw, "Invalid to. Got: %v", err)
+			return
+		}
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		if q.Limit, err = strconv.Atoi(limit); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(rw, "Invalid limit. Got: %v", err)
+			return
+		}
+	}
+
+	entries, err := auditLog.Find(q)
+	if err != nil {
+		log.Printf("Error querying the audit log. Got: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(entries)
+}
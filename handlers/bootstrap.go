@@ -17,10 +17,14 @@ import (
 	"golang.org/x/crypto/acme/autocert"
 	"golang.org/x/oauth2"
 
+	"github.com/dimaskiddo/play-with-docker/audit"
 	"github.com/dimaskiddo/play-with-docker/config"
 	"github.com/dimaskiddo/play-with-docker/event"
 	"github.com/dimaskiddo/play-with-docker/pwd"
 	"github.com/dimaskiddo/play-with-docker/pwd/types"
+	"github.com/dimaskiddo/play-with-docker/scheduler"
+	"github.com/dimaskiddo/play-with-docker/scheduler/task"
+	"github.com/dimaskiddo/play-with-docker/webhook"
 	gh "github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	lru "github.com/hashicorp/golang-lru"
@@ -36,6 +40,11 @@ import (
 var (
 	core     pwd.PWDApi
 	e        event.EventApi
+	auditLog audit.AuditApi
+	webhooks *webhook.Dispatcher
+	history  *event.History
+	stats    *task.StatsHistory
+	sch      scheduler.SchedulerApi
 	landings = map[string][]byte{}
 )
 
@@ -57,19 +66,104 @@ func init() {
 	staticFiles, _ = fs.Sub(embeddedFiles, "www")
 }
 
-func Bootstrap(c pwd.PWDApi, ev event.EventApi) {
+func Bootstrap(c pwd.PWDApi, ev event.EventApi, a audit.AuditApi, w *webhook.Dispatcher, h *event.History, st *task.StatsHistory, s scheduler.SchedulerApi) {
 	core = c
 	e = ev
+	auditLog = a
+	webhooks = w
+	history = h
+	stats = st
+	sch = s
 }
 
 func Register(extend HandlerExtender) {
 	initPlaygrounds()
 
+	httpServer := http.Server{
+		Addr:              "0.0.0.0:" + config.PortNumber,
+		Handler:           newHandler(extend),
+		ReadTimeout:       15 * time.Second,
+		WriteTimeout:      15 * time.Minute,
+		IdleTimeout:       60 * time.Second,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	if config.UseLetsEncrypt {
+		domainCache, err := lru.New(5000)
+		if err != nil {
+			log.Fatalf("Could not Start Domain Cache. Got: %v", err)
+		}
+
+		certManager := autocert.Manager{
+			Prompt: autocert.AcceptTOS,
+			HostPolicy: func(ctx context.Context, host string) error {
+				if _, found := domainCache.Get(host); !found {
+					if playground := core.PlaygroundFindByDomain(host); playground == nil {
+						return fmt.Errorf("Playground for Domain %s was Not Found", host)
+					}
+					domainCache.Add(host, true)
+				}
+				return nil
+			},
+			Cache: autocert.DirCache(config.LetsEncryptCertsDir),
+		}
+
+		httpServer.TLSConfig = &tls.Config{
+			GetCertificate: certManager.GetCertificate,
+			MinVersion:     tls.VersionTLS12,
+		}
+
+		go func() {
+			rr := mux.NewRouter()
+			rr.Use(CustomMiddlewareMux)
+
+			rr.Handle("/metrics", promhttp.Handler())
+			rr.HandleFunc("/ping", Ping).Methods("GET")
+
+			rr.HandleFunc("/", func(rw http.ResponseWriter, r *http.Request) {
+				target := fmt.Sprintf("https://%s%s", r.Host, r.URL.Path)
+				if len(r.URL.RawQuery) > 0 {
+					target += "?" + r.URL.RawQuery
+				}
+
+				http.Redirect(rw, r, target, http.StatusMovedPermanently)
+			})
+
+			nr := negroni.New()
+
+			nr.Use(negroni.NewRecovery())
+			nr.Use(negroni.HandlerFunc(CustomMiddlewareNegroni))
+
+			nr.UseHandler(rr)
+
+			redirectServer := http.Server{
+				Addr:              "0.0.0.0:3001",
+				Handler:           certManager.HTTPHandler(nr),
+				ReadTimeout:       15 * time.Second,
+				WriteTimeout:      15 * time.Minute,
+				IdleTimeout:       60 * time.Second,
+				ReadHeaderTimeout: 5 * time.Second,
+			}
+
+			log.Fatal(redirectServer.ListenAndServe())
+		}()
+
+		log.Println("Listening on Port " + config.PortNumber)
+		log.Fatal(httpServer.ListenAndServeTLS("", ""))
+	} else {
+		log.Println("Listening on Port " + config.PortNumber)
+		log.Fatal(httpServer.ListenAndServe())
+	}
+}
+
+// newHandler routes the requests to the handlers of the API and the assets.
+func newHandler(extend HandlerExtender) http.Handler {
 	r := mux.NewRouter()
 	r.Use(CustomMiddlewareMux)
 
 	corsRouter := mux.NewRouter()
 	corsRouter.Use(CustomMiddlewareMux)
+	corsRouter.Use(SessionActivityMiddleware)
 
 	n := negroni.New()
 
@@ -88,13 +182,23 @@ func Register(extend HandlerExtender) {
 	r.HandleFunc("/my/playground", GetCurrentPlayground).Methods("GET")
 	r.HandleFunc("/playgrounds", NewPlayground).Methods("PUT")
 	r.HandleFunc("/playgrounds", ListPlaygrounds).Methods("GET")
+	r.HandleFunc("/audit", ListAudit).Methods("GET")
+	r.HandleFunc("/webhooks/deliveries", ListWebhookDeliveries).Methods("GET")
+	r.HandleFunc("/scheduler/sessions", ListScheduledSessions).Methods("GET")
+	r.HandleFunc("/scheduler/instances", ListScheduledInstances).Methods("GET")
+	r.HandleFunc("/scheduler/instances/{instanceName}/tasks/{task}/{action:pause|resume|run}", ControlScheduledTask).Methods("POST")
+	r.HandleFunc("/scheduler/playgrounds/update", UpdateScheduledPlaygrounds).Methods("POST")
 
 	corsRouter.HandleFunc("/", NewSession).Methods("POST")
 	corsRouter.HandleFunc("/users/me", LoggedInUser).Methods("GET")
 	corsRouter.HandleFunc("/instances/images", GetInstanceImages).Methods("GET")
 	corsRouter.HandleFunc("/sessions/{sessionId}", GetSession).Methods("GET")
 	corsRouter.HandleFunc("/sessions/{sessionId}/ws/", WSH).Methods("GET")
+	corsRouter.HandleFunc("/sessions/{sessionId}/events", SessionEvents).Methods("GET")
 	corsRouter.HandleFunc("/sessions/{sessionId}/close", CloseSession).Methods("POST")
+	corsRouter.HandleFunc("/sessions/{sessionId}/extend", ExtendSession).Methods("POST")
+	corsRouter.HandleFunc("/sessions/{sessionId}/hibernate", HibernateSession).Methods("POST")
+	corsRouter.HandleFunc("/sessions/{sessionId}/resume", ResumeSession).Methods("POST")
 	corsRouter.HandleFunc("/sessions/{sessionId}", CloseSession).Methods("DELETE")
 	corsRouter.HandleFunc("/sessions/{sessionId}/setup", SessionSetup).Methods("POST")
 	corsRouter.HandleFunc("/sessions/{sessionId}/instances", NewInstance).Methods("POST")
@@ -102,6 +206,7 @@ func Register(extend HandlerExtender) {
 	corsRouter.HandleFunc("/sessions/{sessionId}/instances/{instanceName}", DeleteInstance).Methods("DELETE")
 	corsRouter.HandleFunc("/sessions/{sessionId}/instances/{instanceName}/exec", Exec).Methods("POST")
 	corsRouter.HandleFunc("/sessions/{sessionId}/instances/{instanceName}/fstree", fsTree).Methods("GET")
+	corsRouter.HandleFunc("/sessions/{sessionId}/instances/{instanceName}/stats", GetInstanceStats).Methods("GET")
 	corsRouter.HandleFunc("/sessions/{sessionId}/instances/{instanceName}/file", file).Methods("GET")
 	corsRouter.HandleFunc("/sessions/{sessionId}/instances/{instanceName}/download-key", fileDownloadKey).Methods("GET")
 
@@ -141,81 +246,7 @@ func Register(extend HandlerExtender) {
 	r.PathPrefix("/").Handler(negroni.New(negroni.Wrap(corsHandler(corsRouter))))
 	n.UseHandler(r)
 
-	httpServer := http.Server{
-		Addr:              "0.0.0.0:" + config.PortNumber,
-		Handler:           n,
-		ReadTimeout:       15 * time.Second,
-		WriteTimeout:      15 * time.Minute,
-		IdleTimeout:       60 * time.Second,
-		ReadHeaderTimeout: 5 * time.Second,
-	}
-
-	if config.UseLetsEncrypt {
-		domainCache, err := lru.New(5000)
-		if err != nil {
-			log.Fatalf("Could not Start Domain Cache. Got: %v", err)
-		}
-
-		certManager := autocert.Manager{
-			Prompt: autocert.AcceptTOS,
-			HostPolicy: func(ctx context.Context, host string) error {
-				if _, found := domainCache.Get(host); !found {
-					if playground := core.PlaygroundFindByDomain(host); playground == nil {
-						return fmt.Errorf("Playground for Domain %s was Not Found", host)
-					}
-					domainCache.Add(host, true)
-				}
-				return nil
-			},
-			Cache: autocert.DirCache(config.LetsEncryptCertsDir),
-		}
-
-		httpServer.TLSConfig = &tls.Config{
-			GetCertificate: certManager.GetCertificate,
-			MinVersion:     tls.VersionTLS12,
-		}
-
-		go func() {
-			rr := mux.NewRouter()
-			rr.Use(CustomMiddlewareMux)
-
-			rr.Handle("/metrics", promhttp.Handler())
-			rr.HandleFunc("/ping", Ping).Methods("GET")
-
-			rr.HandleFunc("/", func(rw http.ResponseWriter, r *http.Request) {
-				target := fmt.Sprintf("https://%s%s", r.Host, r.URL.Path)
-				if len(r.URL.RawQuery) > 0 {
-					target += "?" + r.URL.RawQuery
-				}
-
-				http.Redirect(rw, r, target, http.StatusMovedPermanently)
-			})
-
-			nr := negroni.New()
-
-			nr.Use(negroni.NewRecovery())
-			nr.Use(negroni.HandlerFunc(CustomMiddlewareNegroni))
-
-			nr.UseHandler(rr)
-
-			redirectServer := http.Server{
-				Addr:              "0.0.0.0:3001",
-				Handler:           certManager.HTTPHandler(nr),
-				ReadTimeout:       15 * time.Second,
-				WriteTimeout:      15 * time.Minute,
-				IdleTimeout:       60 * time.Second,
-				ReadHeaderTimeout: 5 * time.Second,
-			}
-
-			log.Fatal(redirectServer.ListenAndServe())
-		}()
-
-		log.Println("Listening on Port " + config.PortNumber)
-		log.Fatal(httpServer.ListenAndServeTLS("", ""))
-	} else {
-		log.Println("Listening on Port " + config.PortNumber)
-		log.Fatal(httpServer.ListenAndServe())
-	}
+	return n
 }
 
 func serveAsset(w http.ResponseWriter, r *http.Request, name string) {
@@ -4,7 +4,10 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/dimaskiddo/play-with-docker/audit"
 	"github.com/gorilla/mux"
 )
 
@@ -41,6 +44,15 @@ func Exec(rw http.ResponseWriter, req *http.Request) {
 
 	code, err := core.InstanceExec(i, er.Cmd)
 
+	recordAudit(req, &audit.Entry{
+		Action:       audit.INSTANCE_EXEC,
+		UserId:       s.UserId,
+		PlaygroundId: s.PlaygroundId,
+		SessionId:    s.Id,
+		Instance:     i.Name,
+		Details:      map[string]string{"command": strings.Join(er.Cmd, " "), "status_code": strconv.Itoa(code)},
+	})
+
 	if err != nil {
 		log.Println(err)
 		rw.WriteHeader(http.StatusInternalServerError)
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"path/filepath"
 
+	"github.com/dimaskiddo/play-with-docker/audit"
 	"github.com/dimaskiddo/play-with-docker/storage"
 	"github.com/gorilla/mux"
 )
@@ -32,6 +33,16 @@ func FileUpload(rw http.ResponseWriter, req *http.Request) {
 		_, fileName := filepath.Split(url)
 
 		err := core.InstanceUploadFromUrl(i, fileName, path, req.URL.Query().Get("url"))
+
+		recordAudit(req, &audit.Entry{
+			Action:       audit.INSTANCE_UPLOAD,
+			UserId:       s.UserId,
+			PlaygroundId: s.PlaygroundId,
+			SessionId:    s.Id,
+			Instance:     i.Name,
+			Details:      map[string]string{"url": url, "path": path},
+		})
+
 		if err != nil {
 			log.Println(err)
 			rw.WriteHeader(http.StatusInternalServerError)
@@ -63,6 +74,16 @@ func FileUpload(rw http.ResponseWriter, req *http.Request) {
 			}
 
 			err = core.InstanceUploadFromReader(i, p.FileName(), path, p)
+
+			recordAudit(req, &audit.Entry{
+				Action:       audit.INSTANCE_UPLOAD,
+				UserId:       s.UserId,
+				PlaygroundId: s.PlaygroundId,
+				SessionId:    s.Id,
+				Instance:     i.Name,
+				Details:      map[string]string{"file": p.FileName(), "path": path},
+			})
+
 			if err != nil {
 				log.Println(err)
 				rw.WriteHeader(http.StatusInternalServerError)
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func GetInstanceStats(rw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	sessionId := vars["sessionId"]
+	instanceName := vars["instanceName"]
+
+	var since time.Time
+	if v := req.URL.Query().Get("since"); v != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, v); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(rw, "Invalid since %s", v)
+			return
+		}
+	}
+
+	s, _ := core.SessionGet(sessionId)
+	if s == nil {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	i := core.InstanceGet(s, instanceName)
+	if i == nil {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(stats.Since(s.Id, i.Name, since))
+}
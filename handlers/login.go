@@ -10,6 +10,7 @@ import (
 
 	"golang.org/x/oauth2"
 
+	"github.com/dimaskiddo/play-with-docker/audit"
 	"github.com/dimaskiddo/play-with-docker/config"
 	"github.com/dimaskiddo/play-with-docker/pwd/types"
 	"github.com/google/go-github/github"
@@ -263,6 +264,14 @@ func LoginCallback(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	recordAudit(req, &audit.Entry{
+		Action:       audit.USER_LOGIN,
+		Actor:        user.Id,
+		UserId:       user.Id,
+		PlaygroundId: playground.Id,
+		Details:      map[string]string{"provider": providerName},
+	})
+
 	cookieData := CookieID{Id: user.Id, UserName: user.Name, UserAvatar: user.Avatar, ProviderId: user.ProviderUserId}
 
 	host := "localhost"
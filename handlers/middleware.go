@@ -5,16 +5,36 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"regexp"
 	"strings"
 	"time"
 
 	"github.com/NYTimes/gziphandler"
 	"github.com/dimaskiddo/play-with-docker/config"
+	"github.com/gorilla/mux"
 	"github.com/urfave/negroni"
 )
 
 var gzipHandler, _ = gziphandler.NewGzipLevelHandler(gzip.BestSpeed)
 
+var sessionEventsPath = regexp.MustCompile(`^/sessions/[^/]+/events$`)
+
+// withGzip compresses the responses, except the session event streams that
+// have to reach the clients as they are written, as the gzip handler holds
+// back anything smaller than its minimum size.
+func withGzip(next http.Handler) http.Handler {
+	compressed := gzipHandler(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if sessionEventsPath.MatchString(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		compressed.ServeHTTP(w, r)
+	})
+}
+
 func headerRealIP(r *http.Request) {
 	_, port, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
@@ -131,7 +151,19 @@ func CustomMiddlewareMux(next http.Handler) http.Handler {
 			return
 		}
 
-		gzipHandler(next).ServeHTTP(w, r)
+		withGzip(next).ServeHTTP(w, r)
+	})
+}
+
+// SessionActivityMiddleware records the requests to the API of a session as
+// client activity.
+func SessionActivityMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if sessionId := mux.Vars(r)["sessionId"]; sessionId != "" {
+			core.SessionTouch(sessionId)
+		}
+
+		next.ServeHTTP(w, r)
 	})
 }
 
@@ -146,7 +178,7 @@ func CustomMiddlewareNegroni(w http.ResponseWriter, r *http.Request, next http.H
 		return
 	}
 
-	gzipHandler(http.HandlerFunc(func(rw http.ResponseWriter, rq *http.Request) {
+	withGzip(http.HandlerFunc(func(rw http.ResponseWriter, rq *http.Request) {
 		nw := negroni.NewResponseWriter(rw)
 		next(nw, rq)
 
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/dimaskiddo/play-with-docker/audit"
 	"github.com/dimaskiddo/play-with-docker/config"
 	"github.com/dimaskiddo/play-with-docker/pwd/types"
 )
@@ -33,6 +34,13 @@ func NewPlayground(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	recordAudit(req, &audit.Entry{
+		Action:       audit.PLAYGROUND_PUT,
+		Actor:        audit.ADMIN,
+		PlaygroundId: newPlayground.Id,
+		Details:      map[string]string{"domain": newPlayground.Domain},
+	})
+
 	rw.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(rw).Encode(newPlayground)
 }
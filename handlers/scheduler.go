@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/dimaskiddo/play-with-docker/audit"
+	"github.com/dimaskiddo/play-with-docker/scheduler"
+	"github.com/gorilla/mux"
+)
+
+// Only the leader schedules anything, the lists of the other replicas are
+// empty.
+type scheduledSessions struct {
+	Leading  bool                         `json:"leading"`
+	Sessions []scheduler.ScheduledSession `json:"sessions"`
+}
+
+type scheduledInstances struct {
+	Leading   bool                          `json:"leading"`
+	Instances []scheduler.ScheduledInstance `json:"instances"`
+}
+
+func validateScheduler(rw http.ResponseWriter, req *http.Request) bool {
+	if !ValidateToken(req) {
+		rw.WriteHeader(http.StatusForbidden)
+		return false
+	}
+
+	if sch == nil {
+		rw.WriteHeader(http.StatusNotFound)
+		return false
+	}
+
+	return true
+}
+
+func ListScheduledSessions(rw http.ResponseWriter, req *http.Request) {
+	if !validateScheduler(rw, req) {
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(scheduledSessions{Leading: sch.Leading(), Sessions: sch.Sessions()})
+}
+
+func ListScheduledInstances(rw http.ResponseWriter, req *http.Request) {
+	if !validateScheduler(rw, req) {
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(scheduledInstances{Leading: sch.Leading(), Instances: sch.Instances()})
+}
+
+func ControlScheduledTask(rw http.ResponseWriter, req *http.Request) {
+	if !validateScheduler(rw, req) {
+		return
+	}
+
+	vars := mux.Vars(req)
+	instanceName := vars["instanceName"]
+	task := vars["task"]
+	action := vars["action"]
+
+	var err error
+	switch action {
+	case "pause":
+		err = sch.PauseTask(instanceName, task)
+	case "resume":
+		err = sch.ResumeTask(instanceName, task)
+	case "run":
+		err = sch.RunTask(instanceName, task)
+	}
+
+	if scheduler.NotFound(err) {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error on %s of task %s of instance %s. Got: %v\n", action, task, instanceName, err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(req, &audit.Entry{
+		Action:   audit.SCHEDULER_TASK,
+		Actor:    audit.ADMIN,
+		Instance: instanceName,
+		Details:  map[string]string{"task": task, "action": action},
+	})
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func UpdateScheduledPlaygrounds(rw http.ResponseWriter, req *http.Request) {
+	if !validateScheduler(rw, req) {
+		return
+	}
+
+	sch.UpdatePlaygrounds()
+
+	rw.WriteHeader(http.StatusNoContent)
+}
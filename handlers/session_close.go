@@ -4,6 +4,7 @@ import (
 	"log"
 	"net/http"
 
+	"github.com/dimaskiddo/play-with-docker/audit"
 	"github.com/dimaskiddo/play-with-docker/storage"
 	"github.com/gorilla/mux"
 )
@@ -21,6 +22,13 @@ func CloseSession(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	recordAudit(req, &audit.Entry{
+		Action:       audit.SESSION_CLOSE,
+		UserId:       session.UserId,
+		PlaygroundId: session.PlaygroundId,
+		SessionId:    session.Id,
+	})
+
 	if err := core.SessionClose(session); err != nil {
 		log.Println(err)
 		rw.WriteHeader(http.StatusInternalServerError)
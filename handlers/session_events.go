@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dimaskiddo/play-with-docker/event"
+	"github.com/gorilla/mux"
+)
+
+// Interval of the comments sent to keep idle event streams open.
+const sessionEventsKeepAlive = 15 * time.Second
+
+func writeSessionEvent(rw http.ResponseWriter, r event.Record) error {
+	args := r.Args
+	if args == nil {
+		args = []interface{}{}
+	}
+
+	data, err := json.Marshal(args)
+	if err != nil {
+		log.Printf("Cannot marshal event to json. Got: %v\n", err)
+		return nil
+	}
+
+	_, err = fmt.Fprintf(rw, "id: %d\nevent: %s\ndata: %s\n\n", r.Id, r.Name, data)
+	return err
+}
+
+// SessionEvents streams the events of a session as Server-Sent Events, with
+// the arguments of each event as a JSON array. Clients sending the
+// Last-Event-ID header first get the events they missed that are still in
+// the history.
+func SessionEvents(rw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	sessionId := vars["sessionId"]
+
+	if _, err := core.SessionGet(sessionId); err != nil {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	flusher, ok := rw.(http.Flusher)
+	if !ok || history == nil {
+		rw.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	var after uint64
+	if id := req.Header.Get("Last-Event-ID"); id != "" {
+		after, _ = strconv.ParseUint(id, 10, 64)
+	}
+
+	missed, records, sub := history.Watch(sessionId, after)
+	defer sub.Unsubscribe()
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("X-Accel-Buffering", "no")
+	rw.WriteHeader(http.StatusOK)
+
+	for _, r := range missed {
+		if err := writeSessionEvent(rw, r); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(sessionEventsKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case r, ok := <-records:
+			if !ok {
+				return
+			}
+
+			if err := writeSessionEvent(rw, r); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprint(rw, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-req.Context().Done():
+			return
+		}
+
+		flusher.Flush()
+	}
+}
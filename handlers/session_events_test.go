@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dimaskiddo/play-with-docker/config"
+	"github.com/dimaskiddo/play-with-docker/event"
+	"github.com/dimaskiddo/play-with-docker/pwd"
+	"github.com/dimaskiddo/play-with-docker/pwd/types"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+func TestSessionEventsStreamsThroughRouter(t *testing.T) {
+	_p := &pwd.Mock{}
+	_p.On("SessionGet", "s1").Return(&types.Session{Id: "s1"}, nil)
+	_p.On("SessionTouch", "s1").Return()
+
+	config.RateLimiter = rate.NewLimiter(rate.Inf, 1)
+
+	broker := event.NewLocalBroker()
+	core = _p
+	history = event.NewHistory(broker, 10, time.Minute)
+
+	server := httptest.NewServer(newHandler(nil))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", server.URL+"/sessions/s1/events", nil)
+	assert.Nil(t, err)
+	// Clients send it, the stream must not be held back to be compressed.
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	resp, err := http.DefaultClient.Do(req)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "", resp.Header.Get("Content-Encoding"))
+
+	broker.Emit(event.SESSION_READY, "s1", true)
+
+	lines := make(chan string)
+	go func() {
+		r := bufio.NewReader(resp.Body)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				close(lines)
+				return
+			}
+			lines <- strings.TrimSpace(line)
+		}
+	}()
+
+	expected := []string{"id: 1", "event: session ready", "data: [true]"}
+	for _, e := range expected {
+		select {
+		case line := <-lines:
+			assert.Equal(t, e, line)
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for %q", e)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dimaskiddo/play-with-docker/audit"
+	"github.com/dimaskiddo/play-with-docker/pwd"
+	"github.com/dimaskiddo/play-with-docker/storage"
+	"github.com/gorilla/mux"
+)
+
+type extendSessionRequest struct {
+	// Duration to add, such as 30m. The default session duration of the
+	// playground when empty.
+	Duration string `json:"duration"`
+}
+
+func ExtendSession(rw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	sessionId := vars["sessionId"]
+
+	body := extendSessionRequest{}
+	if req.ContentLength != 0 {
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(rw, "Invalid body. Got: %v", err)
+			return
+		}
+	}
+
+	var by time.Duration
+	if body.Duration != "" {
+		var err error
+		if by, err = time.ParseDuration(body.Duration); err != nil || by <= 0 {
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(rw, "Invalid duration %s", body.Duration)
+			return
+		}
+	}
+
+	session, err := core.SessionGet(sessionId)
+	if err == storage.NotFoundError {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err := core.SessionExtend(session, by); pwd.SessionExtensionDenied(err) {
+		rw.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(rw, err.Error())
+		return
+	} else if err != nil {
+		log.Printf("Error extending session %s. Got: %v\n", sessionId, err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(req, &audit.Entry{
+		Action:       audit.SESSION_EXTEND,
+		UserId:       session.UserId,
+		PlaygroundId: session.PlaygroundId,
+		SessionId:    session.Id,
+		Details:      map[string]string{"expires_at": session.ExpiresAt.Format(time.RFC3339)},
+	})
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(session)
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dimaskiddo/play-with-docker/audit"
+	"github.com/dimaskiddo/play-with-docker/pwd/types"
+	"github.com/dimaskiddo/play-with-docker/storage"
+	"github.com/gorilla/mux"
+)
+
+func HibernateSession(rw http.ResponseWriter, req *http.Request) {
+	session := getSessionForHibernation(rw, req)
+	if session == nil {
+		return
+	}
+
+	if err := core.SessionHibernate(session); err != nil {
+		log.Printf("Error hibernating session %s. Got: %v\n", session.Id, err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(req, &audit.Entry{
+		Action:       audit.SESSION_HIBERNATE,
+		UserId:       session.UserId,
+		PlaygroundId: session.PlaygroundId,
+		SessionId:    session.Id,
+	})
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(session)
+}
+
+func ResumeSession(rw http.ResponseWriter, req *http.Request) {
+	session := getSessionForHibernation(rw, req)
+	if session == nil {
+		return
+	}
+
+	hibernated := session.Hibernated
+	if err := core.SessionResume(session); err != nil {
+		log.Printf("Error resuming session %s. Got: %v\n", session.Id, err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if hibernated {
+		recordAudit(req, &audit.Entry{
+			Action:       audit.SESSION_RESUME,
+			UserId:       session.UserId,
+			PlaygroundId: session.PlaygroundId,
+			SessionId:    session.Id,
+			Details:      map[string]string{"expires_at": session.ExpiresAt.Format(time.RFC3339)},
+		})
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(session)
+}
+
+func getSessionForHibernation(rw http.ResponseWriter, req *http.Request) *types.Session {
+	vars := mux.Vars(req)
+	sessionId := vars["sessionId"]
+
+	session, err := core.SessionGet(sessionId)
+	if err == storage.NotFoundError {
+		rw.WriteHeader(http.StatusNotFound)
+		return nil
+	} else if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return nil
+	}
+
+	return session
+}
@@ -69,6 +69,7 @@ type manager struct {
 	terminals map[string]*terminal
 	errorCh   chan *types.Instance
 	instances map[string]*types.Instance
+	subs      []event.Subscription
 	sync.Mutex
 }
 
@@ -185,6 +186,10 @@ func (m *manager) process() {
 	}
 }
 func (m *manager) Close() {
+	for _, sub := range m.subs {
+		sub.Unsubscribe()
+	}
+
 	for _, i := range m.instances {
 		m.disconnect(i)
 	}
@@ -217,12 +222,14 @@ func NewManager(s *types.Session) (*manager, error) {
 		instances: make(map[string]*types.Instance),
 	}
 
-	e.On(event.INSTANCE_NEW, func(sessionId string, args ...interface{}) {
+	// Instances are never dropped, the manager would not know about them
+	// until the session is opened again.
+	newSub := event.InstanceNewEvent.On(e, func(sessionId string, payload event.InstanceNew) {
 		if sessionId != s.Id {
 			return
 		}
 
-		instanceName := args[0].(string)
+		instanceName := payload.Name
 		instance := core.InstanceGet(s, instanceName)
 		if instance == nil {
 			log.Printf("Instance [%s] was not found in session [%s]\n", instanceName, sessionId)
@@ -231,18 +238,19 @@ func NewManager(s *types.Session) (*manager, error) {
 
 		m.trackInstance(instance)
 		m.connect(instance)
-	})
+	}, event.WithQueuePolicy(event.Block))
 
-	e.On(event.INSTANCE_DELETE, func(sessionId string, args ...interface{}) {
+	deleteSub := event.InstanceDeleteEvent.On(e, func(sessionId string, payload event.InstanceDelete) {
 		if sessionId != s.Id {
 			return
 		}
 
-		instanceName := args[0].(string)
-		instance := &types.Instance{Name: instanceName}
+		instance := &types.Instance{Name: payload.Name}
 
 		m.disconnect(instance)
-	})
+	}, event.WithQueuePolicy(event.Block))
+
+	m.subs = []event.Subscription{newSub, deleteSub}
 
 	return m, nil
 }
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dimaskiddo/play-with-docker/webhook"
+)
+
+type webhookDeliveries struct {
+	Recent      []webhook.Delivery `json:"recent"`
+	DeadLetters []webhook.Delivery `json:"dead_letters"`
+}
+
+func ListWebhookDeliveries(rw http.ResponseWriter, req *http.Request) {
+	if !ValidateToken(req) {
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	if webhooks == nil {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	playgroundId := req.URL.Query().Get("playground_id")
+
+	filter := func(deliveries []webhook.Delivery) []webhook.Delivery {
+		r := []webhook.Delivery{}
+		for _, d := range deliveries {
+			if playgroundId == "" || d.PlaygroundId == playgroundId {
+				r = append(r, d)
+			}
+		}
+		return r
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(webhookDeliveries{
+		Recent:      filter(webhooks.Recent()),
+		DeadLetters: filter(webhooks.DeadLetters()),
+	})
+}
@@ -8,13 +8,29 @@ import (
 	"sync"
 	"time"
 
+	"github.com/dimaskiddo/play-with-docker/config"
 	"github.com/dimaskiddo/play-with-docker/event"
+	"github.com/dimaskiddo/play-with-docker/scheduler/task"
 	"github.com/dimaskiddo/play-with-docker/storage"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 	uuid "github.com/satori/go.uuid"
 )
 
+// periodicEvents are emitted by the scheduler tasks on every run.
+var periodicEvents = map[event.EventType]bool{
+	task.CollectStatsEvent:               true,
+	task.CheckPortsEvent:                 true,
+	task.CheckSwarmPortsEvent:            true,
+	task.CheckSwarmStatusEvent:           true,
+	task.CheckK8sClusterExpoedPortsEvent: true,
+	task.CheckK8sStatusEvent:             true,
+}
+
+// writeWait is how long a write to the browser can take before the socket is
+// closed, so a browser that stopped reading does not hold back its events.
+var writeWait = 10 * time.Second
+
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool { return true },
 }
@@ -58,12 +74,29 @@ func (s *socket) Ping() error {
 		return fmt.Errorf("socket closed")
 	}
 
+	s.c.SetWriteDeadline(time.Now().Add(writeWait))
 	return s.c.WriteMessage(websocket.PingMessage, nil)
 }
 
 func (s *socket) Close() {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.close()
+}
+
+// close closes the connection and calls the close listeners once. It expects
+// s.mx to be held.
+func (s *socket) close() {
+	if s.closed {
+		return
+	}
 	s.closed = true
-	s.onMessage(message{Name: "close"})
+	s.c.Close()
+
+	for _, cb := range s.listeners["close"] {
+		go cb()
+	}
 }
 
 func (s *socket) process() {
@@ -121,9 +154,10 @@ func (s *socket) Emit(ev string, args ...interface{}) {
 		return
 	}
 
+	s.c.SetWriteDeadline(time.Now().Add(writeWait))
 	if err := s.c.WriteMessage(websocket.TextMessage, b); err != nil {
 		log.Printf("Cannot write event to websocket connection. Got: %v\n", err)
-		s.Close()
+		s.close()
 		return
 	}
 }
@@ -196,11 +230,35 @@ func ws(so *socket) {
 		return
 	}
 
+	if session.Hibernated {
+		if err := core.SessionResume(session); err != nil {
+			log.Printf("Error resuming session %s. Got: %v\n", session.Id, err)
+		}
+	}
+
+	core.SessionTouch(session.Id)
+
 	client := core.ClientNew(so.Id(), session)
 	if client == nil {
 		log.Printf("ERROR: Client was not created for session id %s and socket id %s\n", session.Id, so.Id())
 	}
 
+	// Keep the client from expiring for as long as its socket is alive
+	if interval := config.ClientTTL / 4; interval > 0 {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				if so.closed {
+					return
+				}
+
+				core.ClientKeepAlive(client)
+			}
+		}()
+	}
+
 	m, err := NewManager(session)
 	if err != nil {
 		log.Printf("Error creating terminal manager. Got: %v", err)
@@ -218,39 +276,63 @@ func ws(so *socket) {
 	err = m.Start()
 	if err != nil {
 		log.Println(err)
+		m.Close()
 		return
 	}
 
+	// Events are dropped rather than holding back the scheduler when the
+	// browser is slow. The stats and ports are sent again by the next run of
+	// their task, the other events are sent once only, so the socket is
+	// closed when one of them is dropped and the browser loads the session
+	// again when it reconnects.
+	periodicSub := e.OnAny(func(eventType event.EventType, sessionId string, args ...interface{}) {
+		if session.Id == sessionId && periodicEvents[eventType] {
+			so.Emit(eventType.String(), args...)
+		}
+	}, event.WithQueuePolicy(event.Drop))
+	sub := e.OnAny(func(eventType event.EventType, sessionId string, args ...interface{}) {
+		if session.Id == sessionId && !periodicEvents[eventType] {
+			so.Emit(eventType.String(), args...)
+		}
+	}, event.WithQueuePolicy(event.Drop), event.OnDrop(func(eventType event.EventType, sessionId string) {
+		if session.Id == sessionId && !periodicEvents[eventType] {
+			log.Printf("Closing socket %s of session %s, which fell behind on its events\n", so.Id(), sessionId)
+			go so.Close()
+		}
+	}))
+
 	so.On("session close", func(args ...interface{}) {
 		m.Close()
 		core.SessionClose(session)
 	})
 
 	so.On("instance terminal in", func(args ...interface{}) {
-		if len(args) == 2 && args[0] != nil && args[1] != nil {
-			name := args[0].(string)
-			data := args[1].(string)
+		if len(args) != 2 {
+			return
+		}
+
+		name, nameOk := args[0].(string)
+		data, dataOk := args[1].(string)
+		if nameOk && dataOk {
+			core.SessionTouch(session.Id)
 			m.Send(name, []byte(data))
 		}
 	})
 
 	so.On("instance viewport resize", func(args ...interface{}) {
-		if len(args) == 2 && args[0] != nil && args[1] != nil {
-			cols := args[0].(float64)
-			rows := args[1].(float64)
-
-			core.ClientResizeViewPort(client, uint(cols), uint(rows))
+		vp, err := event.ViewportResizeEvent.Decode(args)
+		if err != nil {
+			log.Printf("Invalid viewport resize from client %s. Got: %v\n", so.Id(), err)
+			return
 		}
+
+		core.ClientResizeViewPort(client, vp.Cols, vp.Rows)
 	})
 
 	so.On("close", func(args ...interface{}) {
+		periodicSub.Unsubscribe()
+		sub.Unsubscribe()
 		m.Close()
 		core.ClientClose(client)
 	})
-
-	e.OnAny(func(eventType event.EventType, sessionId string, args ...interface{}) {
-		if session.Id == sessionId {
-			so.Emit(eventType.String(), args...)
-		}
-	})
 }
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSocketEmitClosesOnWriteError(t *testing.T) {
+	sockets := make(chan *socket, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		sockets <- newSocket(r, c)
+	}))
+	defer server.Close()
+
+	c, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer c.Close()
+
+	s := <-sockets
+	closed := make(chan struct{}, 2)
+	s.On("close", func(args ...interface{}) {
+		closed <- struct{}{}
+	})
+
+	// The write fails, the socket is closed without waiting for its own lock.
+	s.c.Close()
+	done := make(chan struct{})
+	go func() {
+		s.Emit("instance new", "node1")
+		s.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Emit did not return")
+	}
+
+	<-closed
+	assert.True(t, s.closed)
+	assert.Len(t, closed, 0)
+}
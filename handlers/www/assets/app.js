@@ -331,7 +331,15 @@
               socket.send(JSON.stringify({ name: name, args: args }));
             }
 
+            var opened = false;
             socket.addEventListener('open', function (event) {
+              // The server closes the socket when it falls behind on the
+              // events, so the instances are loaded again on reconnect.
+              if (opened) {
+                $scope.syncInstances();
+              }
+              opened = true;
+
               $scope.connected = true;
               for (var i in $rootScope.instances) {
                 var instance = $rootScope.instances[i];
@@ -485,7 +493,7 @@
               $scope.$apply();
             });
 
-            socket.on('instance docker swarm ports', function (status) {
+            var clusterPorts = function (status) {
               for (var i in status.instances) {
                 var instance = status.instances[i];
                 if ($scope.idxByHostname[instance]) {
@@ -494,7 +502,10 @@
               }
 
               $scope.$apply();
-            });
+            };
+
+            socket.on('instance docker swarm ports', clusterPorts);
+            socket.on('instance k8s cluster ports', clusterPorts);
 
             $scope.socket = socket;
 
@@ -558,6 +569,28 @@
           instance.term.focus();
         }
 
+        $scope.syncInstances = function () {
+          $http({
+            method: 'GET',
+            url: '/sessions/' + $scope.sessionId,
+          }).then(function (response) {
+            var names = {};
+            for (var k in response.data.instances) {
+              var instance = response.data.instances[k];
+              names[instance.name] = true;
+              if (!$scope.idx[instance.name]) {
+                $scope.upsertInstance(instance);
+              }
+            }
+
+            for (var name in $scope.idx) {
+              if (!names[name]) {
+                $scope.removeInstance(name);
+              }
+            }
+          });
+        }
+
         $scope.removeInstance = function (name) {
           if ($scope.idx[name]) {
             var handler = $scope.idx[name].terminalBufferInterval;
@@ -173,6 +173,34 @@ func (d *DinD) InstanceDelete(session *types.Session, instance *types.Instance)
 	return nil
 }
 
+func (d *DinD) InstancePause(session *types.Session, instance *types.Instance) error {
+	dockerClient, err := d.factory.GetForSession(session)
+	if err != nil {
+		return err
+	}
+
+	err = dockerClient.ContainerPause(instance.Name)
+	if err != nil && strings.Contains(err.Error(), "is already paused") {
+		return nil
+	}
+
+	return err
+}
+
+func (d *DinD) InstanceUnpause(session *types.Session, instance *types.Instance) error {
+	dockerClient, err := d.factory.GetForSession(session)
+	if err != nil {
+		return err
+	}
+
+	err = dockerClient.ContainerUnpause(instance.Name)
+	if err != nil && strings.Contains(err.Error(), "is not paused") {
+		return nil
+	}
+
+	return err
+}
+
 func (d *DinD) InstanceExec(instance *types.Instance, cmd []string) (int, error) {
 	session, err := d.getSession(instance.SessionId)
 	if err != nil {
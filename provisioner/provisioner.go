@@ -15,9 +15,17 @@ func OutOfCapacity(e error) bool {
 	return e == OutOfCapacityError
 }
 
+var PauseNotSupportedError = errors.New("PauseNotSupported")
+
+func PauseNotSupported(e error) bool {
+	return e == PauseNotSupportedError
+}
+
 type InstanceProvisionerApi interface {
 	InstanceNew(session *types.Session, conf types.InstanceConfig) (*types.Instance, error)
 	InstanceDelete(session *types.Session, instance *types.Instance) error
+	InstancePause(session *types.Session, instance *types.Instance) error
+	InstanceUnpause(session *types.Session, instance *types.Instance) error
 	InstanceExec(instance *types.Instance, cmd []string) (int, error)
 	InstanceExecAttach(instance *types.Instance, cmd []string, out io.Writer) (int, error)
 	InstanceFSTree(instance *types.Instance) (io.Reader, error)
@@ -121,6 +121,15 @@ func (d *windows) InstanceDelete(session *types.Session, instance *types.Instanc
 	return d.releaseInstance(instance.WindowsId)
 }
 
+// Windows instances keep running while their session is hibernated.
+func (d *windows) InstancePause(session *types.Session, instance *types.Instance) error {
+	return PauseNotSupportedError
+}
+
+func (d *windows) InstanceUnpause(session *types.Session, instance *types.Instance) error {
+	return PauseNotSupportedError
+}
+
 type execRes struct {
 	ExitCode int    `json:"exit_code"`
 	Error    string `json:"error"`
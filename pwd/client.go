@@ -4,6 +4,7 @@ import (
 	"log"
 	"time"
 
+	"github.com/dimaskiddo/play-with-docker/config"
 	"github.com/dimaskiddo/play-with-docker/event"
 	"github.com/dimaskiddo/play-with-docker/pwd/types"
 )
@@ -11,21 +12,58 @@ import (
 func (p *pwd) ClientNew(id string, session *types.Session) *types.Client {
 	defer observeAction("ClientNew", time.Now())
 
+	// Clients never expire without a TTL.
 	c := &types.Client{Id: id, SessionId: session.Id}
-	if err := p.storage.ClientPut(c); err != nil {
+	if config.ClientTTL > 0 {
+		c.ExpiresAt = time.Now().Add(config.ClientTTL)
+	}
+
+	if err := p.clientPut(c); err != nil {
 		log.Println("Error saving client", err)
 	}
 
+	p.setGauges()
+
 	return c
 }
 
+// clientPut saves a copy of c, as the file storage keeps the records it is
+// given while the caller keeps changing c.
+func (p *pwd) clientPut(c *types.Client) error {
+	stored := *c
+	return p.storage.ClientPut(&stored)
+}
+
+func (p *pwd) ClientKeepAlive(c *types.Client) {
+	if config.ClientTTL <= 0 {
+		return
+	}
+
+	p.clientsMx.Lock()
+	defer p.clientsMx.Unlock()
+
+	// Only touch the storage once half of the TTL has gone by.
+	if time.Until(c.ExpiresAt) > config.ClientTTL/2 {
+		return
+	}
+
+	c.ExpiresAt = time.Now().Add(config.ClientTTL)
+
+	if err := p.clientPut(c); err != nil {
+		log.Println("Error saving client", err)
+	}
+}
+
 func (p *pwd) ClientResizeViewPort(c *types.Client, cols, rows uint) {
 	defer observeAction("ClientResizeViewPort", time.Now())
 
+	p.clientsMx.Lock()
 	c.ViewPort.Rows = rows
 	c.ViewPort.Cols = cols
+	err := p.clientPut(c)
+	p.clientsMx.Unlock()
 
-	if err := p.storage.ClientPut(c); err != nil {
+	if err != nil {
 		log.Println("Error saving client", err)
 		return
 	}
@@ -41,6 +79,8 @@ func (p *pwd) ClientClose(client *types.Client) {
 		return
 	}
 
+	p.SessionTouch(client.SessionId)
+	p.setGauges()
 	p.notifyClientSmallestViewPort(client.SessionId)
 }
 
@@ -72,5 +112,5 @@ func (p *pwd) notifyClientSmallestViewPort(sessionId string) {
 		}
 	}
 
-	p.event.Emit(event.INSTANCE_VIEWPORT_RESIZE, sessionId, vp.Cols, vp.Rows)
+	event.ViewportResizeEvent.Emit(p.event, sessionId, event.ViewportResize{Cols: vp.Cols, Rows: vp.Rows})
 }
@@ -31,7 +31,7 @@ func TestClientNew(t *testing.T) {
 	_f.On("GetForSession", mock.AnythingOfType("*types.Session")).Return(_d, nil)
 	_d.On("NetworkCreate", "aaaabbbbcccc", dtypes.NetworkCreate{Attachable: true, Driver: "overlay"}).Return(nil)
 	_d.On("DaemonHost").Return("localhost")
-	_d.On("NetworkConnect", config.L2ContainerName, "aaaabbbbcccc", "").Return("10.0.0.1", nil)
+	_d.On("NetworkConnect", config.L2ContainerName, "aaaabbbbcccc", "", []string(nil)).Return("10.0.0.1", nil)
 	_s.On("SessionPut", mock.AnythingOfType("*types.Session")).Return(nil)
 	_s.On("SessionCount").Return(1, nil)
 	_s.On("InstanceCount").Return(0, nil)
@@ -52,7 +52,8 @@ func TestClientNew(t *testing.T) {
 
 	client := p.ClientNew("foobar", session)
 
-	assert.Equal(t, types.Client{Id: "foobar", SessionId: session.Id, ViewPort: types.ViewPort{Cols: 0, Rows: 0}}, *client)
+	assert.Equal(t, types.Client{Id: "foobar", SessionId: session.Id, ViewPort: types.ViewPort{Cols: 0, Rows: 0}, ExpiresAt: client.ExpiresAt}, *client)
+	assert.False(t, client.ExpiresAt.IsZero())
 
 	_d.AssertExpectations(t)
 	_f.AssertExpectations(t)
@@ -74,7 +75,7 @@ func TestClientCount(t *testing.T) {
 	_f.On("GetForSession", mock.AnythingOfType("*types.Session")).Return(_d, nil)
 	_d.On("NetworkCreate", "aaaabbbbcccc", dtypes.NetworkCreate{Attachable: true, Driver: "overlay"}).Return(nil)
 	_d.On("DaemonHost").Return("localhost")
-	_d.On("NetworkConnect", config.L2ContainerName, "aaaabbbbcccc", "").Return("10.0.0.1", nil)
+	_d.On("NetworkConnect", config.L2ContainerName, "aaaabbbbcccc", "", []string(nil)).Return("10.0.0.1", nil)
 	_s.On("SessionPut", mock.AnythingOfType("*types.Session")).Return(nil)
 	_s.On("ClientPut", mock.AnythingOfType("*types.Client")).Return(nil)
 	_s.On("ClientCount").Return(1, nil)
@@ -115,7 +116,7 @@ func TestClientResizeViewPort(t *testing.T) {
 	_f.On("GetForSession", mock.AnythingOfType("*types.Session")).Return(_d, nil)
 	_d.On("NetworkCreate", "aaaabbbbcccc", dtypes.NetworkCreate{Attachable: true, Driver: "overlay"}).Return(nil)
 	_d.On("DaemonHost").Return("localhost")
-	_d.On("NetworkConnect", config.L2ContainerName, "aaaabbbbcccc", "").Return("10.0.0.1", nil)
+	_d.On("NetworkConnect", config.L2ContainerName, "aaaabbbbcccc", "", []string(nil)).Return("10.0.0.1", nil)
 	_s.On("SessionPut", mock.AnythingOfType("*types.Session")).Return(nil)
 	_s.On("SessionCount").Return(1, nil)
 	_s.On("InstanceCount").Return(0, nil)
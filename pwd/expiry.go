@@ -0,0 +1,63 @@
+package pwd
+
+import (
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var expiredCounterVec = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "pwd_expired_total",
+	Help: "Records purged from the storage because they expired",
+}, []string{"kind"})
+
+func init() {
+	prometheus.MustRegister(expiredCounterVec)
+}
+
+// StartExpirySweeper purges expired login requests and clients from the
+// storage every interval until the returned function is called. Nothing is
+// purged if interval is not positive.
+func (p *pwd) StartExpirySweeper(interval time.Duration) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				p.sweepExpired(time.Now())
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
+
+func (p *pwd) sweepExpired(now time.Time) {
+	defer observeAction("SweepExpired", time.Now())
+
+	if n, err := p.storage.LoginRequestDeleteExpired(now); err != nil {
+		log.Println("Error purging expired login requests", err)
+	} else {
+		expiredCounterVec.WithLabelValues("login_request").Add(float64(n))
+	}
+
+	if n, err := p.storage.ClientDeleteExpired(now); err != nil {
+		log.Println("Error purging expired clients", err)
+	} else {
+		expiredCounterVec.WithLabelValues("client").Add(float64(n))
+	}
+
+	p.setGauges()
+}
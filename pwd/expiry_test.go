@@ -0,0 +1,113 @@
+package pwd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dimaskiddo/play-with-docker/config"
+	"github.com/dimaskiddo/play-with-docker/docker"
+	"github.com/dimaskiddo/play-with-docker/event"
+	"github.com/dimaskiddo/play-with-docker/id"
+	"github.com/dimaskiddo/play-with-docker/provisioner"
+	"github.com/dimaskiddo/play-with-docker/pwd/types"
+	"github.com/dimaskiddo/play-with-docker/storage"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSweepExpired(t *testing.T) {
+	_s := &storage.Mock{}
+	_f := &docker.FactoryMock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(_g, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	now := time.Now()
+
+	_s.On("LoginRequestDeleteExpired", now).Return(2, nil)
+	_s.On("ClientDeleteExpired", now).Return(3, nil)
+	_s.On("SessionCount").Return(1, nil)
+	_s.On("InstanceCount").Return(0, nil)
+	_s.On("ClientCount").Return(4, nil)
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+
+	loginRequests := testutil.ToFloat64(expiredCounterVec.WithLabelValues("login_request"))
+	clients := testutil.ToFloat64(expiredCounterVec.WithLabelValues("client"))
+
+	p.sweepExpired(now)
+
+	assert.Equal(t, loginRequests+2, testutil.ToFloat64(expiredCounterVec.WithLabelValues("login_request")))
+	assert.Equal(t, clients+3, testutil.ToFloat64(expiredCounterVec.WithLabelValues("client")))
+	assert.Equal(t, float64(4), testutil.ToFloat64(clientsGauge))
+
+	_s.AssertExpectations(t)
+}
+
+func TestClientKeepAlive(t *testing.T) {
+	_s := &storage.Mock{}
+	_f := &docker.FactoryMock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(_g, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	defer func(ttl time.Duration) { config.ClientTTL = ttl }(config.ClientTTL)
+	config.ClientTTL = time.Minute
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+
+	fresh := &types.Client{Id: "c1", ExpiresAt: time.Now().Add(time.Minute)}
+	p.ClientKeepAlive(fresh)
+
+	stale := &types.Client{Id: "c2", ExpiresAt: time.Now().Add(10 * time.Second)}
+	_s.On("ClientPut", stale).Return(nil)
+	p.ClientKeepAlive(stale)
+
+	assert.True(t, time.Until(stale.ExpiresAt) > 50*time.Second)
+
+	// Without a TTL clients never expire, nor are they kept alive.
+	config.ClientTTL = 0
+	unbounded := &types.Client{Id: "c3"}
+	p.ClientKeepAlive(unbounded)
+	assert.True(t, unbounded.ExpiresAt.IsZero())
+
+	// Nor are they purged without an interval.
+	p.StartExpirySweeper(0)()
+
+	_s.AssertExpectations(t)
+	_s.AssertNotCalled(t, "ClientPut", fresh)
+	_s.AssertNotCalled(t, "ClientPut", unbounded)
+}
+
+func TestUserNewLoginRequest(t *testing.T) {
+	_s := &storage.Mock{}
+	_f := &docker.FactoryMock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(_g, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	defer func(ttl time.Duration) { config.LoginRequestTTL = ttl }(config.LoginRequestTTL)
+	config.LoginRequestTTL = time.Minute
+
+	_g.On("NewId").Return("lr1")
+	_s.On("LoginRequestPut", mock.AnythingOfType("*types.LoginRequest")).Return(nil)
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+	p.generator = _g
+
+	req, err := p.UserNewLoginRequest("github")
+	assert.Nil(t, err)
+	assert.True(t, time.Until(req.ExpiresAt) > 50*time.Second)
+
+	// Without a TTL login requests never expire.
+	config.LoginRequestTTL = 0
+	req, err = p.UserNewLoginRequest("github")
+	assert.Nil(t, err)
+	assert.True(t, req.ExpiresAt.IsZero())
+
+	_s.AssertExpectations(t)
+}
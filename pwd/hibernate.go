@@ -0,0 +1,164 @@
+package pwd
+
+import (
+	"log"
+	"time"
+
+	"github.com/dimaskiddo/play-with-docker/event"
+	"github.com/dimaskiddo/play-with-docker/provisioner"
+	"github.com/dimaskiddo/play-with-docker/pwd/types"
+)
+
+// SessionHibernate pauses the instances of the session until it is resumed.
+// Instances that cannot be paused, such as the Windows ones, keep running.
+func (p *pwd) SessionHibernate(s *types.Session) error {
+	defer observeAction("SessionHibernate", time.Now())
+
+	p.hibernateMx.Lock()
+	defer p.hibernateMx.Unlock()
+
+	if err := p.reloadSession(s); err != nil {
+		return err
+	}
+	if s.Hibernated {
+		return nil
+	}
+
+	instances, err := p.storage.InstanceFindBySessionId(s.Id)
+	if err != nil {
+		return err
+	}
+
+	for n, i := range instances {
+		if err := p.instanceSetPaused(s, i, true); err != nil {
+			// Leave the session as it was.
+			for _, paused := range instances[:n] {
+				if err := p.instanceSetPaused(s, paused, false); err != nil {
+					log.Printf("Error unpausing instance %s. Got: %v\n", paused.Name, err)
+				}
+			}
+
+			return err
+		}
+	}
+
+	s.Hibernated = true
+	s.HibernatedAt = time.Now()
+
+	if err := p.storage.SessionPut(s); err != nil {
+		return err
+	}
+
+	log.Printf("Hibernated session [%s]\n", s.Id)
+	event.SessionHibernatedEvent.Emit(p.event, s.Id, event.Empty{})
+
+	return nil
+}
+
+// SessionResume unpauses the instances of a hibernated session. If its
+// playground stops the expiry of hibernated sessions, the expiry is
+// postponed by the time it was hibernated, up to the maximum lifetime.
+func (p *pwd) SessionResume(s *types.Session) error {
+	defer observeAction("SessionResume", time.Now())
+
+	p.hibernateMx.Lock()
+	defer p.hibernateMx.Unlock()
+
+	if err := p.reloadSession(s); err != nil {
+		return err
+	}
+	if !s.Hibernated {
+		return nil
+	}
+
+	playground, err := p.storage.PlaygroundGet(s.PlaygroundId)
+	if err != nil {
+		return err
+	}
+
+	instances, err := p.storage.InstanceFindBySessionId(s.Id)
+	if err != nil {
+		return err
+	}
+
+	for n, i := range instances {
+		if err := p.instanceSetPaused(s, i, false); err != nil {
+			// Leave the session hibernated as it was.
+			for _, unpaused := range instances[:n] {
+				if err := p.instanceSetPaused(s, unpaused, true); err != nil {
+					log.Printf("Error pausing instance %s. Got: %v\n", unpaused.Name, err)
+				}
+			}
+
+			return err
+		}
+	}
+
+	now := time.Now()
+
+	if playground.HibernationStopsExpiry {
+		expiresAt := s.ExpiresAt.Add(now.Sub(s.HibernatedAt))
+		if playground.MaxSessionLifetime > 0 {
+			if maxExpiresAt := s.CreatedAt.Add(playground.MaxSessionLifetime); expiresAt.After(maxExpiresAt) {
+				expiresAt = maxExpiresAt
+			}
+		}
+		if expiresAt.After(s.ExpiresAt) {
+			s.ExpiresAt = expiresAt
+		}
+	}
+
+	s.Hibernated = false
+	s.HibernatedAt = time.Time{}
+	s.LastActivity = now
+	s.IdleWarnedAt = time.Time{}
+
+	if err := p.storage.SessionPut(s); err != nil {
+		return err
+	}
+
+	log.Printf("Resumed session [%s]\n", s.Id)
+	event.SessionResumedEvent.Emit(p.event, s.Id, event.SessionResumed{ExpiresAt: s.ExpiresAt})
+
+	return nil
+}
+
+// reloadSession reads s again, as another request may have hibernated or
+// resumed it since it was read.
+func (p *pwd) reloadSession(s *types.Session) error {
+	stored, err := p.storage.SessionGet(s.Id)
+	if err != nil {
+		return err
+	}
+
+	*s = *stored
+
+	return nil
+}
+
+func (p *pwd) instanceSetPaused(s *types.Session, i *types.Instance, paused bool) error {
+	if i.Paused == paused {
+		return nil
+	}
+
+	prov, err := p.getProvisioner(i.Type)
+	if err != nil {
+		return err
+	}
+
+	if paused {
+		err = prov.InstancePause(s, i)
+	} else {
+		err = prov.InstanceUnpause(s, i)
+	}
+	if provisioner.PauseNotSupported(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	i.Paused = paused
+
+	return p.storage.InstancePut(i)
+}
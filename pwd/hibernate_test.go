@@ -0,0 +1,130 @@
+package pwd
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dimaskiddo/play-with-docker/docker"
+	"github.com/dimaskiddo/play-with-docker/event"
+	"github.com/dimaskiddo/play-with-docker/id"
+	"github.com/dimaskiddo/play-with-docker/provisioner"
+	"github.com/dimaskiddo/play-with-docker/pwd/types"
+	"github.com/dimaskiddo/play-with-docker/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSessionHibernate(t *testing.T) {
+	_d := &docker.Mock{}
+	_s := &storage.Mock{}
+	_f := &docker.FactoryMock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(_g, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	now := time.Now()
+	playground := &types.Playground{Id: "foobar", MaxSessionLifetime: 3 * time.Hour, HibernationStopsExpiry: true}
+	s := &types.Session{Id: "aaaabbbbcccc", PlaygroundId: "foobar", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	dind := &types.Instance{Name: "aaaabbbb_node1", SessionId: "aaaabbbbcccc"}
+	windows := &types.Instance{Name: "aaaabbbb_node2", SessionId: "aaaabbbbcccc", Type: "windows"}
+
+	var nilArgs []interface{}
+	_f.On("GetForSession", s).Return(_d, nil)
+	_s.On("SessionGet", "aaaabbbbcccc").Return(s, nil)
+	_s.On("PlaygroundGet", "foobar").Return(playground, nil)
+	_s.On("InstanceFindBySessionId", "aaaabbbbcccc").Return([]*types.Instance{dind, windows}, nil)
+	_s.On("InstancePut", dind).Return(nil)
+	_s.On("SessionPut", s).Return(nil)
+	_d.On("ContainerPause", "aaaabbbb_node1").Return(nil)
+	_d.On("ContainerUnpause", "aaaabbbb_node1").Return(nil)
+	_e.M.On("Emit", event.SESSION_HIBERNATED, "aaaabbbbcccc", nilArgs).Return()
+	_e.M.On("Emit", event.SESSION_RESUMED, "aaaabbbbcccc", mock.Anything).Return()
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+
+	assert.Nil(t, p.SessionHibernate(s))
+	assert.True(t, s.Hibernated)
+	assert.True(t, dind.Paused)
+	assert.False(t, windows.Paused)
+
+	// Already hibernated.
+	assert.Nil(t, p.SessionHibernate(s))
+	_d.AssertNumberOfCalls(t, "ContainerPause", 1)
+
+	s.HibernatedAt = now.Add(-time.Hour)
+	assert.Nil(t, p.SessionResume(s))
+	assert.False(t, s.Hibernated)
+	assert.False(t, dind.Paused)
+	assert.WithinDuration(t, now.Add(2*time.Hour), s.ExpiresAt, time.Second)
+
+	_s.AssertExpectations(t)
+	_d.AssertExpectations(t)
+	_e.M.AssertExpectations(t)
+}
+
+func TestSessionHibernateRollback(t *testing.T) {
+	_d := &docker.Mock{}
+	_s := &storage.Mock{}
+	_f := &docker.FactoryMock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(_g, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	s := &types.Session{Id: "aaaabbbbcccc", PlaygroundId: "foobar"}
+	i1 := &types.Instance{Name: "aaaabbbb_node1", SessionId: "aaaabbbbcccc"}
+	i2 := &types.Instance{Name: "aaaabbbb_node2", SessionId: "aaaabbbbcccc"}
+
+	_f.On("GetForSession", s).Return(_d, nil)
+	_s.On("SessionGet", "aaaabbbbcccc").Return(s, nil)
+	_s.On("InstanceFindBySessionId", "aaaabbbbcccc").Return([]*types.Instance{i1, i2}, nil)
+	_s.On("InstancePut", i1).Return(nil)
+	_d.On("ContainerPause", "aaaabbbb_node1").Return(nil)
+	_d.On("ContainerPause", "aaaabbbb_node2").Return(errors.New("boom"))
+	_d.On("ContainerUnpause", "aaaabbbb_node1").Return(nil)
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+
+	assert.NotNil(t, p.SessionHibernate(s))
+	assert.False(t, s.Hibernated)
+	assert.False(t, i1.Paused)
+	assert.False(t, i2.Paused)
+
+	_s.AssertNotCalled(t, "SessionPut", s)
+	_d.AssertExpectations(t)
+}
+
+func TestSessionResumeRollback(t *testing.T) {
+	_d := &docker.Mock{}
+	_s := &storage.Mock{}
+	_f := &docker.FactoryMock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(_g, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	s := &types.Session{Id: "aaaabbbbcccc", PlaygroundId: "foobar", Hibernated: true}
+	i1 := &types.Instance{Name: "aaaabbbb_node1", SessionId: "aaaabbbbcccc", Paused: true}
+	i2 := &types.Instance{Name: "aaaabbbb_node2", SessionId: "aaaabbbbcccc", Paused: true}
+
+	_f.On("GetForSession", s).Return(_d, nil)
+	_s.On("SessionGet", "aaaabbbbcccc").Return(s, nil)
+	_s.On("PlaygroundGet", "foobar").Return(&types.Playground{Id: "foobar"}, nil)
+	_s.On("InstanceFindBySessionId", "aaaabbbbcccc").Return([]*types.Instance{i1, i2}, nil)
+	_s.On("InstancePut", i1).Return(nil)
+	_d.On("ContainerUnpause", "aaaabbbb_node1").Return(nil)
+	_d.On("ContainerUnpause", "aaaabbbb_node2").Return(errors.New("boom"))
+	_d.On("ContainerPause", "aaaabbbb_node1").Return(nil)
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+
+	assert.NotNil(t, p.SessionResume(s))
+	assert.True(t, s.Hibernated)
+	assert.True(t, i1.Paused)
+	assert.True(t, i2.Paused)
+
+	_s.AssertNotCalled(t, "SessionPut", s)
+	_d.AssertExpectations(t)
+}
@@ -97,7 +97,7 @@ func (p *pwd) InstanceDelete(session *types.Session, instance *types.Instance) e
 		return err
 	}
 
-	p.event.Emit(event.INSTANCE_DELETE, session.Id, instance.Name)
+	event.InstanceDeleteEvent.Emit(p.event, session.Id, event.InstanceDelete{Name: instance.Name})
 	p.setGauges()
 
 	return nil
@@ -126,7 +126,7 @@ func (p *pwd) InstanceNew(session *types.Session, conf types.InstanceConfig) (*t
 		return nil, err
 	}
 
-	p.event.Emit(event.INSTANCE_NEW, session.Id, instance.Name, instance.IP, instance.Hostname, instance.ProxyHost)
+	event.InstanceNewEvent.Emit(p.event, session.Id, event.InstanceNew{Name: instance.Name, IP: instance.IP, Hostname: instance.Hostname, ProxyHost: instance.ProxyHost})
 	p.setGauges()
 
 	return instance, nil
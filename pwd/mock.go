@@ -4,6 +4,7 @@ import (
 	"context"
 	"io"
 	"net"
+	"time"
 
 	"github.com/dimaskiddo/play-with-docker/pwd/types"
 	"github.com/stretchr/testify/mock"
@@ -17,6 +18,25 @@ func (m *Mock) SessionCleanUserData(session *types.Session) {
 	m.Called(session)
 }
 
+func (m *Mock) SessionTouch(sessionId string) {
+	m.Called(sessionId)
+}
+
+func (m *Mock) SessionExtend(session *types.Session, by time.Duration) error {
+	args := m.Called(session, by)
+	return args.Error(0)
+}
+
+func (m *Mock) SessionHibernate(session *types.Session) error {
+	args := m.Called(session)
+	return args.Error(0)
+}
+
+func (m *Mock) SessionResume(session *types.Session) error {
+	args := m.Called(session)
+	return args.Error(0)
+}
+
 func (m *Mock) SessionNew(ctx context.Context, config types.SessionConfig) (*types.Session, error) {
 	args := m.Called(ctx, config)
 	return args.Get(0).(*types.Session), args.Error(1)
@@ -110,6 +130,10 @@ func (m *Mock) ClientResizeViewPort(client *types.Client, cols, rows uint) {
 	m.Called(client, cols, rows)
 }
 
+func (m *Mock) ClientKeepAlive(client *types.Client) {
+	m.Called(client)
+}
+
 func (m *Mock) ClientClose(client *types.Client) {
 	m.Called(client)
 }
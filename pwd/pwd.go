@@ -5,6 +5,7 @@ import (
 	"errors"
 	"io"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/dimaskiddo/play-with-docker/docker"
@@ -60,6 +61,18 @@ type pwd struct {
 	instanceProvisionerFactory provisioner.InstanceProvisionerFactoryApi
 	windowsProvisioner         provisioner.InstanceProvisionerApi
 	dindProvisioner            provisioner.InstanceProvisionerApi
+
+	touchedMx sync.Mutex
+	touched   map[string]time.Time
+
+	// Serializes hibernating and resuming sessions.
+	hibernateMx sync.Mutex
+
+	// Serializes the changes to the clients, which the handlers of their
+	// socket share.
+	clientsMx sync.Mutex
+
+	usage UsageSummarizer
 }
 
 var sessionNotEmpty = errors.New("Session is not empty")
@@ -68,6 +81,18 @@ func SessionNotEmpty(e error) bool {
 	return e == sessionNotEmpty
 }
 
+var (
+	extensionsDisabled  = errors.New("Sessions of this playground cannot be extended")
+	extensionsExhausted = errors.New("Session was extended the maximum number of times")
+	maxLifetimeReached  = errors.New("Session reached its maximum lifetime")
+)
+
+// SessionExtensionDenied reports whether e is the reason why the playground
+// does not allow extending a session.
+func SessionExtensionDenied(e error) bool {
+	return e == extensionsDisabled || e == extensionsExhausted || e == maxLifetimeReached
+}
+
 type PWDApi interface {
 	SessionNew(ctx context.Context, config types.SessionConfig) (*types.Session, error)
 	SessionClose(session *types.Session) error
@@ -76,6 +101,10 @@ type PWDApi interface {
 	SessionGet(id string) (*types.Session, error)
 	SessionSetup(session *types.Session, conf SessionSetupConf) error
 	SessionCleanUserData(session *types.Session)
+	SessionTouch(sessionId string)
+	SessionExtend(session *types.Session, by time.Duration) error
+	SessionHibernate(session *types.Session) error
+	SessionResume(session *types.Session) error
 
 	InstanceNew(session *types.Session, conf types.InstanceConfig) (*types.Instance, error)
 	InstanceResizeTerminal(instance *types.Instance, cols, rows uint) error
@@ -91,6 +120,7 @@ type PWDApi interface {
 
 	ClientNew(id string, session *types.Session) *types.Client
 	ClientResizeViewPort(client *types.Client, cols, rows uint)
+	ClientKeepAlive(client *types.Client)
 	ClientClose(client *types.Client)
 	ClientCount() int
 
@@ -18,6 +18,7 @@ import (
 	"github.com/dimaskiddo/play-with-docker/docker"
 	"github.com/dimaskiddo/play-with-docker/event"
 	"github.com/dimaskiddo/play-with-docker/pwd/types"
+	"github.com/dimaskiddo/play-with-docker/storage"
 )
 
 var preparedSessions = map[string]bool{}
@@ -40,7 +41,7 @@ type sessionBuilderWriter struct {
 }
 
 func (s *sessionBuilderWriter) Write(p []byte) (n int, err error) {
-	s.event.Emit(event.SESSION_BUILDER_OUT, s.sessionId, string(p))
+	event.SessionBuilderOutEvent.Emit(s.event, s.sessionId, event.SessionBuilderOut{Data: string(p)})
 	return len(p), nil
 }
 
@@ -61,6 +62,10 @@ type SessionSetupInstanceConf struct {
 	Tls            bool       `json:"tls"`
 }
 
+// Client activity is saved at most this often, so terminal input does not
+// hit the storage on every key.
+const sessionTouchInterval = time.Minute
+
 func (p *pwd) SessionCleanUserData(s *types.Session) {
 	userVolumePath := config.GetAbsoultePath(filepath.Join(config.ExternalDataDir, s.Id))
 
@@ -89,6 +94,7 @@ func (p *pwd) SessionNew(ctx context.Context, config types.SessionConfig) (*type
 	s.Id = shId
 	s.CreatedAt = time.Now()
 	s.ExpiresAt = s.CreatedAt.Add(config.Duration)
+	s.LastActivity = s.CreatedAt
 	s.Ready = true
 	s.Stack = config.Stack
 	s.UserId = config.UserId
@@ -118,7 +124,7 @@ func (p *pwd) SessionNew(ctx context.Context, config types.SessionConfig) (*type
 	}
 
 	p.setGauges()
-	p.event.Emit(event.SESSION_NEW, s.Id)
+	event.SessionNewEvent.Emit(p.event, s.Id, event.Empty{})
 
 	return s, nil
 }
@@ -127,6 +133,8 @@ func (p *pwd) SessionClose(s *types.Session) error {
 	defer observeAction("SessionClose", time.Now())
 
 	log.Printf("Starting clean up of session [%s]\n", s.Id)
+	usage := p.sessionUsage(s)
+
 	g, _ := errgroup.WithContext(context.Background())
 
 	instances, err := p.storage.InstanceFindBySessionId(s.Id)
@@ -162,8 +170,12 @@ func (p *pwd) SessionClose(s *types.Session) error {
 
 	log.Printf("Cleaned up session [%s]\n", s.Id)
 
+	p.touchedMx.Lock()
+	delete(p.touched, s.Id)
+	p.touchedMx.Unlock()
+
 	p.setGauges()
-	p.event.Emit(event.SESSION_END, s.Id)
+	event.SessionEndEvent.Emit(p.event, s.Id, event.SessionEnd{PlaygroundId: s.PlaygroundId, UserId: s.UserId, Usage: usage})
 
 	return nil
 }
@@ -211,7 +223,7 @@ func (p *pwd) SessionDeployStack(s *types.Session) error {
 	}
 
 	s.Ready = false
-	p.event.Emit(event.SESSION_READY, s.Id, false)
+	event.SessionReadyEvent.Emit(p.event, s.Id, event.SessionReady{Ready: false})
 
 	i, err := p.InstanceNew(s, types.InstanceConfig{ImageName: s.ImageName, PlaygroundFQDN: s.Host, DindVolumeSize: "5G", Privileged: true})
 	if err != nil {
@@ -252,11 +264,92 @@ func (p *pwd) SessionDeployStack(s *types.Session) error {
 	log.Printf("Stack execution finished with code %d\n", code)
 	s.Ready = true
 
-	p.event.Emit(event.SESSION_READY, s.Id, true)
+	event.SessionReadyEvent.Emit(p.event, s.Id, event.SessionReady{Ready: true})
+	if err := p.storage.SessionPut(s); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SessionTouch records client activity on the session, which is saved at
+// most once per sessionTouchInterval.
+func (p *pwd) SessionTouch(sessionId string) {
+	now := time.Now()
+
+	p.touchedMx.Lock()
+	if p.touched == nil {
+		p.touched = map[string]time.Time{}
+	}
+	if now.Sub(p.touched[sessionId]) < sessionTouchInterval {
+		p.touchedMx.Unlock()
+		return
+	}
+	p.touched[sessionId] = now
+	p.touchedMx.Unlock()
+
+	// Only the activity is saved, so that the session changed meanwhile,
+	// extended or hibernated, is not overwritten.
+	if err := p.storage.SessionTouch(sessionId, now); err != nil {
+		p.touchedMx.Lock()
+		delete(p.touched, sessionId)
+		p.touchedMx.Unlock()
+
+		if !storage.NotFound(err) {
+			log.Printf("Error saving activity of session %s. Got: %v\n", sessionId, err)
+		}
+	}
+}
+
+// SessionExtend postpones the expiry of the session by the given duration,
+// or the default session duration of its playground if zero, without going
+// past the maximum lifetime of the playground.
+func (p *pwd) SessionExtend(s *types.Session, by time.Duration) error {
+	defer observeAction("SessionExtend", time.Now())
+
+	// The limits are checked against the stored session, so concurrent
+	// extensions or a hibernation in between are not overwritten.
+	p.hibernateMx.Lock()
+	defer p.hibernateMx.Unlock()
+
+	if err := p.reloadSession(s); err != nil {
+		return err
+	}
+
+	playground, err := p.storage.PlaygroundGet(s.PlaygroundId)
+	if err != nil {
+		return err
+	}
+
+	if playground.MaxSessionExtensions <= 0 || playground.MaxSessionLifetime <= 0 {
+		return extensionsDisabled
+	}
+	if s.Extensions >= playground.MaxSessionExtensions {
+		return extensionsExhausted
+	}
+
+	maxExpiresAt := s.CreatedAt.Add(playground.MaxSessionLifetime)
+	if !s.ExpiresAt.Before(maxExpiresAt) {
+		return maxLifetimeReached
+	}
+
+	if by <= 0 {
+		by = playground.DefaultSessionDuration
+	}
+
+	s.ExpiresAt = s.ExpiresAt.Add(by)
+	if s.ExpiresAt.After(maxExpiresAt) {
+		s.ExpiresAt = maxExpiresAt
+	}
+	s.Extensions++
+
 	if err := p.storage.SessionPut(s); err != nil {
 		return err
 	}
 
+	log.Printf("Extended session [%s] until %s\n", s.Id, s.ExpiresAt)
+	event.SessionExtendedEvent.Emit(p.event, s.Id, event.SessionExtended{ExpiresAt: s.ExpiresAt})
+
 	return nil
 }
 
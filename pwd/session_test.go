@@ -34,7 +34,7 @@ func TestSessionNew(t *testing.T) {
 	_f.On("GetForSession", mock.AnythingOfType("*types.Session")).Return(_d, nil)
 	_d.On("NetworkCreate", "aaaabbbbcccc", dtypes.NetworkCreate{Attachable: true, Driver: "overlay"}).Return(nil)
 	_d.On("DaemonHost").Return("localhost")
-	_d.On("NetworkConnect", config.L2ContainerName, "aaaabbbbcccc", "").Return("10.0.0.1", nil)
+	_d.On("NetworkConnect", config.L2ContainerName, "aaaabbbbcccc", "", []string(nil)).Return("10.0.0.1", nil)
 	_s.On("SessionPut", mock.AnythingOfType("*types.Session")).Return(nil)
 	_s.On("SessionCount").Return(1, nil)
 	_s.On("InstanceCount").Return(0, nil)
@@ -110,6 +110,56 @@ func TestSessionFailWhenUserIsBanned(t *testing.T) {
 	_e.M.AssertExpectations(t)
 }
 
+func TestSessionExtend(t *testing.T) {
+	_s := &storage.Mock{}
+	_f := &docker.FactoryMock{}
+	_g := &id.MockGenerator{}
+	_e := &event.Mock{}
+	ipf := provisioner.NewInstanceProvisionerFactory(provisioner.NewWindowsASG(_f, _s), provisioner.NewDinD(_g, _f, _s))
+	sp := provisioner.NewOverlaySessionProvisioner(_f)
+
+	now := time.Now()
+	playground := &types.Playground{Id: "foobar", DefaultSessionDuration: time.Hour, MaxSessionLifetime: 3 * time.Hour, MaxSessionExtensions: 2}
+	stored := &types.Session{Id: "aaaabbbbcccc", PlaygroundId: "foobar", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	s := &types.Session{}
+	*s = *stored
+	stale := *stored
+
+	_s.On("PlaygroundGet", "foobar").Return(playground, nil)
+	_s.On("SessionGet", "aaaabbbbcccc").Return(stored, nil)
+	_s.On("SessionPut", mock.AnythingOfType("*types.Session")).Run(func(args mock.Arguments) {
+		*stored = *args.Get(0).(*types.Session)
+	}).Return(nil)
+	_e.M.On("Emit", event.SESSION_EXTENDED, "aaaabbbbcccc", []interface{}{now.Add(2 * time.Hour)}).Return()
+	_e.M.On("Emit", event.SESSION_EXTENDED, "aaaabbbbcccc", []interface{}{now.Add(3 * time.Hour)}).Return()
+
+	p := NewPWD(_f, _e, _s, sp, ipf)
+
+	assert.Nil(t, p.SessionExtend(s, 0))
+	assert.Equal(t, now.Add(2*time.Hour), s.ExpiresAt)
+	assert.Equal(t, 1, s.Extensions)
+
+	// Capped at the maximum lifetime.
+	assert.Nil(t, p.SessionExtend(s, 5*time.Hour))
+	assert.Equal(t, now.Add(3*time.Hour), s.ExpiresAt)
+
+	err := p.SessionExtend(s, time.Hour)
+	assert.True(t, SessionExtensionDenied(err))
+
+	// A copy read before the extensions is checked against the stored session.
+	err = p.SessionExtend(&stale, time.Hour)
+	assert.True(t, SessionExtensionDenied(err))
+	assert.Equal(t, 2, stale.Extensions)
+
+	playground.MaxSessionExtensions = 5
+	err = p.SessionExtend(s, time.Hour)
+	assert.True(t, SessionExtensionDenied(err))
+	assert.Equal(t, 2, s.Extensions)
+
+	_s.AssertExpectations(t)
+	_e.M.AssertExpectations(t)
+}
+
 /*
 
 ************************** Not sure how to test this as it can pick any manager as the first node in the swarm cluster.
@@ -128,7 +178,7 @@ func TestSessionSetup(t *testing.T) {
 	_f.On("GetForSession", "aaaabbbbcccc").Return(_d, nil)
 	_d.On("NetworkCreate", "aaaabbbbcccc", dtypes.NetworkCreate{Attachable: true, Driver: "overlay"}).Return(nil)
 	_d.On("DaemonHost").Return("localhost")
-	_d.On("NetworkConnect", config.L2ContainerName, "aaaabbbbcccc", "").Return("10.0.0.1", nil)
+	_d.On("NetworkConnect", config.L2ContainerName, "aaaabbbbcccc", "", []string(nil)).Return("10.0.0.1", nil)
 	_s.On("SessionPut", mock.AnythingOfType("*types.Session")).Return(nil)
 	_s.On("InstancePut", mock.AnythingOfType("*types.Instance")).Return(nil)
 	_s.On("SessionCount").Return(1, nil)
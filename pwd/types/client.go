@@ -1,9 +1,12 @@
 package types
 
+import "time"
+
 type Client struct {
-	Id        string   `json:"id" bson:"id"`
-	SessionId string   `json:"session_id" bson:"session_id"`
-	ViewPort  ViewPort `json:"viewport"`
+	Id        string    `json:"id" bson:"id"`
+	SessionId string    `json:"session_id" bson:"session_id"`
+	ViewPort  ViewPort  `json:"viewport"`
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
 }
 
 type ViewPort struct {
@@ -7,7 +7,7 @@ type Instance struct {
 	Image       string          `json:"image" bson:"image"`
 	Hostname    string          `json:"hostname" bson:"hostname"`
 	IP          string          `json:"ip" bson:"ip"`
-	RoutableIP  string          `json:"routable_ip" bson:"routable_id"`
+	RoutableIP  string          `json:"routable_ip" bson:"routable_ip"`
 	LimitCPU    float64         `json:"limit_cpu" bson:"limit_cpu"`
 	LimitMemory int64           `json:"limit_memory" bson:"limit_memory"`
 	ServerCert  []byte          `json:"server_cert" bson:"server_cert"`
@@ -21,6 +21,7 @@ type Instance struct {
 	SessionHost string          `json:"session_host" bson:"session_host"`
 	Type        string          `json:"type" bson:"type"`
 	WindowsId   string          `json:"-" bson:"windows_id"`
+	Paused      bool            `json:"paused" bson:"paused"`
 	ctx         context.Context `json:"-" bson:"-"`
 }
 
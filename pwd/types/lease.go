@@ -0,0 +1,10 @@
+package types
+
+import "time"
+
+// Lease is held by a single holder at a time until it expires or is released.
+type Lease struct {
+	Name      string    `json:"name" bson:"name"`
+	Holder    string    `json:"holder" bson:"holder"`
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+}
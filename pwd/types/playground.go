@@ -6,32 +6,58 @@ import (
 )
 
 type Playground struct {
-	Id                          string           `json:"id" bson:"id"`
-	Domain                      string           `json:"domain" bson:"domain"`
-	DefaultDinDInstanceImage    string           `json:"default_dind_instance_image" bson:"default_dind_instance_image"`
-	AvailableDinDInstanceImages []string         `json:"available_dind_instance_images" bson:"available_dind_instance_images"`
-	AllowWindowsInstances       bool             `json:"allow_windows_instances" bson:"allow_windows_instances"`
-	DefaultSessionDuration      time.Duration    `json:"default_session_duration" bson:"default_session_duration"`
-	DindVolumeSize              string           `json:"dind_volume_size" bson:"dind_volume_size"`
-	Extras                      PlaygroundExtras `json:"extras" bson:"extras"`
-	AssetsDir                   string           `json:"assets_dir" bson:"assets_dir"`
-	Tasks                       []string         `json:"tasks" bson:"tasks"`
-	DockerClientID              string           `json:"docker_client_id" bson:"docker_client_id"`
-	DockerClientSecret          string           `json:"docker_client_secret" bson:"docker_client_secret"`
-	GithubClientID              string           `json:"github_client_id" bson:"github_client_id"`
-	GithubClientSecret          string           `json:"github_client_secret" bson:"github_client_secret"`
-	GoogleClientID              string           `json:"google_client_id" bson:"google_client_id"`
-	GoogleClientSecret          string           `json:"google_client_secret" bson:"google_client_secret"`
-	AzureClientID               string           `json:"azure_client_id" bson:"azure_client_id"`
-	AzureClientSecret           string           `json:"azure_client_secret" bson:"azure_client_secret"`
-	AzureTenantID               string           `json:"azure_tenant_id" bson:"azure_tenant_id"`
-	OIDCClientID                string           `json:"oidc_client_id" bson:"oidc_client_id"`
-	OIDCClientSecret            string           `json:"oidc_client_secret" bson:"oidc_client_secret"`
-	OIDCEndpoint                string           `json:"oidc_endpoint" bson:"oidc_endpoint"`
-	AuthRedirectBase            string           `json:"auth_redirect_base" bson:"auth_redirect_base"`
-	DockerHost                  string           `json:"docker_host" bson:"docker_host"`
-	MaxInstances                int              `json:"max_instances" bson:"max_instances"`
-	Privileged                  bool             `json:"privileged" bson:"privileged"`
+	Id                          string                  `json:"id" bson:"id"`
+	Domain                      string                  `json:"domain" bson:"domain"`
+	DefaultDinDInstanceImage    string                  `json:"default_dind_instance_image" bson:"default_dind_instance_image"`
+	AvailableDinDInstanceImages []string                `json:"available_dind_instance_images" bson:"available_dind_instance_images"`
+	AllowWindowsInstances       bool                    `json:"allow_windows_instances" bson:"allow_windows_instances"`
+	DefaultSessionDuration      time.Duration           `json:"default_session_duration" bson:"default_session_duration"`
+	DindVolumeSize              string                  `json:"dind_volume_size" bson:"dind_volume_size"`
+	Extras                      PlaygroundExtras        `json:"extras" bson:"extras"`
+	AssetsDir                   string                  `json:"assets_dir" bson:"assets_dir"`
+	Tasks                       []string                `json:"tasks" bson:"tasks"`
+	DockerClientID              string                  `json:"docker_client_id" bson:"docker_client_id"`
+	DockerClientSecret          string                  `json:"docker_client_secret" bson:"docker_client_secret"`
+	GithubClientID              string                  `json:"github_client_id" bson:"github_client_id"`
+	GithubClientSecret          string                  `json:"github_client_secret" bson:"github_client_secret"`
+	GoogleClientID              string                  `json:"google_client_id" bson:"google_client_id"`
+	GoogleClientSecret          string                  `json:"google_client_secret" bson:"google_client_secret"`
+	AzureClientID               string                  `json:"azure_client_id" bson:"azure_client_id"`
+	AzureClientSecret           string                  `json:"azure_client_secret" bson:"azure_client_secret"`
+	AzureTenantID               string                  `json:"azure_tenant_id" bson:"azure_tenant_id"`
+	OIDCClientID                string                  `json:"oidc_client_id" bson:"oidc_client_id"`
+	OIDCClientSecret            string                  `json:"oidc_client_secret" bson:"oidc_client_secret"`
+	OIDCEndpoint                string                  `json:"oidc_endpoint" bson:"oidc_endpoint"`
+	AuthRedirectBase            string                  `json:"auth_redirect_base" bson:"auth_redirect_base"`
+	DockerHost                  string                  `json:"docker_host" bson:"docker_host"`
+	MaxInstances                int                     `json:"max_instances" bson:"max_instances"`
+	Privileged                  bool                    `json:"privileged" bson:"privileged"`
+	Webhooks                    []Webhook               `json:"webhooks" bson:"webhooks"`
+	TaskSchedules               map[string]TaskSchedule `json:"task_schedules" bson:"task_schedules"`
+	IdleTimeout                 time.Duration           `json:"idle_timeout" bson:"idle_timeout"`
+	IdleGracePeriod             time.Duration           `json:"idle_grace_period" bson:"idle_grace_period"`
+	MaxSessionLifetime          time.Duration           `json:"max_session_lifetime" bson:"max_session_lifetime"`
+	MaxSessionExtensions        int                     `json:"max_session_extensions" bson:"max_session_extensions"`
+	ExpiryWarnings              []time.Duration         `json:"expiry_warnings" bson:"expiry_warnings"`
+	HibernateOnIdle             bool                    `json:"hibernate_on_idle" bson:"hibernate_on_idle"`
+	HibernationStopsExpiry      bool                    `json:"hibernation_stops_expiry" bson:"hibernation_stops_expiry"`
+}
+
+// TaskSchedule is how often a scheduler task runs on each instance. A task
+// runs again Interval plus up to Jitter after its previous run ended, and is
+// cancelled after Timeout.
+type TaskSchedule struct {
+	Interval time.Duration `json:"interval" bson:"interval"`
+	Jitter   time.Duration `json:"jitter" bson:"jitter"`
+	Timeout  time.Duration `json:"timeout" bson:"timeout"`
+}
+
+// Webhook is notified of the session and instance events of a playground.
+// Events lists the event names it is sent, all of them if empty.
+type Webhook struct {
+	URL    string   `json:"url" bson:"url"`
+	Secret string   `json:"secret" bson:"secret"`
+	Events []string `json:"events" bson:"events"`
 }
 
 type PlaygroundExtras map[string]interface{}
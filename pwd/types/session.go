@@ -25,4 +25,20 @@ type Session struct {
 	Host         string    `json:"host" bson:"host"`
 	UserId       string    `json:"user_id" bson:"user_id"`
 	PlaygroundId string    `json:"playground_id" bson:"playground_id"`
+	LastActivity time.Time `json:"last_activity" bson:"last_activity"`
+	IdleWarnedAt time.Time `json:"idle_warned_at" bson:"idle_warned_at"`
+	Extensions   int       `json:"extensions" bson:"extensions"`
+	Hibernated   bool      `json:"hibernated" bson:"hibernated"`
+	HibernatedAt time.Time `json:"hibernated_at" bson:"hibernated_at"`
+}
+
+// SessionUsage sums up the resources used by the instances of a session.
+// PeakCpuSum, in CPUs, and PeakMemSum, in bytes, add up the peak of each
+// instance whenever it happened, so they are an upper bound of what the
+// session used at once. The network totals are in bytes.
+type SessionUsage struct {
+	PeakCpuSum float64 `json:"peak_cpu_sum"`
+	PeakMemSum uint64  `json:"peak_mem_sum"`
+	NetRx      uint64  `json:"net_rx"`
+	NetTx      uint64  `json:"net_tx"`
 }
@@ -0,0 +1,33 @@
+package pwd
+
+import (
+	"log"
+
+	"github.com/dimaskiddo/play-with-docker/pwd/types"
+)
+
+// UsageSummarizer sums up the resources used by the instances of a session.
+type UsageSummarizer interface {
+	Summary(sessionId string) *types.SessionUsage
+}
+
+// SetUsageSummarizer makes closing a session send the usage summed up by u in
+// the session end event, as the session itself is deleted.
+func (p *pwd) SetUsageSummarizer(u UsageSummarizer) {
+	p.usage = u
+}
+
+func (p *pwd) sessionUsage(s *types.Session) *types.SessionUsage {
+	if p.usage == nil {
+		return nil
+	}
+
+	usage := p.usage.Summary(s.Id)
+	if usage == nil {
+		return nil
+	}
+
+	log.Printf("Session [%s] used at most %.2f CPUs and %d bytes of memory summed over its instances, received %d and sent %d bytes\n", s.Id, usage.PeakCpuSum, usage.PeakMemSum, usage.NetRx, usage.NetTx)
+
+	return usage
+}
@@ -2,7 +2,9 @@ package pwd
 
 import (
 	"errors"
+	"time"
 
+	"github.com/dimaskiddo/play-with-docker/config"
 	"github.com/dimaskiddo/play-with-docker/pwd/types"
 	"github.com/dimaskiddo/play-with-docker/storage"
 )
@@ -11,6 +13,9 @@ var userBannedError = errors.New("User is banned")
 
 func (p *pwd) UserNewLoginRequest(providerName string) (*types.LoginRequest, error) {
 	req := &types.LoginRequest{Id: p.generator.NewId(), Provider: providerName}
+	if config.LoginRequestTTL > 0 {
+		req.ExpiresAt = time.Now().Add(config.LoginRequestTTL)
+	}
 	if err := p.storage.LoginRequestPut(req); err != nil {
 		return nil, err
 	}
@@ -20,6 +25,8 @@ func (p *pwd) UserNewLoginRequest(providerName string) (*types.LoginRequest, err
 func (p *pwd) UserGetLoginRequest(id string) (*types.LoginRequest, error) {
 	if req, err := p.storage.LoginRequestGet(id); err != nil {
 		return nil, err
+	} else if !req.ExpiresAt.IsZero() && time.Now().After(req.ExpiresAt) {
+		return nil, storage.NotFoundError
 	} else {
 		return req, nil
 	}
@@ -4,10 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/ssh"
@@ -29,6 +32,8 @@ func director(protocol router.Protocol, host string) (*router.DirectorInfo, erro
 		return nil, err
 	}
 
+	resumeSession(info.SessionId)
+
 	port := info.Port
 
 	if info.EncodedPort > 0 {
@@ -59,6 +64,42 @@ func director(protocol router.Protocol, host string) (*router.DirectorInfo, erro
 	return &i, nil
 }
 
+const resumeInterval = 30 * time.Second
+
+var (
+	resumedMx    sync.Mutex
+	resumed      = map[string]time.Time{}
+	resumeClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+// resumeSession asks PWD in the background to resume the session in case it
+// was hibernated, so the connection is not held while its instances are
+// unpaused. It is done at most once every resumeInterval for each session.
+func resumeSession(sessionId string) {
+	resumedMx.Lock()
+	if time.Since(resumed[sessionId]) < resumeInterval {
+		resumedMx.Unlock()
+		return
+	}
+	resumed[sessionId] = time.Now()
+	for id, at := range resumed {
+		if time.Since(at) >= resumeInterval {
+			delete(resumed, id)
+		}
+	}
+	resumedMx.Unlock()
+
+	go func() {
+		url := fmt.Sprintf("http://%s:%s/sessions/%s/resume", config.PWDContainerName, config.PortNumber, sessionId)
+		resp, err := resumeClient.Post(url, "application/json", nil)
+		if err != nil {
+			log.Printf("Error resuming session %s. Got: %v\n", sessionId, err)
+			return
+		}
+		resp.Body.Close()
+	}()
+}
+
 func connectNetworks() error {
 	ctx := context.Background()
 
@@ -115,13 +156,7 @@ func monitorNetworks() {
 					return
 				}
 
-				f, err := os.Create(config.SessionsFile)
-				if err != nil {
-					log.Println(err)
-					return
-				}
-
-				err = json.NewEncoder(f).Encode(container.NetworkSettings.Networks)
+				err = saveNetworks(container.NetworkSettings.Networks)
 				if err != nil {
 					log.Println(err)
 					return
@@ -132,6 +167,29 @@ func monitorNetworks() {
 	}
 }
 
+// saveNetworks replaces the networks file through a synced temporary file so a
+// crash while saving never leaves connectNetworks with a truncated file.
+func saveNetworks(networks map[string]*network.EndpointSettings) error {
+	f, err := ioutil.TempFile(filepath.Dir(config.SessionsFile), filepath.Base(config.SessionsFile)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	err = json.NewEncoder(f).Encode(networks)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), config.SessionsFile)
+}
+
 func main() {
 	config.ParseFlags()
 
@@ -0,0 +1,171 @@
+package scheduler
+
+import (
+	"log"
+	"time"
+
+	"github.com/dimaskiddo/play-with-docker/pwd/types"
+	"github.com/dimaskiddo/play-with-docker/storage"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var leaderGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "pwd_scheduler_leader",
+	Help: "Whether this replica runs the scheduler, the others stand by",
+})
+
+func init() {
+	prometheus.MustRegister(leaderGauge)
+}
+
+// Lock is held by at most one of the schedulers sharing it at a time.
+type Lock interface {
+	// Acquire takes the lock, or renews it when already held, until ttl from
+	// now. It reports whether the lock is held.
+	Acquire(ttl time.Duration) (bool, error)
+	Release() error
+}
+
+type storageLock struct {
+	storage storage.StorageApi
+	name    string
+	holder  string
+}
+
+// NewStorageLock returns a Lock kept as the lease name of the storage, held
+// on behalf of holder, which has to be unique to this process.
+func NewStorageLock(s storage.StorageApi, name, holder string) Lock {
+	return &storageLock{storage: s, name: name, holder: holder}
+}
+
+func (l *storageLock) Acquire(ttl time.Duration) (bool, error) {
+	lease, err := l.storage.LeaseAcquire(l.name, l.holder, ttl)
+	if err != nil {
+		return false, err
+	}
+
+	return lease.Holder == l.holder, nil
+}
+
+func (l *storageLock) Release() error {
+	return l.storage.LeaseRelease(l.name, l.holder)
+}
+
+func (s *scheduler) isLeading() bool {
+	s.scheduledMx.Lock()
+	defer s.scheduledMx.Unlock()
+
+	return s.leading
+}
+
+// lead schedules the stored sessions and instances, and the ones created from
+// now on.
+func (s *scheduler) lead() error {
+	s.scheduledMx.Lock()
+	s.leading = true
+	s.scheduledMx.Unlock()
+
+	leaderGauge.Set(1)
+
+	sessions, err := s.storage.SessionGetAll()
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		s.mx.Lock()
+		if _, found := s.playgrounds[session.PlaygroundId]; !found {
+			playground, err := s.storage.PlaygroundGet(session.PlaygroundId)
+			if err != nil {
+				s.mx.Unlock()
+				return err
+			}
+
+			s.playgrounds[playground.Id] = playground
+		}
+		s.mx.Unlock()
+
+		s.scheduleSession(session)
+
+		instances, err := s.storage.InstanceFindBySessionId(session.Id)
+		if err != nil {
+			return err
+		}
+
+		for _, instance := range instances {
+			s.scheduleInstance(instance, session.PlaygroundId)
+		}
+	}
+
+	return nil
+}
+
+// follow unschedules everything, leaving it to the leader.
+func (s *scheduler) follow() {
+	s.scheduledMx.Lock()
+	s.leading = false
+	var sessions []*types.Session
+	for _, ss := range s.scheduledSessions {
+		sessions = append(sessions, ss.session)
+	}
+	var instances []*types.Instance
+	for _, si := range s.scheduledInstances {
+		instances = append(instances, si.instance)
+	}
+	s.scheduledMx.Unlock()
+
+	for _, session := range sessions {
+		s.unscheduleSession(session)
+	}
+
+	for _, instance := range instances {
+		s.unscheduleInstance(instance)
+	}
+
+	leaderGauge.Set(0)
+}
+
+// elect tries to take or renew the lock every third of its ttl, leading while
+// it is held. A leader that cannot reach the lock steps down before the lock
+// may have expired, so a standby takes over at most the ttl and a third after
+// the leader is gone.
+func (s *scheduler) elect(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	interval := s.leaseTTL / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var renewed time.Time
+
+	for {
+		held, err := s.lock.Acquire(s.leaseTTL)
+		if err != nil {
+			log.Printf("Error acquiring the scheduler lock. Got: %v\n", err)
+		} else if held {
+			renewed = time.Now()
+		}
+
+		leading := s.isLeading()
+		if held && !leading {
+			log.Printf("Acquired the scheduler lock, leading\n")
+
+			if err := s.lead(); err != nil {
+				log.Printf("Error scheduling the stored sessions. Got: %v\n", err)
+				s.follow()
+				if err := s.lock.Release(); err != nil {
+					log.Printf("Error releasing the scheduler lock. Got: %v\n", err)
+				}
+			}
+		} else if !held && leading && (err == nil || time.Since(renewed) >= s.leaseTTL-interval) {
+			log.Printf("Lost the scheduler lock, standing by\n")
+			s.follow()
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package scheduler
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dimaskiddo/play-with-docker/event"
+	"github.com/dimaskiddo/play-with-docker/pwd"
+	"github.com/dimaskiddo/play-with-docker/pwd/types"
+	"github.com/dimaskiddo/play-with-docker/storage"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeLock struct {
+	mx   sync.Mutex
+	held bool
+	err  error
+}
+
+func (l *fakeLock) set(held bool, err error) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	l.held, l.err = held, err
+}
+
+func (l *fakeLock) Acquire(ttl time.Duration) (bool, error) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	if l.err != nil {
+		return false, l.err
+	}
+
+	return l.held, nil
+}
+
+func (l *fakeLock) Release() error {
+	l.set(false, nil)
+	return nil
+}
+
+func TestScheduler_elect(t *testing.T) {
+	_s := &storage.Mock{}
+	_e := &event.Mock{}
+	_p := &pwd.Mock{}
+
+	lock := &fakeLock{}
+	s, err := NewScheduler(nil, _s, _e, _p, 1, lock, 30*time.Millisecond)
+	assert.Nil(t, err)
+
+	_s.On("SessionGetAll").Return([]*types.Session{}, nil)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go s.elect(stop, done)
+
+	leading := func() bool { return s.isLeading() }
+	standing := func() bool { return !s.isLeading() }
+
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, s.isLeading())
+
+	lock.set(true, nil)
+	assert.Eventually(t, leading, time.Second, 5*time.Millisecond)
+	assert.Equal(t, float64(1), testutil.ToFloat64(leaderGauge))
+
+	// Steps down once the lock may have expired.
+	lock.set(true, errors.New("unreachable"))
+	assert.Eventually(t, standing, time.Second, 5*time.Millisecond)
+	assert.Equal(t, float64(0), testutil.ToFloat64(leaderGauge))
+
+	lock.set(true, nil)
+	assert.Eventually(t, leading, time.Second, 5*time.Millisecond)
+
+	// Another replica took the lock.
+	lock.set(false, nil)
+	assert.Eventually(t, standing, time.Second, 5*time.Millisecond)
+
+	close(stop)
+	<-done
+}
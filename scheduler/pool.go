@@ -0,0 +1,158 @@
+package scheduler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	taskDurationHistogramVec = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pwd_scheduler_task_duration_ms",
+		Help:    "How long it took to run a specific task on an instance",
+		Buckets: []float64{100, 500, 1000, 5000, 15000},
+	}, []string{"task"})
+
+	taskLagHistogramVec = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pwd_scheduler_task_queue_lag_ms",
+		Help:    "How long a specific task waited for a free worker",
+		Buckets: []float64{10, 100, 1000, 5000},
+	}, []string{"task"})
+
+	taskErrorsCounterVec = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pwd_scheduler_task_errors_total",
+		Help: "Runs of a specific task that failed or timed out",
+	}, []string{"task"})
+
+	queuedTasksGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "pwd_scheduler_queued_tasks",
+		Help: "Task runs waiting for a free worker",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(taskDurationHistogramVec)
+	prometheus.MustRegister(taskLagHistogramVec)
+	prometheus.MustRegister(taskErrorsCounterVec)
+	prometheus.MustRegister(queuedTasksGauge)
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d.Nanoseconds()) / 1000000
+}
+
+type job struct {
+	task   string
+	queued time.Time
+	run    func()
+}
+
+// pool runs the jobs on a fixed number of workers. Each session has its own
+// queue and workers take from them in turn, so the sessions with many
+// instances do not hold back the others.
+type pool struct {
+	workers int
+
+	mx      sync.Mutex
+	cond    *sync.Cond
+	queues  map[string][]job
+	turns   []string
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+func newPool(workers int) *pool {
+	if workers < 1 {
+		workers = 1
+	}
+
+	p := &pool{workers: workers, queues: map[string][]job{}}
+	p.cond = sync.NewCond(&p.mx)
+
+	return p
+}
+
+func (p *pool) start() {
+	p.mx.Lock()
+	p.stopped = false
+	p.mx.Unlock()
+
+	p.wg.Add(p.workers)
+	for i := 0; i < p.workers; i++ {
+		go p.work()
+	}
+}
+
+// stop waits for the running jobs and drops the queued ones.
+func (p *pool) stop() {
+	p.mx.Lock()
+	p.stopped = true
+	for sessionId, queue := range p.queues {
+		queuedTasksGauge.Sub(float64(len(queue)))
+		delete(p.queues, sessionId)
+	}
+	p.turns = nil
+	p.cond.Broadcast()
+	p.mx.Unlock()
+
+	p.wg.Wait()
+}
+
+func (p *pool) submit(sessionId, task string, run func()) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	if p.stopped {
+		return
+	}
+
+	if len(p.queues[sessionId]) == 0 {
+		p.turns = append(p.turns, sessionId)
+	}
+	p.queues[sessionId] = append(p.queues[sessionId], job{task: task, queued: time.Now(), run: run})
+	queuedTasksGauge.Inc()
+
+	p.cond.Signal()
+}
+
+func (p *pool) next() (job, bool) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	for len(p.turns) == 0 && !p.stopped {
+		p.cond.Wait()
+	}
+	if p.stopped {
+		return job{}, false
+	}
+
+	sessionId := p.turns[0]
+	p.turns = p.turns[1:]
+
+	queue := p.queues[sessionId]
+	j := queue[0]
+	if len(queue) == 1 {
+		delete(p.queues, sessionId)
+	} else {
+		p.queues[sessionId] = queue[1:]
+		p.turns = append(p.turns, sessionId)
+	}
+	queuedTasksGauge.Dec()
+
+	return j, true
+}
+
+func (p *pool) work() {
+	defer p.wg.Done()
+
+	for {
+		j, ok := p.next()
+		if !ok {
+			return
+		}
+
+		taskLagHistogramVec.WithLabelValues(j.task).Observe(millis(time.Since(j.queued)))
+		j.run()
+	}
+}
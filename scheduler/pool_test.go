@@ -0,0 +1,103 @@
+package scheduler
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPool_Fairness(t *testing.T) {
+	p := newPool(1)
+
+	var mx sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+
+	submit := func(sessionId string) {
+		wg.Add(1)
+		p.submit(sessionId, "task", func() {
+			mx.Lock()
+			order = append(order, sessionId)
+			mx.Unlock()
+			wg.Done()
+		})
+	}
+
+	// s1 queued more runs than s2 and s3, the sessions still take turns.
+	for i := 0; i < 4; i++ {
+		submit("s1")
+	}
+	submit("s2")
+	submit("s3")
+	submit("s2")
+
+	p.start()
+	wg.Wait()
+	p.stop()
+
+	assert.Equal(t, []string{"s1", "s2", "s3", "s1", "s2", "s1", "s1"}, order)
+}
+
+func TestPool_Concurrency(t *testing.T) {
+	p := newPool(2)
+	p.start()
+	defer p.stop()
+
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+
+	for i := 0; i < 3; i++ {
+		p.submit("s1", "task", func() {
+			started <- struct{}{}
+			<-release
+		})
+	}
+
+	<-started
+	<-started
+	select {
+	case <-started:
+		t.Fatal("more jobs running than workers")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	<-started
+}
+
+func TestPool_Stop(t *testing.T) {
+	p := newPool(1)
+	p.start()
+
+	block := make(chan struct{})
+	started := make(chan struct{})
+	p.submit("s1", "task", func() {
+		close(started)
+		<-block
+	})
+	<-started
+
+	ran := false
+	p.submit("s1", "task", func() { ran = true })
+
+	stopped := make(chan struct{})
+	go func() {
+		p.stop()
+		close(stopped)
+	}()
+
+	// The running job is waited for, the queued one is dropped.
+	assert.Eventually(t, func() bool {
+		p.mx.Lock()
+		defer p.mx.Unlock()
+		return p.stopped
+	}, time.Second, time.Millisecond)
+	close(block)
+	<-stopped
+
+	p.submit("s1", "task", func() { ran = true })
+
+	assert.False(t, ran)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"math/rand"
 	"regexp"
 	"sync"
 	"time"
@@ -16,17 +17,41 @@ import (
 
 type Task interface {
 	Name() string
+	// Schedule is how often the task runs unless the playground overrides
+	// it. Zero fields take the values of DefaultSchedule.
+	Schedule() types.TaskSchedule
 	Run(ctx context.Context, instance *types.Instance) error
 }
 
+// Unscheduler is implemented by the tasks that keep something about the
+// instances they run on, to drop it once an instance is no longer scheduled
+// by this replica, because it was deleted or another replica took over.
+type Unscheduler interface {
+	Unschedule(instance *types.Instance)
+}
+
+// How often the sessions are checked for idleness and expiry warnings.
+var sessionCheckInterval = 30 * time.Second
+
+var DefaultSchedule = types.TaskSchedule{Interval: time.Second, Timeout: 30 * time.Second}
+
 type SchedulerApi interface {
 	Start() error
 	Stop()
+	Leading() bool
+	Sessions() []ScheduledSession
+	Instances() []ScheduledInstance
+	PauseTask(instanceName, task string) error
+	ResumeTask(instanceName, task string) error
+	RunTask(instanceName, task string) error
+	UpdatePlaygrounds()
 }
 
 type scheduledSession struct {
-	session *types.Session
-	cancel  context.CancelFunc
+	session   *types.Session
+	cancel    context.CancelFunc
+	extended  chan time.Time
+	expiresAt time.Time
 }
 
 type scheduledInstance struct {
@@ -35,6 +60,11 @@ type scheduledInstance struct {
 	ticker       *time.Ticker
 	cancel       context.CancelFunc
 	fails        int
+	// Tasks to run right away.
+	triggered chan string
+
+	mx     sync.Mutex
+	status map[string]*TaskStatus
 }
 
 type scheduler struct {
@@ -49,10 +79,23 @@ type scheduler struct {
 	event              event.EventApi
 	pwd                pwd.PWDApi
 	mx                 sync.Mutex
+	pool               *pool
+	lock               Lock
+	leaseTTL           time.Duration
+	stopElection       chan struct{}
+	electionDone       chan struct{}
+	// Guards scheduledSessions, scheduledInstances and leading, event
+	// handlers run concurrently.
+	scheduledMx sync.Mutex
+	leading     bool
 }
 
-func NewScheduler(tasks []Task, s storage.StorageApi, e event.EventApi, p pwd.PWDApi) (*scheduler, error) {
-	sch := &scheduler{storage: s, event: e, pwd: p}
+// NewScheduler returns a scheduler that runs at most workers tasks at the same
+// time. With a lock, it only schedules anything while it holds the lock,
+// renewed for leaseTTL at a time, so a single one of the schedulers sharing
+// it runs. Without one, it always does.
+func NewScheduler(tasks []Task, s storage.StorageApi, e event.EventApi, p pwd.PWDApi, workers int, lock Lock, leaseTTL time.Duration) (*scheduler, error) {
+	sch := &scheduler{storage: s, event: e, pwd: p, pool: newPool(workers), lock: lock, leaseTTL: leaseTTL}
 
 	sch.tasks = make(map[string]Task)
 	sch.scheduledSessions = make(map[string]*scheduledSession)
@@ -130,45 +173,357 @@ func (s *scheduler) getTasks(playgroundId string) []Task {
 
 func (s *scheduler) processSession(ctx context.Context, ss *scheduledSession) {
 	defer s.unscheduleSession(ss.session)
-	select {
-	case <-time.After(time.Until(ss.session.ExpiresAt)):
-		// Session has expired. Need to close the session.
-		s.pwd.SessionClose(ss.session)
-		return
-	case <-ctx.Done():
+
+	expiresAt := ss.session.ExpiresAt
+	expiry := time.NewTimer(time.Until(expiresAt))
+	defer expiry.Stop()
+
+	check := time.NewTicker(sessionCheckInterval)
+	defer check.Stop()
+
+	var warned time.Duration
+
+	for {
+		select {
+		case <-expiry.C:
+			if wait, hibernated := s.hibernatedExpiry(ss.session); hibernated {
+				if wait > 0 {
+					expiry.Reset(wait)
+				}
+				continue
+			}
+
+			// Session has expired. Need to close the session.
+			s.pwd.SessionClose(ss.session)
+			return
+		case expiresAt = <-ss.extended:
+			expiry.Reset(time.Until(expiresAt))
+			warned = 0
+		case now := <-check.C:
+			warned = s.warnExpiry(ss.session.Id, ss.session.PlaygroundId, expiresAt, warned, now)
+			if s.reapIdle(ss.session.Id, ss.session.PlaygroundId, now) {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// hibernatedExpiry tells whether the expiry of a hibernated session is on hold
+// because its playground does not count hibernation against the lifetime. The
+// session is then only closed when the maximum lifetime is reached, the
+// returned duration being the time left until then, zero meaning it waits for
+// the session to be resumed.
+func (s *scheduler) hibernatedExpiry(session *types.Session) (time.Duration, bool) {
+	stored, err := s.storage.SessionGet(session.Id)
+	if err != nil || !stored.Hibernated {
+		return 0, false
+	}
+
+	s.mx.Lock()
+	playground := s.playgrounds[stored.PlaygroundId]
+	s.mx.Unlock()
+
+	if playground == nil || !playground.HibernationStopsExpiry {
+		return 0, false
+	}
+
+	if playground.MaxSessionLifetime <= 0 {
+		return 0, true
+	}
+
+	left := time.Until(stored.CreatedAt.Add(playground.MaxSessionLifetime))
+	if left <= 0 {
+		return 0, false
+	}
+
+	return left, true
+}
+
+// extendSession moves the expiry timer of the session to expiresAt.
+func (s *scheduler) extendSession(sessionId string, expiresAt time.Time) {
+	s.scheduledMx.Lock()
+	defer s.scheduledMx.Unlock()
+
+	ss, found := s.scheduledSessions[sessionId]
+	if !found {
 		return
 	}
+
+	ss.expiresAt = expiresAt
+
+	// Only the latest expiry matters.
+	select {
+	case <-ss.extended:
+	default:
+	}
+	ss.extended <- expiresAt
 }
 
+// warnExpiry emits a session expiring event once the session is within one
+// of the expiry warnings of its playground, closer than the one it was last
+// warned for. It returns the warning it was last warned for.
+func (s *scheduler) warnExpiry(sessionId, playgroundId string, expiresAt time.Time, warned time.Duration, now time.Time) time.Duration {
+	s.mx.Lock()
+	playground := s.playgrounds[playgroundId]
+	s.mx.Unlock()
+
+	if playground == nil || !now.Before(expiresAt) {
+		return warned
+	}
+
+	var closest time.Duration
+	for _, warning := range playground.ExpiryWarnings {
+		if warning > 0 && !now.Before(expiresAt.Add(-warning)) && (closest == 0 || warning < closest) {
+			closest = warning
+		}
+	}
+
+	if closest == 0 || (warned != 0 && closest >= warned) {
+		return warned
+	}
+
+	event.SessionExpiringEvent.Emit(s.event, sessionId, event.SessionExpiring{ExpiresAt: expiresAt})
+
+	return closest
+}
+
+// reapIdle closes the session if no client was connected to it for the idle
+// timeout of its playground. The clients are warned first and the session is
+// closed if none comes back within the grace period, or hibernated when its
+// playground asks for it. It returns whether the session was closed.
+func (s *scheduler) reapIdle(sessionId, playgroundId string, now time.Time) bool {
+	s.mx.Lock()
+	playground := s.playgrounds[playgroundId]
+	s.mx.Unlock()
+
+	if playground == nil || playground.IdleTimeout <= 0 {
+		return false
+	}
+
+	session, err := s.storage.SessionGet(sessionId)
+	if err != nil || session.Hibernated {
+		return false
+	}
+
+	clients, err := s.storage.ClientFindBySessionId(sessionId)
+	if err != nil {
+		log.Printf("Error finding clients of session %s. Got: %v\n", sessionId, err)
+		return false
+	}
+
+	// Clients without an expiry never expire, they are closed with their
+	// socket.
+	connected := false
+	for _, client := range clients {
+		if client.ExpiresAt.IsZero() || client.ExpiresAt.After(now) {
+			connected = true
+		}
+	}
+
+	lastActivity := session.LastActivity
+	if lastActivity.IsZero() {
+		lastActivity = session.CreatedAt
+	}
+
+	if connected || now.Sub(lastActivity) < playground.IdleTimeout {
+		if !session.IdleWarnedAt.IsZero() {
+			if err := s.storage.SessionIdleWarn(sessionId, time.Time{}); err != nil {
+				log.Printf("Error saving session %s. Got: %v\n", sessionId, err)
+			}
+		}
+
+		return false
+	}
+
+	if session.IdleWarnedAt.IsZero() {
+		if err := s.storage.SessionIdleWarn(sessionId, now); err != nil {
+			log.Printf("Error saving session %s. Got: %v\n", sessionId, err)
+			return false
+		}
+		session.IdleWarnedAt = now
+
+		event.SessionIdleEvent.Emit(s.event, sessionId, event.SessionIdle{ClosesAt: now.Add(playground.IdleGracePeriod)})
+	}
+
+	if now.Before(session.IdleWarnedAt.Add(playground.IdleGracePeriod)) {
+		return false
+	}
+
+	if playground.HibernateOnIdle {
+		log.Printf("Hibernating session %s, idle since %s\n", sessionId, lastActivity)
+		if err := s.pwd.SessionHibernate(session); err != nil {
+			log.Printf("Error hibernating idle session %s. Got: %v\n", sessionId, err)
+		}
+
+		return false
+	}
+
+	log.Printf("Closing session %s, idle since %s\n", sessionId, lastActivity)
+	if err := s.pwd.SessionClose(session); err != nil {
+		log.Printf("Error closing idle session %s. Got: %v\n", sessionId, err)
+		return false
+	}
+
+	return true
+}
+
+// getSchedule returns the schedule of task on the instances of a playground.
+func (s *scheduler) getSchedule(playgroundId string, task Task) types.TaskSchedule {
+	schedule := task.Schedule()
+
+	s.mx.Lock()
+	if playground, found := s.playgrounds[playgroundId]; found {
+		if override, found := playground.TaskSchedules[task.Name()]; found {
+			if override.Interval > 0 {
+				schedule.Interval = override.Interval
+			}
+			if override.Jitter > 0 {
+				schedule.Jitter = override.Jitter
+			}
+			if override.Timeout > 0 {
+				schedule.Timeout = override.Timeout
+			}
+		}
+	}
+	s.mx.Unlock()
+
+	if schedule.Interval <= 0 {
+		schedule.Interval = DefaultSchedule.Interval
+	}
+	if schedule.Timeout <= 0 {
+		schedule.Timeout = DefaultSchedule.Timeout
+	}
+
+	return schedule
+}
+
+func jitter(schedule types.TaskSchedule) time.Duration {
+	if schedule.Jitter <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(schedule.Jitter)))
+}
+
+func (s *scheduler) runTask(ctx context.Context, task Task, instance *types.Instance, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := task.Run(ctx, instance)
+	taskDurationHistogramVec.WithLabelValues(task.Name()).Observe(millis(time.Since(start)))
+
+	if err != nil {
+		taskErrorsCounterVec.WithLabelValues(task.Name()).Inc()
+		log.Printf("Error running task %s on instance %s. Got: %v\n", task.Name(), instance.Name, err)
+	}
+
+	return err
+}
+
+type taskRun struct {
+	name string
+	next time.Time
+}
+
+// processInstance submits the tasks of the instance to the worker pool, each
+// one on its own schedule, so slow tasks do not delay the others. A task never
+// runs twice at the same time on an instance.
 func (s *scheduler) processInstance(ctx context.Context, si *scheduledInstance) {
 	defer s.unscheduleInstance(si.instance)
+
+	next := map[string]time.Time{}
+	running := map[string]bool{}
+	finished := make(chan taskRun)
+
+	submit := func(task Task, schedule types.TaskSchedule) {
+		name := task.Name()
+
+		running[name] = true
+		si.update(name, func(status *TaskStatus) {
+			status.Running = true
+		})
+
+		s.pool.submit(si.instance.SessionId, name, func() {
+			if ctx.Err() != nil {
+				return
+			}
+
+			start := time.Now()
+			err := s.runTask(ctx, task, si.instance, schedule.Timeout)
+			si.update(name, func(status *TaskStatus) {
+				status.LastRun = start
+				status.Duration = time.Since(start)
+				status.LastError = ""
+				if err != nil {
+					status.LastError = err.Error()
+				}
+			})
+
+			select {
+			case finished <- taskRun{name: name, next: time.Now().Add(schedule.Interval + jitter(schedule))}:
+			case <-ctx.Done():
+			}
+		})
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			log.Printf("Processing tasks for instance %s has been canceled.\n", si.instance.Name)
 			return
-		default:
-			select {
-			case <-si.ticker.C:
-				// First check if instance still exists
-				_, err := s.storage.InstanceGet(si.instance.Name)
-				if err != nil {
-					if storage.NotFound(err) {
-						// Instance doesn't exists anymore. Unschedule.
-						log.Printf("Instance %s doesn't exists in storage.\n", si.instance.Name)
-						return
-					}
+		case run := <-finished:
+			delete(running, run.name)
+			next[run.name] = run.next
+			si.update(run.name, func(status *TaskStatus) {
+				status.Running = false
+				status.NextRun = run.next
+			})
+		case name := <-si.triggered:
+			// Runs even if paused, unless already running.
+			if task, found := s.tasks[name]; found && !running[name] {
+				submit(task, s.getSchedule(si.playgroundId, task))
+			}
+		case now := <-si.ticker.C:
+			// First check if instance still exists
+			instance, err := s.storage.InstanceGet(si.instance.Name)
+			if err != nil {
+				if storage.NotFound(err) {
+					// Instance doesn't exists anymore. Unschedule.
+					log.Printf("Instance %s doesn't exists in storage.\n", si.instance.Name)
+					return
+				}
+
+				log.Printf("Error retrieving instance %s from storage. Got: %v\n", si.instance.Name, err)
+				continue
+			}
+
+			if instance.Paused {
+				// The session is hibernated, its containers are frozen.
+				continue
+			}
 
-					log.Printf("Error retrieving instance %s from storage. Got: %v\n", si.instance.Name, err)
+			for _, task := range s.getTasks(si.playgroundId) {
+				name := task.Name()
+				if running[name] || now.Before(next[name]) || si.paused(name) {
 					continue
 				}
 
-				for _, task := range s.getTasks(si.playgroundId) {
-					err := task.Run(ctx, si.instance)
-					if err != nil {
-						log.Printf("Error running task %s on instance %s. Got: %v\n", task.Name(), si.instance.Name, err)
+				schedule := s.getSchedule(si.playgroundId, task)
+				if _, found := next[name]; !found {
+					// Spread the first runs of the instances started together.
+					next[name] = now.Add(jitter(schedule))
+					if now.Before(next[name]) {
+						si.update(name, func(status *TaskStatus) {
+							status.NextRun = next[name]
+						})
+						continue
 					}
 				}
+
+				submit(task, schedule)
 			}
 		}
 	}
@@ -184,6 +539,9 @@ func (s *scheduler) addTask(task Task) error {
 }
 
 func (s *scheduler) unscheduleSession(session *types.Session) {
+	s.scheduledMx.Lock()
+	defer s.scheduledMx.Unlock()
+
 	ss, found := s.scheduledSessions[session.Id]
 	if !found {
 		return
@@ -196,12 +554,19 @@ func (s *scheduler) unscheduleSession(session *types.Session) {
 }
 
 func (s *scheduler) scheduleSession(session *types.Session) {
+	s.scheduledMx.Lock()
+	defer s.scheduledMx.Unlock()
+
+	if !s.leading {
+		return
+	}
+
 	if _, found := s.scheduledSessions[session.Id]; found {
 		log.Printf("Session %s is already scheduled. Ignoring.\n", session.Id)
 		return
 	}
 
-	ss := &scheduledSession{session: session}
+	ss := &scheduledSession{session: session, extended: make(chan time.Time, 1), expiresAt: session.ExpiresAt}
 	s.scheduledSessions[session.Id] = ss
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -213,6 +578,9 @@ func (s *scheduler) scheduleSession(session *types.Session) {
 }
 
 func (s *scheduler) unscheduleInstance(instance *types.Instance) {
+	s.scheduledMx.Lock()
+	defer s.scheduledMx.Unlock()
+
 	si, found := s.scheduledInstances[instance.Name]
 	if !found {
 		return
@@ -223,16 +591,29 @@ func (s *scheduler) unscheduleInstance(instance *types.Instance) {
 
 	delete(s.scheduledInstances, si.instance.Name)
 
+	for _, task := range s.tasks {
+		if u, ok := task.(Unscheduler); ok {
+			u.Unschedule(si.instance)
+		}
+	}
+
 	log.Printf("Unscheduled instance %s\n", instance.Name)
 }
 
 func (s *scheduler) scheduleInstance(instance *types.Instance, playgroundId string) {
+	s.scheduledMx.Lock()
+	defer s.scheduledMx.Unlock()
+
+	if !s.leading {
+		return
+	}
+
 	if _, found := s.scheduledInstances[instance.Name]; found {
 		log.Printf("Instance %s is already scheduled. Ignoring.\n", instance.Name)
 		return
 	}
 
-	si := &scheduledInstance{instance: instance, playgroundId: playgroundId}
+	si := &scheduledInstance{instance: instance, playgroundId: playgroundId, triggered: make(chan string, 16), status: map[string]*TaskStatus{}}
 	s.scheduledInstances[instance.Name] = si
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -247,48 +628,31 @@ func (s *scheduler) scheduleInstance(instance *types.Instance, playgroundId stri
 
 func (s *scheduler) Stop() {
 	s.ticker.Stop()
-	for _, ss := range s.scheduledSessions {
-		s.unscheduleSession(ss.session)
-	}
 
-	for _, si := range s.scheduledInstances {
-		s.unscheduleInstance(si.instance)
-	}
-
-	s.started = false
-}
-
-func (s *scheduler) Start() error {
-	sessions, err := s.storage.SessionGetAll()
-	if err != nil {
-		return err
+	if s.lock != nil {
+		close(s.stopElection)
+		<-s.electionDone
 	}
 
-	for _, session := range sessions {
-		s.scheduleSession(session)
-		if _, found := s.playgrounds[session.PlaygroundId]; !found {
-			playground, err := s.storage.PlaygroundGet(session.PlaygroundId)
-			if err != nil {
-				return err
-			}
+	leading := s.isLeading()
+	s.follow()
 
-			s.playgrounds[playground.Id] = playground
+	if s.lock != nil && leading {
+		if err := s.lock.Release(); err != nil {
+			log.Printf("Error releasing the scheduler lock. Got: %v\n", err)
 		}
+	}
 
-		instances, err := s.storage.InstanceFindBySessionId(session.Id)
-		if err != nil {
-			return err
-		}
+	s.pool.stop()
 
-		for _, instance := range instances {
-			s.scheduleInstance(instance, session.PlaygroundId)
-		}
-	}
+	s.started = false
+}
 
+func (s *scheduler) Start() error {
 	// Refresh playground conf every 5 minutes
 	s.schedulePlaygroundsUpdate()
 
-	s.event.On(event.SESSION_NEW, func(sessionId string, args ...interface{}) {
+	event.SessionNewEvent.On(s.event, func(sessionId string, _ event.Empty) {
 		s.mx.Lock()
 		defer s.mx.Unlock()
 
@@ -312,14 +676,24 @@ func (s *scheduler) Start() error {
 		s.scheduleSession(session)
 	})
 
-	s.event.On(event.SESSION_END, func(sessionId string, args ...interface{}) {
+	event.SessionEndEvent.On(s.event, func(sessionId string, _ event.SessionEnd) {
 		log.Printf("EVENT: Session end %s\n", sessionId)
 		session := &types.Session{Id: sessionId}
 		s.unscheduleSession(session)
 	})
 
-	s.event.On(event.INSTANCE_NEW, func(sessionId string, args ...interface{}) {
-		instanceName := args[0].(string)
+	event.SessionExtendedEvent.On(s.event, func(sessionId string, payload event.SessionExtended) {
+		log.Printf("EVENT: Session extended %s\n", sessionId)
+		s.extendSession(sessionId, payload.ExpiresAt)
+	})
+
+	event.SessionResumedEvent.On(s.event, func(sessionId string, payload event.SessionResumed) {
+		log.Printf("EVENT: Session resumed %s\n", sessionId)
+		s.extendSession(sessionId, payload.ExpiresAt)
+	})
+
+	event.InstanceNewEvent.On(s.event, func(sessionId string, payload event.InstanceNew) {
+		instanceName := payload.Name
 		log.Printf("EVENT: Instance new %s\n", instanceName)
 
 		instance, err := s.storage.InstanceGet(instanceName)
@@ -337,14 +711,14 @@ func (s *scheduler) Start() error {
 		s.scheduleInstance(instance, session.PlaygroundId)
 	})
 
-	s.event.On(event.INSTANCE_DELETE, func(sessionId string, args ...interface{}) {
-		instanceName := args[0].(string)
+	event.InstanceDeleteEvent.On(s.event, func(sessionId string, payload event.InstanceDelete) {
+		instanceName := payload.Name
 		log.Printf("EVENT: Instance delete %s\n", instanceName)
 		instance := &types.Instance{Name: instanceName}
 		s.unscheduleInstance(instance)
 	})
 
-	s.event.On(event.PLAYGROUND_NEW, func(playgroundId string, args ...interface{}) {
+	event.PlaygroundNewEvent.On(s.event, func(playgroundId string, _ event.Empty) {
 		s.mx.Lock()
 
 		log.Printf("EVENT: Playground new %s\n", playgroundId)
@@ -356,7 +730,17 @@ func (s *scheduler) Start() error {
 		s.updatePlaygrounds()
 	})
 
+	s.pool.start()
+
 	s.started = true
 
+	if s.lock == nil {
+		return s.lead()
+	}
+
+	s.stopElection = make(chan struct{})
+	s.electionDone = make(chan struct{})
+	go s.elect(s.stopElection, s.electionDone)
+
 	return nil
 }
@@ -3,6 +3,7 @@ package scheduler
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/dimaskiddo/play-with-docker/event"
 	"github.com/dimaskiddo/play-with-docker/pwd"
@@ -12,12 +13,16 @@ import (
 )
 
 type fakeTask struct {
-	name string
+	name     string
+	schedule types.TaskSchedule
 }
 
 func (f fakeTask) Name() string {
 	return f.name
 }
+func (f fakeTask) Schedule() types.TaskSchedule {
+	return f.schedule
+}
 func (f fakeTask) Run(ctx context.Context, instance *types.Instance) error {
 	return nil
 }
@@ -34,7 +39,7 @@ func TestScheduler_getMatchedTasks(t *testing.T) {
 	_e := &event.Mock{}
 	_p := &pwd.Mock{}
 
-	s, err := NewScheduler(tasks, _s, _e, _p)
+	s, err := NewScheduler(tasks, _s, _e, _p, 1, nil, 0)
 	assert.Nil(t, err)
 
 	// No matches
@@ -56,3 +61,182 @@ func TestScheduler_getMatchedTasks(t *testing.T) {
 	assert.Subset(t, []Task{fakeTask{name: "docker_task1"}}, matched)
 	assert.Len(t, matched, 1)
 }
+
+func TestScheduler_getSchedule(t *testing.T) {
+	task := fakeTask{name: "docker_task1", schedule: types.TaskSchedule{Interval: 5 * time.Second, Jitter: time.Second}}
+
+	s, err := NewScheduler([]Task{task}, &storage.Mock{}, &event.Mock{}, &pwd.Mock{}, 1, nil, 0)
+	assert.Nil(t, err)
+
+	s.playgrounds["p1"] = &types.Playground{Id: "p1"}
+	s.playgrounds["p2"] = &types.Playground{Id: "p2", TaskSchedules: map[string]types.TaskSchedule{
+		"docker_task1": {Interval: time.Minute, Timeout: 10 * time.Second},
+	}}
+
+	// Unset fields take the defaults.
+	assert.Equal(t, types.TaskSchedule{Interval: 5 * time.Second, Jitter: time.Second, Timeout: DefaultSchedule.Timeout}, s.getSchedule("p1", task))
+	assert.Equal(t, types.TaskSchedule{Interval: time.Minute, Jitter: time.Second, Timeout: 10 * time.Second}, s.getSchedule("p2", task))
+	assert.Equal(t, DefaultSchedule, s.getSchedule("p1", fakeTask{name: "docker_task2"}))
+}
+
+func TestScheduler_reapIdle(t *testing.T) {
+	_s := &storage.Mock{}
+	_e := &event.Mock{}
+	_p := &pwd.Mock{}
+
+	s, err := NewScheduler(nil, _s, _e, _p, 1, nil, 0)
+	assert.Nil(t, err)
+
+	now := time.Now()
+	s.playgrounds["p1"] = &types.Playground{Id: "p1", IdleTimeout: time.Hour, IdleGracePeriod: 5 * time.Minute}
+
+	active := &types.Session{Id: "s1", PlaygroundId: "p1", LastActivity: now.Add(-time.Minute)}
+	_s.On("SessionGet", "s1").Return(active, nil)
+	_s.On("ClientFindBySessionId", "s1").Return([]*types.Client{}, nil)
+	assert.False(t, s.reapIdle("s1", "p1", now))
+
+	// A connected client keeps the session open, however old its activity.
+	connected := &types.Session{Id: "s2", PlaygroundId: "p1", LastActivity: now.Add(-2 * time.Hour)}
+	_s.On("SessionGet", "s2").Return(connected, nil)
+	_s.On("ClientFindBySessionId", "s2").Return([]*types.Client{{Id: "c1", SessionId: "s2", ExpiresAt: now.Add(time.Minute)}}, nil)
+	assert.False(t, s.reapIdle("s2", "p1", now))
+
+	// Clients never expire without a client TTL.
+	forever := &types.Session{Id: "s4", PlaygroundId: "p1", LastActivity: now.Add(-2 * time.Hour)}
+	_s.On("SessionGet", "s4").Return(forever, nil)
+	_s.On("ClientFindBySessionId", "s4").Return([]*types.Client{{Id: "c3", SessionId: "s4"}}, nil)
+	assert.False(t, s.reapIdle("s4", "p1", now))
+
+	idle := &types.Session{Id: "s3", PlaygroundId: "p1", LastActivity: now.Add(-2 * time.Hour)}
+	_s.On("SessionGet", "s3").Return(idle, nil)
+	_s.On("ClientFindBySessionId", "s3").Return([]*types.Client{{Id: "c2", SessionId: "s3", ExpiresAt: now.Add(-time.Minute)}}, nil)
+	_s.On("SessionIdleWarn", "s3", now).Return(nil)
+	_e.M.On("Emit", event.SESSION_IDLE, "s3", []interface{}{now.Add(5 * time.Minute)}).Return()
+
+	assert.False(t, s.reapIdle("s3", "p1", now))
+	assert.Equal(t, now, idle.IdleWarnedAt)
+
+	// Warned only once, then closed after the grace period.
+	assert.False(t, s.reapIdle("s3", "p1", now.Add(time.Minute)))
+	_p.On("SessionClose", idle).Return(nil)
+	assert.True(t, s.reapIdle("s3", "p1", now.Add(5*time.Minute)))
+
+	_s.AssertExpectations(t)
+	_e.M.AssertNumberOfCalls(t, "Emit", 1)
+	_p.AssertExpectations(t)
+}
+
+func TestScheduler_reapIdleHibernate(t *testing.T) {
+	_s := &storage.Mock{}
+	_e := &event.Mock{}
+	_p := &pwd.Mock{}
+
+	s, err := NewScheduler(nil, _s, _e, _p, 1, nil, 0)
+	assert.Nil(t, err)
+
+	now := time.Now()
+	s.playgrounds["p1"] = &types.Playground{Id: "p1", IdleTimeout: time.Hour, IdleGracePeriod: 5 * time.Minute, HibernateOnIdle: true}
+
+	idle := &types.Session{Id: "s1", PlaygroundId: "p1", LastActivity: now.Add(-2 * time.Hour), IdleWarnedAt: now.Add(-10 * time.Minute)}
+	_s.On("SessionGet", "s1").Return(idle, nil)
+	_s.On("ClientFindBySessionId", "s1").Return([]*types.Client{}, nil)
+	_p.On("SessionHibernate", idle).Return(nil)
+	assert.False(t, s.reapIdle("s1", "p1", now))
+
+	// Hibernated sessions are left alone.
+	hibernated := &types.Session{Id: "s2", PlaygroundId: "p1", LastActivity: now.Add(-2 * time.Hour), Hibernated: true}
+	_s.On("SessionGet", "s2").Return(hibernated, nil)
+	assert.False(t, s.reapIdle("s2", "p1", now))
+
+	_s.AssertExpectations(t)
+	_p.AssertExpectations(t)
+	_p.AssertNotCalled(t, "SessionClose", idle)
+}
+
+func TestScheduler_warnExpiry(t *testing.T) {
+	_s := &storage.Mock{}
+	_e := &event.Mock{}
+	_p := &pwd.Mock{}
+
+	s, err := NewScheduler(nil, _s, _e, _p, 1, nil, 0)
+	assert.Nil(t, err)
+
+	now := time.Now()
+	expiresAt := now.Add(time.Hour)
+	s.playgrounds["p1"] = &types.Playground{Id: "p1", ExpiryWarnings: []time.Duration{5 * time.Minute, 15 * time.Minute}}
+
+	_e.M.On("Emit", event.SESSION_EXPIRING, "s1", []interface{}{expiresAt}).Return()
+
+	assert.Equal(t, time.Duration(0), s.warnExpiry("s1", "p1", expiresAt, 0, now))
+	_e.M.AssertNumberOfCalls(t, "Emit", 0)
+
+	warned := s.warnExpiry("s1", "p1", expiresAt, 0, expiresAt.Add(-10*time.Minute))
+	assert.Equal(t, 15*time.Minute, warned)
+	_e.M.AssertNumberOfCalls(t, "Emit", 1)
+
+	// Each warning is emitted once.
+	warned = s.warnExpiry("s1", "p1", expiresAt, warned, expiresAt.Add(-9*time.Minute))
+	assert.Equal(t, 15*time.Minute, warned)
+	_e.M.AssertNumberOfCalls(t, "Emit", 1)
+
+	warned = s.warnExpiry("s1", "p1", expiresAt, warned, expiresAt.Add(-time.Minute))
+	assert.Equal(t, 5*time.Minute, warned)
+	_e.M.AssertNumberOfCalls(t, "Emit", 2)
+}
+
+func TestScheduler_controlTasks(t *testing.T) {
+	task := fakeTask{name: "docker_task1"}
+
+	s, err := NewScheduler([]Task{task}, &storage.Mock{}, &event.Mock{}, &pwd.Mock{}, 1, nil, 0)
+	assert.Nil(t, err)
+
+	s.playgroundTasks["p1"] = []Task{task}
+	si := &scheduledInstance{instance: &types.Instance{Name: "i1", SessionId: "s1"}, playgroundId: "p1", triggered: make(chan string, 1), status: map[string]*TaskStatus{}}
+	s.scheduledInstances["i1"] = si
+
+	assert.True(t, NotFound(s.PauseTask("i2", "docker_task1")))
+	assert.True(t, NotFound(s.PauseTask("i1", "docker_task2")))
+
+	assert.Nil(t, s.PauseTask("i1", "docker_task1"))
+	assert.True(t, si.paused("docker_task1"))
+	assert.Equal(t, []ScheduledInstance{{
+		Name:         "i1",
+		SessionId:    "s1",
+		PlaygroundId: "p1",
+		Tasks:        []TaskStatus{{Name: "docker_task1", Paused: true}},
+	}}, s.Instances())
+
+	assert.Nil(t, s.ResumeTask("i1", "docker_task1"))
+	assert.False(t, si.paused("docker_task1"))
+
+	assert.Nil(t, s.RunTask("i1", "docker_task1"))
+	assert.Nil(t, s.RunTask("i1", "docker_task1"))
+	assert.Equal(t, "docker_task1", <-si.triggered)
+	assert.Len(t, si.triggered, 0)
+}
+
+type unschedulerTask struct {
+	fakeTask
+	unscheduled []string
+}
+
+func (u *unschedulerTask) Unschedule(instance *types.Instance) {
+	u.unscheduled = append(u.unscheduled, instance.Name)
+}
+
+func TestScheduler_unscheduleInstance(t *testing.T) {
+	task := &unschedulerTask{fakeTask: fakeTask{name: "docker_task1"}}
+
+	s, err := NewScheduler([]Task{task}, &storage.Mock{}, &event.Mock{}, &pwd.Mock{}, 1, nil, 0)
+	assert.Nil(t, err)
+
+	_, cancel := context.WithCancel(context.Background())
+	s.scheduledInstances["i1"] = &scheduledInstance{instance: &types.Instance{Name: "i1"}, cancel: cancel, ticker: time.NewTicker(time.Second)}
+
+	// Standing by unschedules every instance.
+	s.follow()
+	assert.Equal(t, []string{"i1"}, task.unscheduled)
+
+	s.unscheduleInstance(&types.Instance{Name: "i1"})
+	assert.Equal(t, []string{"i1"}, task.unscheduled)
+}
@@ -0,0 +1,196 @@
+package scheduler
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+var (
+	instanceNotScheduled = errors.New("Instance is not scheduled")
+	taskNotMatched       = errors.New("Task does not run on the instance")
+)
+
+// NotFound reports whether e is about an instance that is not scheduled or a
+// task that does not run on it.
+func NotFound(e error) bool {
+	return e == instanceNotScheduled || e == taskNotMatched
+}
+
+type ScheduledSession struct {
+	Id           string    `json:"id"`
+	PlaygroundId string    `json:"playground_id"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+type ScheduledInstance struct {
+	Name         string       `json:"name"`
+	SessionId    string       `json:"session_id"`
+	PlaygroundId string       `json:"playground_id"`
+	Tasks        []TaskStatus `json:"tasks"`
+}
+
+// TaskStatus is the state of a task on an instance. Running is also set while
+// the task waits for a free worker.
+type TaskStatus struct {
+	Name      string        `json:"name"`
+	Paused    bool          `json:"paused"`
+	Running   bool          `json:"running"`
+	LastRun   time.Time     `json:"last_run"`
+	LastError string        `json:"last_error,omitempty"`
+	Duration  time.Duration `json:"duration"`
+	NextRun   time.Time     `json:"next_run"`
+}
+
+func (si *scheduledInstance) update(task string, fn func(status *TaskStatus)) {
+	si.mx.Lock()
+	defer si.mx.Unlock()
+
+	status, found := si.status[task]
+	if !found {
+		status = &TaskStatus{Name: task}
+		si.status[task] = status
+	}
+
+	fn(status)
+}
+
+func (si *scheduledInstance) paused(task string) bool {
+	si.mx.Lock()
+	defer si.mx.Unlock()
+
+	status, found := si.status[task]
+	return found && status.Paused
+}
+
+func (s *scheduler) Leading() bool {
+	return s.isLeading()
+}
+
+// Sessions returns the sessions scheduled by this replica, sorted by id.
+func (s *scheduler) Sessions() []ScheduledSession {
+	s.scheduledMx.Lock()
+	defer s.scheduledMx.Unlock()
+
+	sessions := []ScheduledSession{}
+	for _, ss := range s.scheduledSessions {
+		sessions = append(sessions, ScheduledSession{Id: ss.session.Id, PlaygroundId: ss.session.PlaygroundId, ExpiresAt: ss.expiresAt})
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Id < sessions[j].Id
+	})
+
+	return sessions
+}
+
+// Instances returns the instances scheduled by this replica, sorted by name,
+// with the tasks their playground matches.
+func (s *scheduler) Instances() []ScheduledInstance {
+	s.scheduledMx.Lock()
+	scheduled := make([]*scheduledInstance, 0, len(s.scheduledInstances))
+	for _, si := range s.scheduledInstances {
+		scheduled = append(scheduled, si)
+	}
+	s.scheduledMx.Unlock()
+
+	instances := []ScheduledInstance{}
+	for _, si := range scheduled {
+		instance := ScheduledInstance{Name: si.instance.Name, SessionId: si.instance.SessionId, PlaygroundId: si.playgroundId, Tasks: []TaskStatus{}}
+
+		tasks := s.getTasks(si.playgroundId)
+
+		si.mx.Lock()
+		for _, task := range tasks {
+			status := TaskStatus{Name: task.Name()}
+			if found, ok := si.status[task.Name()]; ok {
+				status = *found
+			}
+			instance.Tasks = append(instance.Tasks, status)
+		}
+		si.mx.Unlock()
+
+		sort.Slice(instance.Tasks, func(i, j int) bool {
+			return instance.Tasks[i].Name < instance.Tasks[j].Name
+		})
+
+		instances = append(instances, instance)
+	}
+
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].Name < instances[j].Name
+	})
+
+	return instances
+}
+
+// findTask returns the scheduled instance named instanceName if task runs on
+// it.
+func (s *scheduler) findTask(instanceName, task string) (*scheduledInstance, error) {
+	s.scheduledMx.Lock()
+	si, found := s.scheduledInstances[instanceName]
+	s.scheduledMx.Unlock()
+
+	if !found {
+		return nil, instanceNotScheduled
+	}
+
+	for _, t := range s.getTasks(si.playgroundId) {
+		if t.Name() == task {
+			return si, nil
+		}
+	}
+
+	return nil, taskNotMatched
+}
+
+// PauseTask stops the scheduled runs of task on the instance until it is
+// resumed.
+func (s *scheduler) PauseTask(instanceName, task string) error {
+	si, err := s.findTask(instanceName, task)
+	if err != nil {
+		return err
+	}
+
+	si.update(task, func(status *TaskStatus) {
+		status.Paused = true
+	})
+
+	return nil
+}
+
+func (s *scheduler) ResumeTask(instanceName, task string) error {
+	si, err := s.findTask(instanceName, task)
+	if err != nil {
+		return err
+	}
+
+	si.update(task, func(status *TaskStatus) {
+		status.Paused = false
+	})
+
+	return nil
+}
+
+// RunTask runs task on the instance as soon as a worker is free, even if it
+// is paused. Nothing happens if it is already running.
+func (s *scheduler) RunTask(instanceName, task string) error {
+	si, err := s.findTask(instanceName, task)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case si.triggered <- task:
+	default:
+		// Enough runs are already pending.
+	}
+
+	return nil
+}
+
+// UpdatePlaygrounds reloads the playgrounds and the tasks they match now,
+// instead of waiting for the next periodic reload.
+func (s *scheduler) UpdatePlaygrounds() {
+	s.updatePlaygrounds()
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/dimaskiddo/play-with-docker/event"
 	"github.com/dimaskiddo/play-with-docker/k8s"
@@ -17,15 +18,21 @@ type checkK8sClusterExposedPortsTask struct {
 }
 
 var CheckK8sClusterExpoedPortsEvent event.EventType
+var K8sClusterPortsEvent event.Typed[ClusterPorts]
 
 func init() {
 	CheckK8sClusterExpoedPortsEvent = event.EventType("instance k8s cluster ports")
+	K8sClusterPortsEvent = event.Register[ClusterPorts](CheckK8sClusterExpoedPortsEvent, 1, event.Single)
 }
 
 func (t *checkK8sClusterExposedPortsTask) Name() string {
 	return "CheckK8sClusterPorts"
 }
 
+func (t *checkK8sClusterExposedPortsTask) Schedule() types.TaskSchedule {
+	return types.TaskSchedule{Interval: 10 * time.Second, Jitter: 2 * time.Second, Timeout: 10 * time.Second}
+}
+
 func NewCheckK8sClusterExposedPorts(e event.EventApi, f k8s.FactoryApi) *checkK8sClusterExposedPortsTask {
 	return &checkK8sClusterExposedPortsTask{event: e, factory: f}
 }
@@ -81,7 +88,7 @@ func (c checkK8sClusterExposedPortsTask) Run(ctx context.Context, i *types.Insta
 		instances = append(instances, node.Name)
 	}
 
-	c.event.Emit(CheckSwarmPortsEvent, i.SessionId, ClusterPorts{Manager: i.Name, Instances: instances, Ports: exposedPorts})
+	K8sClusterPortsEvent.Emit(c.event, i.SessionId, ClusterPorts{Manager: i.Name, Instances: instances, Ports: exposedPorts})
 
 	return nil
 }
@@ -3,6 +3,7 @@ package task
 import (
 	"context"
 	"strings"
+	"time"
 
 	"github.com/dimaskiddo/play-with-docker/event"
 	"github.com/dimaskiddo/play-with-docker/k8s"
@@ -15,9 +16,11 @@ type checkK8sClusterStatusTask struct {
 }
 
 var CheckK8sStatusEvent event.EventType
+var K8sStatusEvent event.Typed[ClusterStatus]
 
 func init() {
 	CheckK8sStatusEvent = event.EventType("instance k8s status")
+	K8sStatusEvent = event.Register[ClusterStatus](CheckK8sStatusEvent, 1, event.Single)
 }
 
 func NewCheckK8sClusterStatus(e event.EventApi, f k8s.FactoryApi) *checkK8sClusterStatusTask {
@@ -28,6 +31,10 @@ func (c *checkK8sClusterStatusTask) Name() string {
 	return "CheckK8sClusterStatus"
 }
 
+func (c *checkK8sClusterStatusTask) Schedule() types.TaskSchedule {
+	return types.TaskSchedule{Interval: 10 * time.Second, Jitter: 2 * time.Second, Timeout: 10 * time.Second}
+}
+
 func (c checkK8sClusterStatusTask) Run(ctx context.Context, i *types.Instance) error {
 	// Skip if this is not a Kubernetes instance (e.g., regular Docker Swarm)
 	// We identify this by checking if the image contains "k8s" or if the kubelet is available
@@ -45,7 +52,7 @@ func (c checkK8sClusterStatusTask) Run(ctx context.Context, i *types.Instance) e
 	}
 
 	if isManager, err := kc.IsManager(); err != nil {
-		c.event.Emit(CheckSwarmStatusEvent, i.SessionId, status)
+		K8sStatusEvent.Emit(c.event, i.SessionId, status)
 		return err
 	} else if !isManager {
 		status.IsWorker = true
@@ -53,7 +60,7 @@ func (c checkK8sClusterStatusTask) Run(ctx context.Context, i *types.Instance) e
 		status.IsManager = true
 	}
 
-	c.event.Emit(CheckK8sStatusEvent, i.SessionId, status)
+	K8sStatusEvent.Emit(c.event, i.SessionId, status)
 
 	return nil
 }
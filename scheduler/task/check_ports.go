@@ -3,6 +3,7 @@ package task
 import (
 	"context"
 	"log"
+	"time"
 
 	"github.com/dimaskiddo/play-with-docker/docker"
 	"github.com/dimaskiddo/play-with-docker/event"
@@ -20,15 +21,21 @@ type checkPorts struct {
 }
 
 var CheckPortsEvent event.EventType
+var DockerPortsEvent event.Typed[DockerPorts]
 
 func init() {
 	CheckPortsEvent = event.EventType("instance docker ports")
+	DockerPortsEvent = event.Register[DockerPorts](CheckPortsEvent, 1, event.Single)
 }
 
 func (t *checkPorts) Name() string {
 	return "CheckPorts"
 }
 
+func (t *checkPorts) Schedule() types.TaskSchedule {
+	return types.TaskSchedule{Interval: 2 * time.Second, Jitter: 500 * time.Millisecond, Timeout: 10 * time.Second}
+}
+
 func (t *checkPorts) Run(ctx context.Context, instance *types.Instance) error {
 	dockerClient, err := t.factory.GetForInstance(instance)
 	if err != nil {
@@ -36,7 +43,7 @@ func (t *checkPorts) Run(ctx context.Context, instance *types.Instance) error {
 		return err
 	}
 
-	ps, err := dockerClient.GetPorts()
+	ps, err := dockerClient.GetPorts(ctx)
 	if err != nil {
 		log.Println(err)
 		return err
@@ -47,7 +54,7 @@ func (t *checkPorts) Run(ctx context.Context, instance *types.Instance) error {
 		ports[i] = int(port)
 	}
 
-	t.event.Emit(CheckPortsEvent, instance.SessionId, DockerPorts{Instance: instance.Name, Ports: ports})
+	DockerPortsEvent.Emit(t.event, instance.SessionId, DockerPorts{Instance: instance.Name, Ports: ports})
 
 	return nil
 }
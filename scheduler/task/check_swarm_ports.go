@@ -3,6 +3,7 @@ package task
 import (
 	"context"
 	"log"
+	"time"
 
 	"github.com/dimaskiddo/play-with-docker/docker"
 	"github.com/dimaskiddo/play-with-docker/event"
@@ -15,15 +16,21 @@ type checkSwarmPorts struct {
 }
 
 var CheckSwarmPortsEvent event.EventType
+var SwarmPortsEvent event.Typed[ClusterPorts]
 
 func init() {
 	CheckSwarmPortsEvent = event.EventType("instance docker swarm ports")
+	SwarmPortsEvent = event.Register[ClusterPorts](CheckSwarmPortsEvent, 1, event.Single)
 }
 
 func (t *checkSwarmPorts) Name() string {
 	return "CheckSwarmPorts"
 }
 
+func (t *checkSwarmPorts) Schedule() types.TaskSchedule {
+	return types.TaskSchedule{Interval: 5 * time.Second, Jitter: time.Second, Timeout: 10 * time.Second}
+}
+
 func (t *checkSwarmPorts) Run(ctx context.Context, instance *types.Instance) error {
 	dockerClient, err := t.factory.GetForInstance(instance)
 	if err != nil {
@@ -41,7 +48,7 @@ func (t *checkSwarmPorts) Run(ctx context.Context, instance *types.Instance) err
 		return nil
 	}
 
-	hosts, ps, err := dockerClient.GetSwarmPorts()
+	hosts, ps, err := dockerClient.GetSwarmPorts(ctx)
 	if err != nil {
 		log.Println(err)
 		return err
@@ -52,7 +59,7 @@ func (t *checkSwarmPorts) Run(ctx context.Context, instance *types.Instance) err
 		ports[i] = int(port)
 	}
 
-	t.event.Emit(CheckSwarmPortsEvent, instance.SessionId, ClusterPorts{Manager: instance.Name, Instances: hosts, Ports: ports})
+	SwarmPortsEvent.Emit(t.event, instance.SessionId, ClusterPorts{Manager: instance.Name, Instances: hosts, Ports: ports})
 
 	return nil
 }
@@ -3,6 +3,7 @@ package task
 import (
 	"context"
 	"log"
+	"time"
 
 	"github.com/dimaskiddo/play-with-docker/docker"
 	"github.com/dimaskiddo/play-with-docker/event"
@@ -16,15 +17,21 @@ type checkSwarmStatus struct {
 }
 
 var CheckSwarmStatusEvent event.EventType
+var SwarmStatusEvent event.Typed[ClusterStatus]
 
 func init() {
 	CheckSwarmStatusEvent = event.EventType("instance docker swarm status")
+	SwarmStatusEvent = event.Register[ClusterStatus](CheckSwarmStatusEvent, 1, event.Single)
 }
 
 func (t *checkSwarmStatus) Name() string {
 	return "CheckSwarmStatus"
 }
 
+func (t *checkSwarmStatus) Schedule() types.TaskSchedule {
+	return types.TaskSchedule{Interval: 5 * time.Second, Jitter: time.Second, Timeout: 10 * time.Second}
+}
+
 func (t *checkSwarmStatus) Run(ctx context.Context, instance *types.Instance) error {
 	dockerClient, err := t.factory.GetForInstance(instance)
 	if err != nil {
@@ -40,7 +47,7 @@ func (t *checkSwarmStatus) Run(ctx context.Context, instance *types.Instance) er
 
 	status.Instance = instance.Name
 
-	t.event.Emit(CheckSwarmStatusEvent, instance.SessionId, status)
+	SwarmStatusEvent.Emit(t.event, instance.SessionId, status)
 
 	return nil
 }
@@ -8,6 +8,8 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/dimaskiddo/play-with-docker/docker"
@@ -18,12 +20,97 @@ import (
 	dockerTypes "github.com/docker/docker/api/types"
 	units "github.com/docker/go-units"
 	lru "github.com/hashicorp/golang-lru"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
+// InstanceStats is a sample of the resource usage of an instance. Mem and Cpu
+// are the legacy display strings, the other fields hold the raw values.
 type InstanceStats struct {
 	Instance string `json:"instance"`
 	Mem      string `json:"mem"`
 	Cpu      string `json:"cpu"`
+
+	// Fraction of the allocated CPUs in use, 1 when all of them are busy.
+	CpuFraction  float64 `json:"cpu_fraction"`
+	CpuAllocated float64 `json:"cpu_allocated"`
+	MemUsage     uint64  `json:"mem_usage"`
+	MemLimit     uint64  `json:"mem_limit"`
+	NetRx        uint64  `json:"net_rx"`
+	NetTx        uint64  `json:"net_tx"`
+	BlkRead      uint64  `json:"blkio_read"`
+	BlkWrite     uint64  `json:"blkio_write"`
+	Pids         uint64  `json:"pids"`
+}
+
+var (
+	instanceLabels = []string{"session", "playground", "instance"}
+
+	instanceCpuDesc          = prometheus.NewDesc("pwd_instance_cpu_fraction", "Fraction of the allocated CPUs used by an instance", instanceLabels, nil)
+	instanceCpuAllocatedDesc = prometheus.NewDesc("pwd_instance_cpu_allocated", "CPUs allocated to an instance", instanceLabels, nil)
+	instanceMemUsageDesc     = prometheus.NewDesc("pwd_instance_memory_usage_bytes", "Memory used by an instance", instanceLabels, nil)
+	instanceMemLimitDesc     = prometheus.NewDesc("pwd_instance_memory_limit_bytes", "Memory limit of an instance", instanceLabels, nil)
+	instanceNetRxDesc        = prometheus.NewDesc("pwd_instance_network_receive_bytes_total", "Bytes received by an instance since it started", instanceLabels, nil)
+	instanceNetTxDesc        = prometheus.NewDesc("pwd_instance_network_transmit_bytes_total", "Bytes sent by an instance since it started", instanceLabels, nil)
+	instanceBlkReadDesc      = prometheus.NewDesc("pwd_instance_blkio_read_bytes_total", "Bytes read from block devices by an instance since it started", instanceLabels, nil)
+	instanceBlkWriteDesc     = prometheus.NewDesc("pwd_instance_blkio_write_bytes_total", "Bytes written to block devices by an instance since it started", instanceLabels, nil)
+	instancePidsDesc         = prometheus.NewDesc("pwd_instance_pids", "Processes running in an instance", instanceLabels, nil)
+
+	instanceMetrics = &instanceCollector{samples: map[string]instanceSample{}}
+)
+
+type instanceSample struct {
+	labels []string
+	stats  InstanceStats
+}
+
+// instanceCollector exports the last stats collected from each instance
+// scheduled by this replica. Docker counts the network and block I/O bytes
+// since the container started, so they are exported as counters.
+type instanceCollector struct {
+	mx      sync.Mutex
+	samples map[string]instanceSample
+}
+
+func (c *instanceCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{instanceCpuDesc, instanceCpuAllocatedDesc, instanceMemUsageDesc, instanceMemLimitDesc, instanceNetRxDesc, instanceNetTxDesc, instanceBlkReadDesc, instanceBlkWriteDesc, instancePidsDesc} {
+		ch <- desc
+	}
+}
+
+func (c *instanceCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	for _, sample := range c.samples {
+		stats := sample.stats
+
+		ch <- prometheus.MustNewConstMetric(instanceCpuDesc, prometheus.GaugeValue, stats.CpuFraction, sample.labels...)
+		ch <- prometheus.MustNewConstMetric(instanceCpuAllocatedDesc, prometheus.GaugeValue, stats.CpuAllocated, sample.labels...)
+		ch <- prometheus.MustNewConstMetric(instanceMemUsageDesc, prometheus.GaugeValue, float64(stats.MemUsage), sample.labels...)
+		ch <- prometheus.MustNewConstMetric(instanceMemLimitDesc, prometheus.GaugeValue, float64(stats.MemLimit), sample.labels...)
+		ch <- prometheus.MustNewConstMetric(instanceNetRxDesc, prometheus.CounterValue, float64(stats.NetRx), sample.labels...)
+		ch <- prometheus.MustNewConstMetric(instanceNetTxDesc, prometheus.CounterValue, float64(stats.NetTx), sample.labels...)
+		ch <- prometheus.MustNewConstMetric(instanceBlkReadDesc, prometheus.CounterValue, float64(stats.BlkRead), sample.labels...)
+		ch <- prometheus.MustNewConstMetric(instanceBlkWriteDesc, prometheus.CounterValue, float64(stats.BlkWrite), sample.labels...)
+		ch <- prometheus.MustNewConstMetric(instancePidsDesc, prometheus.GaugeValue, float64(stats.Pids), sample.labels...)
+	}
+}
+
+// observe keeps the stats of the instance to export them.
+func (c *instanceCollector) observe(session *types.Session, stats InstanceStats) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	c.samples[stats.Instance] = instanceSample{labels: []string{session.Id, session.PlaygroundId, stats.Instance}, stats: stats}
+}
+
+// forget drops the stats of an instance, so its series are no longer
+// exported.
+func (c *instanceCollector) forget(instance string) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	delete(c.samples, instance)
 }
 
 type collectStats struct {
@@ -35,19 +122,46 @@ type collectStats struct {
 }
 
 var CollectStatsEvent event.EventType
+var InstanceStatsEvent event.Typed[InstanceStats]
 
 func init() {
 	CollectStatsEvent = event.EventType("instance stats")
+	InstanceStatsEvent = event.Register[InstanceStats](CollectStatsEvent, 1, event.Single)
+
+	prometheus.MustRegister(instanceMetrics)
 }
 
 func (t *collectStats) Name() string {
 	return "CollectStats"
 }
 
+// Unschedule stops exporting the stats of the instance, as they are no longer
+// collected here.
+func (t *collectStats) Unschedule(instance *types.Instance) {
+	instanceMetrics.forget(instance.Name)
+}
+
+func (t *collectStats) Schedule() types.TaskSchedule {
+	return types.TaskSchedule{Interval: 5 * time.Second, Jitter: time.Second, Timeout: 15 * time.Second}
+}
+
 func (t *collectStats) Run(ctx context.Context, instance *types.Instance) error {
+	var session *types.Session
+	if sess, found := t.cache.Get(instance.SessionId); !found {
+		s, err := t.storage.SessionGet(instance.SessionId)
+		if err != nil {
+			return err
+		}
+
+		t.cache.Add(s.Id, s)
+		session = s
+	} else {
+		session = sess.(*types.Session)
+	}
+
 	if instance.Type == "windows" {
 		host := router.EncodeHost(instance.SessionId, instance.IP, router.HostOpts{EncodedPort: 222})
-		req, err := http.NewRequest("GET", fmt.Sprintf("http://%s/stats", host), nil)
+		req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("http://%s/stats", host), nil)
 		if err != nil {
 			log.Printf("Could not create request to get stats of windows instance with IP %s. Got: %v\n", instance.IP, err)
 			return fmt.Errorf("Could not create request to get stats of windows instance with IP %s. Got: %v\n", instance.IP, err)
@@ -76,38 +190,29 @@ func (t *collectStats) Run(ctx context.Context, instance *types.Instance) error
 		stats := InstanceStats{Instance: instance.Name}
 		stats.Mem = fmt.Sprintf("%.2f%% (%s / %s)", ((info["mem_used"] / info["mem_total"]) * 100), units.BytesSize(info["mem_used"]), units.BytesSize(info["mem_total"]))
 		stats.Cpu = fmt.Sprintf("%.2f%%", info["cpu"]*100)
+		stats.CpuFraction = info["cpu"]
+		stats.MemUsage = uint64(info["mem_used"])
+		stats.MemLimit = uint64(info["mem_total"])
 
-		t.event.Emit(CollectStatsEvent, instance.SessionId, stats)
+		t.emit(ctx, session, stats)
 
 		return nil
 	}
 
-	var session *types.Session
-	if sess, found := t.cache.Get(instance.SessionId); !found {
-		s, err := t.storage.SessionGet(instance.SessionId)
-		if err != nil {
-			return err
-		}
-
-		t.cache.Add(s.Id, s)
-		session = s
-	} else {
-		session = sess.(*types.Session)
-	}
-
 	dockerClient, err := t.factory.GetForSession(session)
 	if err != nil {
 		log.Println(err)
 		return err
 	}
 
-	reader, err := dockerClient.ContainerStats(instance.Name)
+	reader, err := dockerClient.ContainerStats(ctx, instance.Name)
 	if err != nil {
 		log.Println("Error while trying to collect instance stats", err)
 		return err
 	}
 
 	defer reader.Close()
+
 	dec := json.NewDecoder(reader)
 
 	var v1 *dockerTypes.StatsJSON
@@ -145,11 +250,10 @@ func (t *collectStats) Run(ctx context.Context, instance *types.Instance) error
 		}
 	}
 
-	// Get container inspect to find the NanoCPUs limit
-	containerJSON, err := dockerClient.GetClient().ContainerInspect(context.Background(), instance.Name)
+	// Get the CPUs limit of the container
 	var allocatedCPUs float64 = numCPUs // default to system CPUs
-	if err == nil && containerJSON.HostConfig.NanoCPUs > 0 {
-		allocatedCPUs = float64(containerJSON.HostConfig.NanoCPUs) / 1e9
+	if cpus, err := dockerClient.ContainerCPUs(ctx, instance.Name); err == nil && cpus > 0 {
+		allocatedCPUs = cpus
 	}
 
 	previousCPU := v.PreCPUStats.CPUUsage.TotalUsage
@@ -171,12 +275,43 @@ func (t *collectStats) Run(ctx context.Context, instance *types.Instance) error
 	// 	instance.Name, cpuDelta, systemDelta, numCPUs, cpuPercent, allocatedCPUs, percentOfAllocated)
 
 	stats.Cpu = fmt.Sprintf("%.1f%% (%.2f / %.1f CPUs)", percentOfAllocated, cpuUsage, allocatedCPUs)
+	stats.CpuFraction = percentOfAllocated / 100.0
+	stats.CpuAllocated = allocatedCPUs
+	stats.MemUsage = v.MemoryStats.Usage
+	stats.MemLimit = v.MemoryStats.Limit
+
+	// Network and block I/O are counted since the container started.
+	for _, network := range v.Networks {
+		stats.NetRx += network.RxBytes
+		stats.NetTx += network.TxBytes
+	}
+	for _, entry := range v.BlkioStats.IoServiceBytesRecursive {
+		// cgroup v1 capitalizes the operations, v2 does not.
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			stats.BlkRead += entry.Value
+		case "write":
+			stats.BlkWrite += entry.Value
+		}
+	}
+	stats.Pids = v.PidsStats.Current
 
-	t.event.Emit(CollectStatsEvent, instance.SessionId, stats)
+	t.emit(ctx, session, stats)
 
 	return nil
 }
 
+// emit exports and sends the stats, unless the instance was unscheduled
+// while they were collected.
+func (t *collectStats) emit(ctx context.Context, session *types.Session, stats InstanceStats) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	instanceMetrics.observe(session, stats)
+	InstanceStatsEvent.Emit(t.event, session.Id, stats)
+}
+
 func proxyHost(r *http.Request) (*url.URL, error) {
 	if r.Header.Get("X-Proxy-Host") == "" {
 		return nil, nil
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"io"
+	"strings"
 	"testing"
 
 	"github.com/dimaskiddo/play-with-docker/docker"
@@ -12,6 +13,7 @@ import (
 	"github.com/dimaskiddo/play-with-docker/pwd/types"
 	"github.com/dimaskiddo/play-with-docker/storage"
 	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -50,8 +52,30 @@ func TestCollectStats_Run(t *testing.T) {
 	f := &docker.FactoryMock{}
 	s := &storage.Mock{}
 
-	stats := dockerTypes.StatsJSON{}
-	b, _ := json.Marshal(stats)
+	first := dockerTypes.StatsJSON{}
+	second := dockerTypes.StatsJSON{}
+	second.PreCPUStats.CPUUsage.TotalUsage = 100
+	second.PreCPUStats.SystemUsage = 1000
+	second.CPUStats.CPUUsage.TotalUsage = 300
+	second.CPUStats.SystemUsage = 2000
+	second.CPUStats.OnlineCPUs = 4
+	second.MemoryStats.Usage = 512 * 1024 * 1024
+	second.MemoryStats.Limit = 1024 * 1024 * 1024
+	second.Networks = map[string]dockerTypes.NetworkStats{
+		"eth0": {RxBytes: 100, TxBytes: 200},
+		"eth1": {RxBytes: 10, TxBytes: 20},
+	}
+	second.BlkioStats.IoServiceBytesRecursive = []dockerTypes.BlkioStatEntry{
+		{Op: "Read", Value: 300},
+		{Op: "write", Value: 400},
+	}
+	second.PidsStats.Current = 7
+
+	// Docker streams one sample after the other.
+	b := &bytes.Buffer{}
+	json.NewEncoder(b).Encode(first)
+	json.NewEncoder(b).Encode(second)
+
 	i := &types.Instance{
 		IP:        "10.0.0.1",
 		Name:      "aaaabbbb_node1",
@@ -60,13 +84,19 @@ func TestCollectStats_Run(t *testing.T) {
 	}
 
 	sess := &types.Session{
-		Id: "aaaabbbbcccc",
+		Id:           "aaaabbbbcccc",
+		PlaygroundId: "foobar",
 	}
 
+	var emitted InstanceStats
+
 	s.On("SessionGet", i.SessionId).Return(sess, nil)
 	f.On("GetForSession", sess).Return(d, nil)
-	d.On("ContainerStats", i.Name).Return(nopCloser{bytes.NewReader(b)}, nil)
-	e.M.On("Emit", CollectStatsEvent, "aaaabbbbcccc", []interface{}{InstanceStats{Instance: i.Name, Mem: "0.00% (0B / 0B)", Cpu: "0.00%"}}).Return()
+	d.On("ContainerStats", i.Name).Return(nopCloser{b}, nil)
+	d.On("ContainerCPUs", i.Name).Return(2.0, nil)
+	e.M.On("Emit", CollectStatsEvent, "aaaabbbbcccc", mock.Anything).Run(func(args mock.Arguments) {
+		emitted = args.Get(2).([]interface{})[0].(InstanceStats)
+	}).Return()
 
 	task := NewCollectStats(e, f, s)
 	ctx := context.Background()
@@ -74,6 +104,30 @@ func TestCollectStats_Run(t *testing.T) {
 	err := task.Run(ctx, i)
 
 	assert.Nil(t, err)
+	assert.Equal(t, i.Name, emitted.Instance)
+	assert.Equal(t, "40.0% (0.80 / 2.0 CPUs)", emitted.Cpu)
+	assert.Equal(t, "50.00% (512MiB / 1GiB)", emitted.Mem)
+	assert.InDelta(t, 0.4, emitted.CpuFraction, 1e-9)
+	assert.Equal(t, 2.0, emitted.CpuAllocated)
+	assert.Equal(t, uint64(512*1024*1024), emitted.MemUsage)
+	assert.Equal(t, uint64(1024*1024*1024), emitted.MemLimit)
+	assert.Equal(t, uint64(110), emitted.NetRx)
+	assert.Equal(t, uint64(220), emitted.NetTx)
+	assert.Equal(t, uint64(300), emitted.BlkRead)
+	assert.Equal(t, uint64(400), emitted.BlkWrite)
+	assert.Equal(t, uint64(7), emitted.Pids)
+
+	expected := `
+# HELP pwd_instance_network_receive_bytes_total Bytes received by an instance since it started
+# TYPE pwd_instance_network_receive_bytes_total counter
+pwd_instance_network_receive_bytes_total{instance="aaaabbbb_node1",playground="foobar",session="aaaabbbbcccc"} 110
+`
+	assert.Nil(t, testutil.CollectAndCompare(instanceMetrics, strings.NewReader(expected), "pwd_instance_network_receive_bytes_total"))
+
+	// Instances no longer scheduled here are not exported.
+	task.Unschedule(i)
+	assert.Equal(t, 0, testutil.CollectAndCount(instanceMetrics))
+
 	d.AssertExpectations(t)
 	e.M.AssertExpectations(t)
 	f.AssertExpectations(t)
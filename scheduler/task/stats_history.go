@@ -0,0 +1,190 @@
+package task
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dimaskiddo/play-with-docker/event"
+	"github.com/dimaskiddo/play-with-docker/pwd/types"
+)
+
+// endedRetention is how long the stats of a session are ignored after it
+// ended. The events are delivered by separate handlers, so stats collected
+// before the end can still arrive after it.
+var endedRetention = 10 * time.Minute
+
+// StatsSample is the stats of an instance collected at Time.
+type StatsSample struct {
+	Time time.Time `json:"time"`
+	InstanceStats
+}
+
+// StatsHistory keeps the last stats of each instance, so that a client can
+// draw them as soon as it opens the session, and the usage of each session
+// until it ends.
+type StatsHistory struct {
+	size int
+
+	mx        sync.Mutex
+	instances map[string]*instanceHistory
+	// Usage of the instances of each session that were already deleted.
+	deleted map[string]*types.SessionUsage
+	// When each session ended, its late stats are not recorded.
+	ended map[string]time.Time
+}
+
+type instanceHistory struct {
+	sessionId string
+	// Ring of the last samples, the nth one is at (n-1) % size.
+	samples []StatsSample
+	last    uint64
+	usage   types.SessionUsage
+}
+
+// NewStatsHistory records the instance stats emitted on e, keeping the last
+// size samples of each instance.
+func NewStatsHistory(e event.EventApi, size int) *StatsHistory {
+	if size < 1 {
+		size = 1
+	}
+
+	h := &StatsHistory{size: size, instances: map[string]*instanceHistory{}, deleted: map[string]*types.SessionUsage{}, ended: map[string]time.Time{}}
+
+	InstanceStatsEvent.On(e, func(sessionId string, stats InstanceStats) {
+		h.record(sessionId, stats, time.Now())
+	})
+	event.InstanceDeleteEvent.On(e, func(sessionId string, payload event.InstanceDelete) {
+		h.forgetInstance(sessionId, payload.Name)
+	})
+	event.SessionEndEvent.On(e, func(sessionId string, _ event.SessionEnd) {
+		h.forgetSession(sessionId, time.Now())
+	})
+
+	return h
+}
+
+func (h *StatsHistory) record(sessionId string, stats InstanceStats, now time.Time) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	if _, ended := h.ended[sessionId]; ended {
+		return
+	}
+
+	i, found := h.instances[stats.Instance]
+	if !found || i.sessionId != sessionId {
+		i = &instanceHistory{sessionId: sessionId, samples: make([]StatsSample, h.size)}
+		h.instances[stats.Instance] = i
+	}
+
+	i.last++
+	i.samples[(i.last-1)%uint64(h.size)] = StatsSample{Time: now, InstanceStats: stats}
+
+	// The peaks of a single instance, they are summed up with the others.
+	if cpu := stats.CpuFraction * stats.CpuAllocated; cpu > i.usage.PeakCpuSum {
+		i.usage.PeakCpuSum = cpu
+	}
+	if stats.MemUsage > i.usage.PeakMemSum {
+		i.usage.PeakMemSum = stats.MemUsage
+	}
+	// The network counters are totals since the instance started.
+	i.usage.NetRx = stats.NetRx
+	i.usage.NetTx = stats.NetTx
+}
+
+func (h *StatsHistory) forgetInstance(sessionId, name string) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	i, found := h.instances[name]
+	if !found || i.sessionId != sessionId {
+		return
+	}
+
+	usage, found := h.deleted[sessionId]
+	if !found {
+		usage = &types.SessionUsage{}
+		h.deleted[sessionId] = usage
+	}
+	addUsage(usage, &i.usage)
+
+	delete(h.instances, name)
+}
+
+func (h *StatsHistory) forgetSession(sessionId string, now time.Time) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	for id, at := range h.ended {
+		if now.Sub(at) > endedRetention {
+			delete(h.ended, id)
+		}
+	}
+	h.ended[sessionId] = now
+
+	delete(h.deleted, sessionId)
+	for name, i := range h.instances {
+		if i.sessionId == sessionId {
+			delete(h.instances, name)
+		}
+	}
+}
+
+func addUsage(to, usage *types.SessionUsage) {
+	to.PeakCpuSum += usage.PeakCpuSum
+	to.PeakMemSum += usage.PeakMemSum
+	to.NetRx += usage.NetRx
+	to.NetTx += usage.NetTx
+}
+
+// Since returns the samples of the instance of the session collected after
+// since, oldest first.
+func (h *StatsHistory) Since(sessionId, name string, since time.Time) []StatsSample {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	samples := []StatsSample{}
+
+	i, found := h.instances[name]
+	if !found || i.sessionId != sessionId {
+		return samples
+	}
+
+	first := uint64(1)
+	if i.last > uint64(h.size) {
+		first = i.last - uint64(h.size) + 1
+	}
+
+	for n := first; n <= i.last; n++ {
+		if sample := i.samples[(n-1)%uint64(h.size)]; sample.Time.After(since) {
+			samples = append(samples, sample)
+		}
+	}
+
+	return samples
+}
+
+// Summary returns the usage of all the instances the session had, nil if no
+// stats were collected from them.
+func (h *StatsHistory) Summary(sessionId string) *types.SessionUsage {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	var usage *types.SessionUsage
+	if deleted, found := h.deleted[sessionId]; found {
+		usage = &types.SessionUsage{}
+		addUsage(usage, deleted)
+	}
+
+	for _, i := range h.instances {
+		if i.sessionId != sessionId {
+			continue
+		}
+		if usage == nil {
+			usage = &types.SessionUsage{}
+		}
+		addUsage(usage, &i.usage)
+	}
+
+	return usage
+}
@@ -0,0 +1,60 @@
+package task
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dimaskiddo/play-with-docker/event"
+	"github.com/dimaskiddo/play-with-docker/pwd/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestStatsHistory(t *testing.T) {
+	e := &event.Mock{}
+	e.M.On("On", CollectStatsEvent, mock.Anything).Return()
+	e.M.On("On", event.INSTANCE_DELETE, mock.Anything).Return()
+	e.M.On("On", event.SESSION_END, mock.Anything).Return()
+
+	h := NewStatsHistory(e, 2)
+
+	now := time.Now()
+	h.record("s1", InstanceStats{Instance: "i1", CpuFraction: 0.5, CpuAllocated: 2, MemUsage: 100, NetRx: 10, NetTx: 1}, now)
+	h.record("s1", InstanceStats{Instance: "i1", CpuFraction: 0.25, CpuAllocated: 2, MemUsage: 300, NetRx: 20, NetTx: 2}, now.Add(time.Second))
+	h.record("s1", InstanceStats{Instance: "i1", CpuFraction: 0.1, CpuAllocated: 2, MemUsage: 200, NetRx: 30, NetTx: 3}, now.Add(2*time.Second))
+	h.record("s1", InstanceStats{Instance: "i2", CpuFraction: 1, CpuAllocated: 1, MemUsage: 50, NetRx: 5, NetTx: 5}, now)
+
+	// Only the last samples are kept.
+	samples := h.Since("s1", "i1", time.Time{})
+	assert.Len(t, samples, 2)
+	assert.Equal(t, uint64(300), samples[0].MemUsage)
+	assert.Equal(t, uint64(200), samples[1].MemUsage)
+
+	samples = h.Since("s1", "i1", now.Add(time.Second))
+	assert.Len(t, samples, 1)
+	assert.Equal(t, now.Add(2*time.Second), samples[0].Time)
+
+	assert.Empty(t, h.Since("s2", "i1", time.Time{}))
+
+	// Deleted instances still count.
+	h.forgetInstance("s1", "i2")
+	assert.Empty(t, h.Since("s1", "i2", time.Time{}))
+	assert.Equal(t, &types.SessionUsage{PeakCpuSum: 2, PeakMemSum: 350, NetRx: 35, NetTx: 8}, h.Summary("s1"))
+
+	h.forgetSession("s1", now)
+	assert.Nil(t, h.Summary("s1"))
+	assert.Empty(t, h.Since("s1", "i1", time.Time{}))
+
+	// Stats and deletions arriving after the end are not kept.
+	h.record("s1", InstanceStats{Instance: "i1", MemUsage: 100}, now.Add(3*time.Second))
+	h.forgetInstance("s1", "i1")
+	assert.Nil(t, h.Summary("s1"))
+	assert.Empty(t, h.instances)
+	assert.Empty(t, h.deleted)
+
+	// The ended sessions are forgotten after a while.
+	h.forgetSession("s2", now.Add(endedRetention+time.Second))
+	assert.Equal(t, map[string]time.Time{"s2": now.Add(endedRetention + time.Second)}, h.ended)
+
+	e.M.AssertExpectations(t)
+}
@@ -0,0 +1,417 @@
+package storage
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ArchiveVersion is the layout version of the archives written by
+// WriteArchive.
+const ArchiveVersion = 1
+
+const (
+	archiveManifest = "manifest.json"
+	archiveDB       = "db.json"
+	archiveData     = "data/"
+)
+
+type ArchiveManifest struct {
+	Version       int       `json:"version"`
+	SchemaVersion int       `json:"schema_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	Sessions      []string  `json:"sessions"`
+}
+
+// ExportFile reads the file storage at path, including its journal, without
+// modifying it, so it is safe to use while the server is running.
+func ExportFile(path string) (*DB, error) {
+	db, _, err := readSnapshot(path)
+	if err != nil {
+		return nil, err
+	}
+
+	_, _, err = replayJournal(journalPath(path), db, 0, false)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.migrate()
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// ExportBolt reads the bolt storage at path in a single transaction. The file
+// is locked by a running server, in which case this times out.
+func ExportBolt(path string) (*DB, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+
+	b, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer b.Close()
+
+	db, err := (&boltStorage{db: b}).dump()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.migrate()
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// ImportDB puts every record of db into s. Records that already exist in s
+// are overwritten.
+func ImportDB(s StorageApi, db *DB) error {
+	_, err := db.migrate()
+	if err != nil {
+		return err
+	}
+
+	for _, session := range db.Sessions {
+		if err := s.SessionPut(session); err != nil {
+			return fmt.Errorf("session %s: %v", session.Id, err)
+		}
+	}
+
+	for _, instance := range db.Instances {
+		if err := s.InstancePut(instance); err != nil {
+			return fmt.Errorf("instance %s: %v", instance.Name, err)
+		}
+	}
+
+	for _, instance := range db.WindowsInstances {
+		if err := s.WindowsInstancePut(instance); err != nil {
+			return fmt.Errorf("windows instance %s: %v", instance.Id, err)
+		}
+	}
+
+	for _, client := range db.Clients {
+		if err := s.ClientPut(client); err != nil {
+			return fmt.Errorf("client %s: %v", client.Id, err)
+		}
+	}
+
+	for _, user := range db.Users {
+		if err := s.UserPut(user); err != nil {
+			return fmt.Errorf("user %s: %v", user.Id, err)
+		}
+	}
+
+	for _, loginRequest := range db.LoginRequests {
+		if err := s.LoginRequestPut(loginRequest); err != nil {
+			return fmt.Errorf("login request %s: %v", loginRequest.Id, err)
+		}
+	}
+
+	for _, playground := range db.Playgrounds {
+		if err := s.PlaygroundPut(playground); err != nil {
+			return fmt.Errorf("playground %s: %v", playground.Id, err)
+		}
+	}
+
+	return nil
+}
+
+// WriteArchive writes db as a gzipped tar archive to w, together with the
+// user data directory of every session found under dataDir.
+func WriteArchive(w io.Writer, db *DB, dataDir string) (*ArchiveManifest, error) {
+	manifest := &ArchiveManifest{
+		Version:       ArchiveVersion,
+		SchemaVersion: db.Version,
+		CreatedAt:     time.Now(),
+		Sessions:      []string{},
+	}
+
+	for id := range db.Sessions {
+		manifest.Sessions = append(manifest.Sessions, id)
+	}
+	sort.Strings(manifest.Sessions)
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	if err := writeArchiveJSON(tw, archiveManifest, manifest); err != nil {
+		return nil, err
+	}
+
+	if err := writeArchiveJSON(tw, archiveDB, db); err != nil {
+		return nil, err
+	}
+
+	for _, id := range manifest.Sessions {
+		if err := writeArchiveDir(tw, filepath.Join(dataDir, id), archiveData+id); err != nil {
+			return nil, fmt.Errorf("session %s data: %v", id, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+func writeArchiveJSON(tw *tar.Writer, name string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	err = tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(b)), ModTime: time.Now(), Typeflag: tar.TypeReg})
+	if err != nil {
+		return err
+	}
+
+	_, err = tw.Write(b)
+
+	return err
+}
+
+func writeArchiveDir(tw *tar.Writer, dir, prefix string) error {
+	if _, err := os.Lstat(dir); os.IsNotExist(err) {
+		return nil
+	}
+
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+
+		hdr.Name = filepath.ToSlash(filepath.Join(prefix, rel))
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+
+		return err
+	})
+}
+
+// ImportArchive reads an archive written by WriteArchive and imports its DB
+// into s before restoring the session user data directories under dataDir,
+// so that an archive whose DB cannot be imported leaves dataDir untouched.
+// Only the data of the sessions in the DB is restored, and no entry, whether
+// through its name, a symlink in the archive or one already in dataDir, can
+// be written outside of dataDir.
+func ImportArchive(r io.Reader, s StorageApi, dataDir string) (*ArchiveManifest, *DB, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+
+	var manifest *ArchiveManifest
+	var db *DB
+	var root string
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch {
+		case hdr.Name == archiveManifest:
+			if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+				return nil, nil, fmt.Errorf("decode %s: %v", archiveManifest, err)
+			}
+
+			if manifest.Version > ArchiveVersion {
+				return nil, nil, fmt.Errorf("archive version %d is newer than the supported version %d", manifest.Version, ArchiveVersion)
+			}
+		case manifest == nil:
+			return nil, nil, fmt.Errorf("archive does not start with %s", archiveManifest)
+		case hdr.Name == archiveDB:
+			if err := json.NewDecoder(tr).Decode(&db); err != nil {
+				return nil, nil, fmt.Errorf("decode %s: %v", archiveDB, err)
+			}
+
+			if err := ImportDB(s, db); err != nil {
+				return nil, nil, fmt.Errorf("import %s: %v", archiveDB, err)
+			}
+
+			if err := os.MkdirAll(dataDir, 0755); err != nil {
+				return nil, nil, err
+			}
+
+			if root, err = filepath.EvalSymlinks(dataDir); err != nil {
+				return nil, nil, err
+			}
+		case strings.HasPrefix(hdr.Name, archiveData):
+			if db == nil {
+				return nil, nil, fmt.Errorf("archive entry %s comes before %s", hdr.Name, archiveDB)
+			}
+
+			name := strings.TrimPrefix(hdr.Name, archiveData)
+			if _, found := db.Sessions[strings.SplitN(name, "/", 2)[0]]; !found {
+				return nil, nil, fmt.Errorf("archive entry %s does not belong to a session", hdr.Name)
+			}
+
+			if err := extractArchiveEntry(tr, hdr, root, name); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	if manifest == nil || db == nil {
+		return nil, nil, fmt.Errorf("archive is missing %s or %s", archiveManifest, archiveDB)
+	}
+
+	return manifest, db, nil
+}
+
+// extractArchiveEntry writes the entry under root, which must not be a
+// symlink itself.
+func extractArchiveEntry(tr *tar.Reader, hdr *tar.Header, root, name string) error {
+	path := filepath.Join(root, filepath.FromSlash(name))
+	if !insideDir(root, path) || path == root {
+		return fmt.Errorf("archive entry %s is outside of the data directory", hdr.Name)
+	}
+
+	// The parents may already exist as symlinks, either restored from the
+	// archive or left in the data directory.
+	if err := checkParentsInside(root, path); err != nil {
+		return fmt.Errorf("archive entry %s: %v", hdr.Name, err)
+	}
+
+	// Entries replace what is at their path instead of writing through it.
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	mode := hdr.FileInfo().Mode()
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if err := os.MkdirAll(path, mode.Perm()); err != nil {
+			return err
+		}
+	case tar.TypeReg:
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(f, tr)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	case tar.TypeSymlink:
+		target := hdr.Linkname
+		if filepath.IsAbs(target) || !insideDir(root, filepath.Join(filepath.Dir(path), target)) {
+			return fmt.Errorf("archive entry %s links to %s, outside of the data directory", hdr.Name, target)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+
+		os.Remove(path)
+		if err := os.Symlink(target, path); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+
+	// Ownership only carries over when importing as root.
+	os.Lchown(path, hdr.Uid, hdr.Gid)
+
+	return nil
+}
+
+// checkParentsInside follows the symlinks of the deepest existing parent of
+// path and fails if it resolves outside of root.
+func checkParentsInside(root, path string) error {
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		resolved, err := filepath.EvalSymlinks(dir)
+		if os.IsNotExist(err) && dir != root {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if !insideDir(root, resolved) {
+			return fmt.Errorf("%s resolves outside of the data directory", dir)
+		}
+
+		return nil
+	}
+}
+
+// insideDir tells whether path is dir or lexically under it.
+func insideDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator))
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dimaskiddo/play-with-docker/pwd/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchiveRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "session")
+	dataDir := filepath.Join(dir, "data")
+
+	s, err := NewFileStorage(path)
+	assert.Nil(t, err)
+
+	session := &types.Session{Id: "s1"}
+	instance := &types.Instance{Name: "i1", SessionId: session.Id}
+	client := &types.Client{Id: "c1", SessionId: session.Id}
+	user := &types.User{Id: "u1", Provider: "github", ProviderUserId: "42"}
+	loginRequest := &types.LoginRequest{Id: "lr1", Provider: "github"}
+	playground := &types.Playground{Id: "p1"}
+
+	assert.Nil(t, s.SessionPut(session))
+	assert.Nil(t, s.InstancePut(instance))
+	assert.Nil(t, s.ClientPut(client))
+	assert.Nil(t, s.UserPut(user))
+	assert.Nil(t, s.LoginRequestPut(loginRequest))
+	assert.Nil(t, s.PlaygroundPut(playground))
+
+	assert.Nil(t, os.MkdirAll(filepath.Join(dataDir, session.Id, "sub"), 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dataDir, session.Id, "sub", "file"), []byte("hello"), 0644))
+
+	db, err := ExportFile(path)
+	assert.Nil(t, err)
+
+	var archive bytes.Buffer
+	manifest, err := WriteArchive(&archive, db, dataDir)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{session.Id}, manifest.Sessions)
+	assert.Equal(t, SchemaVersion, manifest.SchemaVersion)
+
+	restoreDir := filepath.Join(dir, "restore")
+	target := newBoltTestStorage(t, nil)
+	manifest, _, err = ImportArchive(&archive, target, restoreDir)
+	assert.Nil(t, err)
+	assert.Equal(t, ArchiveVersion, manifest.Version)
+
+	content, err := ioutil.ReadFile(filepath.Join(restoreDir, session.Id, "sub", "file"))
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(content))
+
+	found, err := target.SessionGet(session.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, session, found)
+
+	instances, err := target.InstanceFindBySessionId(session.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Instance{instance}, instances)
+
+	clients, err := target.ClientFindBySessionId(session.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Client{client}, clients)
+
+	foundUser, err := target.UserFindByProvider("github", "42")
+	assert.Nil(t, err)
+	assert.Equal(t, user, foundUser)
+
+	foundLoginRequest, err := target.LoginRequestGet(loginRequest.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, loginRequest, foundLoginRequest)
+
+	foundPlayground, err := target.PlaygroundGet(playground.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, playground, foundPlayground)
+}
+
+func writeTestArchive(t *testing.T, db *DB, entries ...*tar.Header) *bytes.Buffer {
+	var archive bytes.Buffer
+
+	gw := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gw)
+
+	assert.Nil(t, writeArchiveJSON(tw, archiveManifest, &ArchiveManifest{Version: ArchiveVersion}))
+	assert.Nil(t, writeArchiveJSON(tw, archiveDB, db))
+	for _, hdr := range entries {
+		assert.Nil(t, tw.WriteHeader(hdr))
+	}
+	assert.Nil(t, tw.Close())
+	assert.Nil(t, gw.Close())
+
+	return &archive
+}
+
+func TestArchiveRejectsEscapingEntries(t *testing.T) {
+	dir := t.TempDir()
+	dataDir := filepath.Join(dir, "data")
+	db := &DB{Version: SchemaVersion, Sessions: map[string]*types.Session{"s1": {Id: "s1"}}}
+
+	archives := map[string]*bytes.Buffer{
+		"name":            writeTestArchive(t, db, &tar.Header{Name: "data/../../evil", Mode: 0644, Typeflag: tar.TypeReg}),
+		"unknown session": writeTestArchive(t, db, &tar.Header{Name: "data/s2/file", Mode: 0644, Typeflag: tar.TypeReg}),
+		"absolute link":   writeTestArchive(t, db, &tar.Header{Name: "data/s1/link", Linkname: dir, Typeflag: tar.TypeSymlink}),
+		"relative link":   writeTestArchive(t, db, &tar.Header{Name: "data/s1/link", Linkname: "../../..", Typeflag: tar.TypeSymlink}),
+	}
+
+	for name, archive := range archives {
+		_, _, err := ImportArchive(archive, newBoltTestStorage(t, nil), dataDir)
+		assert.NotNil(t, err, name)
+	}
+
+	// A link left in the data directory is not written through.
+	assert.Nil(t, os.MkdirAll(filepath.Join(dataDir, "s1"), 0755))
+	assert.Nil(t, os.Symlink(dir, filepath.Join(dataDir, "s1", "link")))
+
+	archive := writeTestArchive(t, db, &tar.Header{Name: "data/s1/link/evil", Mode: 0644, Typeflag: tar.TypeReg})
+	_, _, err := ImportArchive(archive, newBoltTestStorage(t, nil), dataDir)
+	assert.NotNil(t, err)
+
+	_, err = os.Stat(filepath.Join(dir, "evil"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestArchiveImportsDBFirst(t *testing.T) {
+	dataDir := filepath.Join(t.TempDir(), "data")
+	db := &DB{Version: SchemaVersion + 1, Sessions: map[string]*types.Session{"s1": {Id: "s1"}}}
+
+	archive := writeTestArchive(t, db, &tar.Header{Name: "data/s1/", Mode: 0755, Typeflag: tar.TypeDir})
+	_, _, err := ImportArchive(archive, newBoltTestStorage(t, nil), dataDir)
+	assert.NotNil(t, err)
+
+	_, err = os.Stat(dataDir)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,1076 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/dimaskiddo/play-with-docker/pwd/types"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	sessionsBucket                    = []byte("sessions")
+	instancesBucket                   = []byte("instances")
+	clientsBucket                     = []byte("clients")
+	windowsInstancesBucket            = []byte("windows_instances")
+	loginRequestsBucket               = []byte("login_requests")
+	usersBucket                       = []byte("users")
+	playgroundsBucket                 = []byte("playgrounds")
+	windowsInstancesBySessionIdBucket = []byte("windows_instances_by_session_id")
+	instancesBySessionIdBucket        = []byte("instances_by_session_id")
+	clientsBySessionIdBucket          = []byte("clients_by_session_id")
+	usersByProviderBucket             = []byte("users_by_providers")
+	leasesBucket                      = []byte("leases")
+	metaBucket                        = []byte("meta")
+)
+
+var versionKey = []byte("version")
+
+var boltBuckets = [][]byte{
+	sessionsBucket,
+	instancesBucket,
+	clientsBucket,
+	windowsInstancesBucket,
+	loginRequestsBucket,
+	usersBucket,
+	playgroundsBucket,
+	windowsInstancesBySessionIdBucket,
+	instancesBySessionIdBucket,
+	clientsBySessionIdBucket,
+	usersByProviderBucket,
+	leasesBucket,
+	metaBucket,
+}
+
+type boltStorage struct {
+	db  *bolt.DB
+	hub *WatchHub
+}
+
+func NewBoltStorage(path string) (StorageApi, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open bolt storage %s: %v", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range boltBuckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := &boltStorage{db: db, hub: NewWatchHub()}
+
+	err = s.migrate()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// BoltSchemaVersion returns the schema version of the bolt storage at path.
+func BoltSchemaVersion(path string) (int, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return SchemaVersion, nil
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second, ReadOnly: true})
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	version := 0
+	err = db.View(func(tx *bolt.Tx) error {
+		version = boltVersion(tx)
+		return nil
+	})
+
+	return version, err
+}
+
+func boltVersion(tx *bolt.Tx) int {
+	b := tx.Bucket(metaBucket)
+	if b == nil {
+		return 0
+	}
+
+	v, err := strconv.Atoi(string(b.Get(versionKey)))
+	if err != nil {
+		return 0
+	}
+
+	return v
+}
+
+func (store *boltStorage) migrate() error {
+	version := 0
+	store.db.View(func(tx *bolt.Tx) error {
+		version = boltVersion(tx)
+		return nil
+	})
+
+	if version == SchemaVersion {
+		return nil
+	}
+
+	db, err := store.dump()
+	if err != nil {
+		return err
+	}
+
+	_, err = db.migrate()
+	if err != nil {
+		return err
+	}
+
+	return store.restore(db)
+}
+
+func boltGet(tx *bolt.Tx, bucket []byte, key string, v interface{}) error {
+	b := tx.Bucket(bucket).Get([]byte(key))
+	if b == nil {
+		return NotFoundError
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+func boltPut(tx *bolt.Tx, bucket []byte, key string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(bucket).Put([]byte(key), b)
+}
+
+func boltExists(tx *bolt.Tx, bucket []byte, key string) bool {
+	return tx.Bucket(bucket).Get([]byte(key)) != nil
+}
+
+func boltIndexAdd(tx *bolt.Tx, index []byte, sessionId, key string) error {
+	b, err := tx.Bucket(index).CreateBucketIfNotExists([]byte(sessionId))
+	if err != nil {
+		return err
+	}
+
+	return b.Put([]byte(key), []byte{})
+}
+
+func boltIndexRemove(tx *bolt.Tx, index []byte, sessionId, key string) error {
+	b := tx.Bucket(index).Bucket([]byte(sessionId))
+	if b == nil {
+		return nil
+	}
+
+	return b.Delete([]byte(key))
+}
+
+func boltIndexKeys(tx *bolt.Tx, index []byte, sessionId string) []string {
+	keys := []string{}
+
+	b := tx.Bucket(index).Bucket([]byte(sessionId))
+	if b == nil {
+		return keys
+	}
+
+	b.ForEach(func(k, v []byte) error {
+		keys = append(keys, string(k))
+		return nil
+	})
+
+	return keys
+}
+
+func boltIndexDrop(tx *bolt.Tx, index, bucket []byte, sessionId string) error {
+	for _, key := range boltIndexKeys(tx, index, sessionId) {
+		if err := tx.Bucket(bucket).Delete([]byte(key)); err != nil {
+			return err
+		}
+	}
+
+	if tx.Bucket(index).Bucket([]byte(sessionId)) == nil {
+		return nil
+	}
+
+	return tx.Bucket(index).DeleteBucket([]byte(sessionId))
+}
+
+// update runs fn in a read-write transaction and publishes the events it
+// reported once the transaction is committed.
+func (store *boltStorage) update(fn func(tx *bolt.Tx, notify func(WatchEvent)) error) error {
+	var events []WatchEvent
+
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		events = nil
+		return fn(tx, func(e WatchEvent) {
+			events = append(events, e)
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, e := range events {
+		store.hub.Publish(e)
+	}
+
+	return nil
+}
+
+func (store *boltStorage) Watch(kind Kind, filter WatchFilter) (*Watch, error) {
+	return store.hub.Watch(kind, filter)
+}
+
+func (store *boltStorage) SessionGet(id string) (*types.Session, error) {
+	var session *types.Session
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		return boltGet(tx, sessionsBucket, id, &session)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func (store *boltStorage) SessionGetAll() ([]*types.Session, error) {
+	sessions := []*types.Session{}
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionsBucket).ForEach(func(k, v []byte) error {
+			var s *types.Session
+			if err := json.Unmarshal(v, &s); err != nil {
+				return err
+			}
+
+			sessions = append(sessions, s)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func (store *boltStorage) SessionPut(session *types.Session) error {
+	return store.update(func(tx *bolt.Tx, notify func(WatchEvent)) error {
+		if err := boltPut(tx, sessionsBucket, session.Id, session); err != nil {
+			return err
+		}
+
+		notify(WatchEvent{Kind: KindSession, Op: OpPut, Id: session.Id, Session: session})
+
+		return nil
+	})
+}
+
+func (store *boltStorage) SessionTouch(id string, at time.Time) error {
+	return store.update(func(tx *bolt.Tx, notify func(WatchEvent)) error {
+		var session *types.Session
+		if err := boltGet(tx, sessionsBucket, id, &session); err != nil {
+			return err
+		}
+
+		session.LastActivity = at
+		session.IdleWarnedAt = time.Time{}
+
+		if err := boltPut(tx, sessionsBucket, id, session); err != nil {
+			return err
+		}
+
+		notify(WatchEvent{Kind: KindSession, Op: OpPut, Id: id, Session: session})
+
+		return nil
+	})
+}
+
+func (store *boltStorage) SessionIdleWarn(id string, at time.Time) error {
+	return store.update(func(tx *bolt.Tx, notify func(WatchEvent)) error {
+		var session *types.Session
+		if err := boltGet(tx, sessionsBucket, id, &session); err != nil {
+			return err
+		}
+
+		session.IdleWarnedAt = at
+
+		if err := boltPut(tx, sessionsBucket, id, session); err != nil {
+			return err
+		}
+
+		notify(WatchEvent{Kind: KindSession, Op: OpPut, Id: id, Session: session})
+
+		return nil
+	})
+}
+
+func (store *boltStorage) SessionDelete(id string) error {
+	return store.update(func(tx *bolt.Tx, notify func(WatchEvent)) error {
+		var session *types.Session
+		if err := boltGet(tx, sessionsBucket, id, &session); err != nil {
+			if NotFound(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		for _, name := range boltIndexKeys(tx, instancesBySessionIdBucket, id) {
+			var i *types.Instance
+			if err := boltGet(tx, instancesBucket, name, &i); err == nil {
+				notify(WatchEvent{Kind: KindInstance, Op: OpDelete, Id: name, Instance: i})
+			}
+		}
+
+		for _, clientId := range boltIndexKeys(tx, clientsBySessionIdBucket, id) {
+			var c *types.Client
+			if err := boltGet(tx, clientsBucket, clientId, &c); err == nil {
+				notify(WatchEvent{Kind: KindClient, Op: OpDelete, Id: clientId, Client: c})
+			}
+		}
+
+		if err := boltIndexDrop(tx, windowsInstancesBySessionIdBucket, windowsInstancesBucket, id); err != nil {
+			return err
+		}
+
+		if err := boltIndexDrop(tx, instancesBySessionIdBucket, instancesBucket, id); err != nil {
+			return err
+		}
+
+		if err := boltIndexDrop(tx, clientsBySessionIdBucket, clientsBucket, id); err != nil {
+			return err
+		}
+
+		notify(WatchEvent{Kind: KindSession, Op: OpDelete, Id: id, Session: session})
+
+		return tx.Bucket(sessionsBucket).Delete([]byte(id))
+	})
+}
+
+func (store *boltStorage) SessionCount() (int, error) {
+	var count int
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		count = tx.Bucket(sessionsBucket).Stats().KeyN
+		return nil
+	})
+
+	return count, err
+}
+
+func (store *boltStorage) SessionFindByUserId(userId string, page Page) ([]*types.Session, string, error) {
+	return store.sessionFind(page, func(s *types.Session) bool {
+		return s.UserId == userId
+	})
+}
+
+func (store *boltStorage) SessionFindByPlaygroundId(playgroundId string, page Page) ([]*types.Session, string, error) {
+	return store.sessionFind(page, func(s *types.Session) bool {
+		return s.PlaygroundId == playgroundId
+	})
+}
+
+func (store *boltStorage) SessionFindExpiringBefore(t time.Time, page Page) ([]*types.Session, string, error) {
+	return store.sessionFind(page, func(s *types.Session) bool {
+		return !s.ExpiresAt.IsZero() && s.ExpiresAt.Before(t)
+	})
+}
+
+func (store *boltStorage) sessionFind(page Page, match func(s *types.Session) bool) ([]*types.Session, string, error) {
+	sessions := []*types.Session{}
+	next := ""
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		results, cursor, err := boltPage(tx, sessionsBucket, page, func(v []byte) (interface{}, error) {
+			var s *types.Session
+			if err := json.Unmarshal(v, &s); err != nil {
+				return nil, err
+			}
+			if !match(s) {
+				return nil, nil
+			}
+
+			return s, nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, r := range results {
+			sessions = append(sessions, r.(*types.Session))
+		}
+		next = cursor
+
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return sessions, next, nil
+}
+
+func (store *boltStorage) InstanceGet(name string) (*types.Instance, error) {
+	var instance *types.Instance
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		return boltGet(tx, instancesBucket, name, &instance)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return instance, nil
+}
+
+func (store *boltStorage) InstanceFindBySessionId(sessionId string) ([]*types.Instance, error) {
+	instances := []*types.Instance{}
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		for _, name := range boltIndexKeys(tx, instancesBySessionIdBucket, sessionId) {
+			var i *types.Instance
+			if err := boltGet(tx, instancesBucket, name, &i); err != nil {
+				return err
+			}
+
+			instances = append(instances, i)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return instances, nil
+}
+
+func (store *boltStorage) InstancePut(instance *types.Instance) error {
+	return store.update(func(tx *bolt.Tx, notify func(WatchEvent)) error {
+		if !boltExists(tx, sessionsBucket, instance.SessionId) {
+			return NotFoundError
+		}
+
+		var old *types.Instance
+		if err := boltGet(tx, instancesBucket, instance.Name, &old); err == nil && old.SessionId != instance.SessionId {
+			if err := boltIndexRemove(tx, instancesBySessionIdBucket, old.SessionId, old.Name); err != nil {
+				return err
+			}
+		}
+
+		if err := boltPut(tx, instancesBucket, instance.Name, instance); err != nil {
+			return err
+		}
+
+		notify(WatchEvent{Kind: KindInstance, Op: OpPut, Id: instance.Name, Instance: instance})
+
+		return boltIndexAdd(tx, instancesBySessionIdBucket, instance.SessionId, instance.Name)
+	})
+}
+
+func (store *boltStorage) InstanceDelete(name string) error {
+	return store.update(func(tx *bolt.Tx, notify func(WatchEvent)) error {
+		var instance *types.Instance
+		if err := boltGet(tx, instancesBucket, name, &instance); err != nil {
+			if NotFound(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		if err := boltIndexRemove(tx, instancesBySessionIdBucket, instance.SessionId, name); err != nil {
+			return err
+		}
+
+		notify(WatchEvent{Kind: KindInstance, Op: OpDelete, Id: name, Instance: instance})
+
+		return tx.Bucket(instancesBucket).Delete([]byte(name))
+	})
+}
+
+func (store *boltStorage) InstanceCount() (int, error) {
+	var count int
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		count = tx.Bucket(instancesBucket).Stats().KeyN
+		return nil
+	})
+
+	return count, err
+}
+
+func (store *boltStorage) InstanceFindByImage(image string, page Page) ([]*types.Instance, string, error) {
+	instances := []*types.Instance{}
+	next := ""
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		results, cursor, err := boltPage(tx, instancesBucket, page, func(v []byte) (interface{}, error) {
+			var i *types.Instance
+			if err := json.Unmarshal(v, &i); err != nil {
+				return nil, err
+			}
+			if i.Image != image {
+				return nil, nil
+			}
+
+			return i, nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, r := range results {
+			instances = append(instances, r.(*types.Instance))
+		}
+		next = cursor
+
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return instances, next, nil
+}
+
+func (store *boltStorage) WindowsInstanceGetAll() ([]*types.WindowsInstance, error) {
+	instances := []*types.WindowsInstance{}
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(windowsInstancesBucket).ForEach(func(k, v []byte) error {
+			var i *types.WindowsInstance
+			if err := json.Unmarshal(v, &i); err != nil {
+				return err
+			}
+
+			instances = append(instances, i)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return instances, nil
+}
+
+func (store *boltStorage) WindowsInstancePut(instance *types.WindowsInstance) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		if !boltExists(tx, sessionsBucket, instance.SessionId) {
+			return NotFoundError
+		}
+
+		if err := boltPut(tx, windowsInstancesBucket, instance.Id, instance); err != nil {
+			return err
+		}
+
+		return boltIndexAdd(tx, windowsInstancesBySessionIdBucket, instance.SessionId, instance.Id)
+	})
+}
+
+func (store *boltStorage) WindowsInstanceDelete(id string) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		var instance *types.WindowsInstance
+		if err := boltGet(tx, windowsInstancesBucket, id, &instance); err != nil {
+			if NotFound(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		if err := boltIndexRemove(tx, windowsInstancesBySessionIdBucket, instance.SessionId, id); err != nil {
+			return err
+		}
+
+		return tx.Bucket(windowsInstancesBucket).Delete([]byte(id))
+	})
+}
+
+func (store *boltStorage) ClientGet(id string) (*types.Client, error) {
+	var client *types.Client
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		return boltGet(tx, clientsBucket, id, &client)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+func (store *boltStorage) ClientFindBySessionId(sessionId string) ([]*types.Client, error) {
+	clients := []*types.Client{}
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		for _, id := range boltIndexKeys(tx, clientsBySessionIdBucket, sessionId) {
+			var c *types.Client
+			if err := boltGet(tx, clientsBucket, id, &c); err != nil {
+				return err
+			}
+
+			clients = append(clients, c)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return clients, nil
+}
+
+func (store *boltStorage) ClientPut(client *types.Client) error {
+	return store.update(func(tx *bolt.Tx, notify func(WatchEvent)) error {
+		if !boltExists(tx, sessionsBucket, client.SessionId) {
+			return NotFoundError
+		}
+
+		if err := boltPut(tx, clientsBucket, client.Id, client); err != nil {
+			return err
+		}
+
+		notify(WatchEvent{Kind: KindClient, Op: OpPut, Id: client.Id, Client: client})
+
+		return boltIndexAdd(tx, clientsBySessionIdBucket, client.SessionId, client.Id)
+	})
+}
+
+func (store *boltStorage) ClientDelete(id string) error {
+	return store.update(func(tx *bolt.Tx, notify func(WatchEvent)) error {
+		var client *types.Client
+		if err := boltGet(tx, clientsBucket, id, &client); err != nil {
+			if NotFound(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		if err := boltIndexRemove(tx, clientsBySessionIdBucket, client.SessionId, id); err != nil {
+			return err
+		}
+
+		notify(WatchEvent{Kind: KindClient, Op: OpDelete, Id: id, Client: client})
+
+		return tx.Bucket(clientsBucket).Delete([]byte(id))
+	})
+}
+
+func (store *boltStorage) ClientDeleteExpired(now time.Time) (int, error) {
+	count := 0
+
+	err := store.update(func(tx *bolt.Tx, notify func(WatchEvent)) error {
+		expired := []*types.Client{}
+
+		err := tx.Bucket(clientsBucket).ForEach(func(k, v []byte) error {
+			var client *types.Client
+			if err := json.Unmarshal(v, &client); err != nil {
+				return err
+			}
+
+			if !client.ExpiresAt.IsZero() && !client.ExpiresAt.After(now) {
+				expired = append(expired, client)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, client := range expired {
+			if err := boltIndexRemove(tx, clientsBySessionIdBucket, client.SessionId, client.Id); err != nil {
+				return err
+			}
+
+			if err := tx.Bucket(clientsBucket).Delete([]byte(client.Id)); err != nil {
+				return err
+			}
+
+			notify(WatchEvent{Kind: KindClient, Op: OpDelete, Id: client.Id, Client: client})
+		}
+
+		count = len(expired)
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (store *boltStorage) ClientCount() (int, error) {
+	var count int
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		count = tx.Bucket(clientsBucket).Stats().KeyN
+		return nil
+	})
+
+	return count, err
+}
+
+func (store *boltStorage) LoginRequestGet(id string) (*types.LoginRequest, error) {
+	var loginRequest *types.LoginRequest
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		return boltGet(tx, loginRequestsBucket, id, &loginRequest)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return loginRequest, nil
+}
+
+func (store *boltStorage) LoginRequestPut(loginRequest *types.LoginRequest) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return boltPut(tx, loginRequestsBucket, loginRequest.Id, loginRequest)
+	})
+}
+
+func (store *boltStorage) LoginRequestDelete(id string) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(loginRequestsBucket).Delete([]byte(id))
+	})
+}
+
+func (store *boltStorage) LoginRequestDeleteExpired(now time.Time) (int, error) {
+	count := 0
+
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		expired := []string{}
+
+		err := tx.Bucket(loginRequestsBucket).ForEach(func(k, v []byte) error {
+			var loginRequest *types.LoginRequest
+			if err := json.Unmarshal(v, &loginRequest); err != nil {
+				return err
+			}
+
+			if !loginRequest.ExpiresAt.IsZero() && !loginRequest.ExpiresAt.After(now) {
+				expired = append(expired, loginRequest.Id)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, id := range expired {
+			if err := tx.Bucket(loginRequestsBucket).Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+
+		count = len(expired)
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (store *boltStorage) UserGet(id string) (*types.User, error) {
+	var user *types.User
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		return boltGet(tx, usersBucket, id, &user)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (store *boltStorage) UserFindByProvider(providerName, providerUserId string) (*types.User, error) {
+	var user *types.User
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		userId := tx.Bucket(usersByProviderBucket).Get([]byte(fmt.Sprintf("%s_%s", providerName, providerUserId)))
+		if userId == nil {
+			return NotFoundError
+		}
+
+		return boltGet(tx, usersBucket, string(userId), &user)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (store *boltStorage) UserPut(user *types.User) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		key := []byte(fmt.Sprintf("%s_%s", user.Provider, user.ProviderUserId))
+		if err := tx.Bucket(usersByProviderBucket).Put(key, []byte(user.Id)); err != nil {
+			return err
+		}
+
+		return boltPut(tx, usersBucket, user.Id, user)
+	})
+}
+
+func (store *boltStorage) PlaygroundGet(id string) (*types.Playground, error) {
+	var playground *types.Playground
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		return boltGet(tx, playgroundsBucket, id, &playground)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return playground, nil
+}
+
+func (store *boltStorage) PlaygroundGetAll() ([]*types.Playground, error) {
+	playgrounds := []*types.Playground{}
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(playgroundsBucket).ForEach(func(k, v []byte) error {
+			var p *types.Playground
+			if err := json.Unmarshal(v, &p); err != nil {
+				return err
+			}
+
+			playgrounds = append(playgrounds, p)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return playgrounds, nil
+}
+
+func (store *boltStorage) PlaygroundPut(playground *types.Playground) error {
+	return store.update(func(tx *bolt.Tx, notify func(WatchEvent)) error {
+		if err := boltPut(tx, playgroundsBucket, playground.Id, playground); err != nil {
+			return err
+		}
+
+		notify(WatchEvent{Kind: KindPlayground, Op: OpPut, Id: playground.Id, Playground: playground})
+
+		return nil
+	})
+}
+
+func (store *boltStorage) LeaseAcquire(name, holder string, ttl time.Duration) (*types.Lease, error) {
+	var lease *types.Lease
+
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		var current *types.Lease
+		if err := boltGet(tx, leasesBucket, name, &current); err != nil && !NotFound(err) {
+			return err
+		}
+
+		var taken bool
+		lease, taken = takeLease(current, name, holder, ttl, time.Now())
+		if !taken {
+			return nil
+		}
+
+		return boltPut(tx, leasesBucket, name, lease)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return lease, nil
+}
+
+func (store *boltStorage) LeaseRelease(name, holder string) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		var lease *types.Lease
+		if err := boltGet(tx, leasesBucket, name, &lease); err != nil {
+			if NotFound(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		if lease.Holder != holder {
+			return nil
+		}
+
+		return tx.Bucket(leasesBucket).Delete([]byte(name))
+	})
+}
+
+func (store *boltStorage) dump() (*DB, error) {
+	db := newDB()
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		buckets := []struct {
+			name []byte
+			into interface{}
+		}{
+			{sessionsBucket, &db.Sessions},
+			{instancesBucket, &db.Instances},
+			{clientsBucket, &db.Clients},
+			{windowsInstancesBucket, &db.WindowsInstances},
+			{loginRequestsBucket, &db.LoginRequests},
+			{usersBucket, &db.Users},
+			{playgroundsBucket, &db.Playgrounds},
+		}
+
+		for _, b := range buckets {
+			raw := map[string]json.RawMessage{}
+			tx.Bucket(b.name).ForEach(func(k, v []byte) error {
+				raw[string(k)] = json.RawMessage(v)
+				return nil
+			})
+
+			encoded, err := json.Marshal(raw)
+			if err != nil {
+				return err
+			}
+
+			if err := json.Unmarshal(encoded, b.into); err != nil {
+				return err
+			}
+		}
+
+		indexes := []struct {
+			name []byte
+			into map[string][]string
+		}{
+			{windowsInstancesBySessionIdBucket, db.WindowsInstancesBySessionId},
+			{instancesBySessionIdBucket, db.InstancesBySessionId},
+			{clientsBySessionIdBucket, db.ClientsBySessionId},
+		}
+
+		for _, index := range indexes {
+			tx.Bucket(index.name).ForEachBucket(func(k []byte) error {
+				index.into[string(k)] = boltIndexKeys(tx, index.name, string(k))
+				return nil
+			})
+		}
+
+		db.Version = boltVersion(tx)
+
+		return tx.Bucket(usersByProviderBucket).ForEach(func(k, v []byte) error {
+			db.UsersByProvider[string(k)] = string(v)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func (store *boltStorage) restore(db *DB) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range boltBuckets {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+
+			if _, err := tx.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+
+		for id, s := range db.Sessions {
+			if err := boltPut(tx, sessionsBucket, id, s); err != nil {
+				return err
+			}
+		}
+
+		for name, i := range db.Instances {
+			if err := boltPut(tx, instancesBucket, name, i); err != nil {
+				return err
+			}
+		}
+
+		for id, c := range db.Clients {
+			if err := boltPut(tx, clientsBucket, id, c); err != nil {
+				return err
+			}
+		}
+
+		for id, i := range db.WindowsInstances {
+			if err := boltPut(tx, windowsInstancesBucket, id, i); err != nil {
+				return err
+			}
+		}
+
+		for id, lr := range db.LoginRequests {
+			if err := boltPut(tx, loginRequestsBucket, id, lr); err != nil {
+				return err
+			}
+		}
+
+		for id, u := range db.Users {
+			if err := boltPut(tx, usersBucket, id, u); err != nil {
+				return err
+			}
+		}
+
+		for id, p := range db.Playgrounds {
+			if err := boltPut(tx, playgroundsBucket, id, p); err != nil {
+				return err
+			}
+		}
+
+		indexes := []struct {
+			name []byte
+			from map[string][]string
+		}{
+			{windowsInstancesBySessionIdBucket, db.WindowsInstancesBySessionId},
+			{instancesBySessionIdBucket, db.InstancesBySessionId},
+			{clientsBySessionIdBucket, db.ClientsBySessionId},
+		}
+
+		for _, index := range indexes {
+			for sessionId, keys := range index.from {
+				for _, key := range keys {
+					if err := boltIndexAdd(tx, index.name, sessionId, key); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		for key, userId := range db.UsersByProvider {
+			if err := tx.Bucket(usersByProviderBucket).Put([]byte(key), []byte(userId)); err != nil {
+				return err
+			}
+		}
+
+		return tx.Bucket(metaBucket).Put(versionKey, []byte(strconv.Itoa(db.Version)))
+	})
+}
@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/dimaskiddo/play-with-docker/pwd/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func newBoltTestStorage(t *testing.T, db *DB) *boltStorage {
+	s, err := NewBoltStorage(filepath.Join(t.TempDir(), "pwd.db"))
+	assert.Nil(t, err)
+
+	store := s.(*boltStorage)
+	t.Cleanup(func() { store.db.Close() })
+
+	if db != nil {
+		assert.Nil(t, store.restore(db))
+	}
+
+	return store
+}
+
+func newBoltFactoryStorage(t *testing.T, db *DB) (StorageApi, func() *DB) {
+	storage := newBoltTestStorage(t, db)
+
+	return storage, func() *DB {
+		loaded, err := storage.dump()
+		assert.Nil(t, err)
+
+		return loaded
+	}
+}
+
+func TestBoltSessionPut(t *testing.T) {
+	testSessionPut(t, newBoltFactoryStorage)
+}
+
+func TestBoltSessionGet(t *testing.T) {
+	testSessionGet(t, newBoltFactoryStorage)
+}
+
+func TestBoltSessionGetAll(t *testing.T) {
+	testSessionGetAll(t, newBoltFactoryStorage)
+}
+
+func TestBoltSessionDelete(t *testing.T) {
+	testSessionDelete(t, newBoltFactoryStorage)
+}
+
+func TestBoltInstanceGet(t *testing.T) {
+	testInstanceGet(t, newBoltFactoryStorage)
+}
+
+func TestBoltInstancePut(t *testing.T) {
+	testInstancePut(t, newBoltFactoryStorage)
+}
+
+func TestBoltInstanceDelete(t *testing.T) {
+	testInstanceDelete(t, newBoltFactoryStorage)
+}
+
+func TestBoltInstanceFindBySessionId(t *testing.T) {
+	testInstanceFindBySessionId(t, newBoltFactoryStorage)
+}
+
+func TestBoltWindowsInstanceGetAll(t *testing.T) {
+	testWindowsInstanceGetAll(t, newBoltFactoryStorage)
+}
+
+func TestBoltWindowsInstancePut(t *testing.T) {
+	testWindowsInstancePut(t, newBoltFactoryStorage)
+}
+
+func TestBoltWindowsInstanceDelete(t *testing.T) {
+	testWindowsInstanceDelete(t, newBoltFactoryStorage)
+}
+
+func TestBoltClientGet(t *testing.T) {
+	testClientGet(t, newBoltFactoryStorage)
+}
+
+func TestBoltClientPut(t *testing.T) {
+	testClientPut(t, newBoltFactoryStorage)
+}
+
+func TestBoltClientDelete(t *testing.T) {
+	testClientDelete(t, newBoltFactoryStorage)
+}
+
+func TestBoltClientFindBySessionId(t *testing.T) {
+	testClientFindBySessionId(t, newBoltFactoryStorage)
+}
+
+func TestBoltLoginRequest(t *testing.T) {
+	testLoginRequest(t, newBoltFactoryStorage)
+}
+
+func TestBoltUserFindByProvider(t *testing.T) {
+	testUserFindByProvider(t, newBoltFactoryStorage)
+}
+
+func TestBoltPlaygroundGet(t *testing.T) {
+	testPlaygroundGet(t, newBoltFactoryStorage)
+}
+
+func TestBoltPlaygroundPut(t *testing.T) {
+	testPlaygroundPut(t, newBoltFactoryStorage)
+}
+
+func TestBoltPlaygroundGetAll(t *testing.T) {
+	testPlaygroundGetAll(t, newBoltFactoryStorage)
+}
+
+func TestBoltReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pwd.db")
+
+	storage, err := NewBoltStorage(path)
+	assert.Nil(t, err)
+
+	s := &types.Session{Id: "aaabbbccc"}
+	err = storage.SessionPut(s)
+	assert.Nil(t, err)
+
+	storage.(*boltStorage).db.Close()
+
+	storage, err = NewBoltStorage(path)
+	assert.Nil(t, err)
+	defer storage.(*boltStorage).db.Close()
+
+	found, err := storage.SessionGet(s.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, s, found)
+}
+
+func TestBoltDeleteExpired(t *testing.T) {
+	testDeleteExpired(t, newBoltTestStorage(t, nil))
+}
+
+func TestBoltSessionTouch(t *testing.T) {
+	testSessionTouch(t, newBoltTestStorage(t, nil))
+}
+
+func TestBoltSessionIdleWarn(t *testing.T) {
+	testSessionIdleWarn(t, newBoltTestStorage(t, nil))
+}
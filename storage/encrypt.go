@@ -0,0 +1,259 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/dimaskiddo/play-with-docker/pwd/types"
+)
+
+// encryptedStorage encrypts the TLS keys of instances and the OAuth secrets
+// of playgrounds before they reach the wrapped storage and decrypts them on
+// the way back. Records are copied, so the callers' values are never
+// modified.
+type encryptedStorage struct {
+	StorageApi
+
+	keys *Keyring
+}
+
+func NewEncryptedStorage(s StorageApi, keys *Keyring) StorageApi {
+	return &encryptedStorage{StorageApi: s, keys: keys}
+}
+
+// secretField names a secret field of a record. It is authenticated along
+// with the sealed value, so the value cannot be moved to another field or
+// another record.
+func secretField(kind Kind, id, field string) string {
+	return fmt.Sprintf("%s:%s:%s", kind, id, field)
+}
+
+func instanceSecrets(i *types.Instance) map[string]*[]byte {
+	return map[string]*[]byte{
+		secretField(KindInstance, i.Name, "server_key"): &i.ServerKey,
+		secretField(KindInstance, i.Name, "key"):        &i.Key,
+		secretField(KindInstance, i.Name, "ca_cert"):    &i.CACert,
+	}
+}
+
+func (store *encryptedStorage) encryptInstance(instance *types.Instance) (*types.Instance, error) {
+	i := *instance
+
+	for field, value := range instanceSecrets(&i) {
+		b, err := store.keys.encryptBytes(field, *value)
+		if err != nil {
+			return nil, err
+		}
+		*value = b
+	}
+
+	return &i, nil
+}
+
+func (store *encryptedStorage) decryptInstance(instance *types.Instance) (*types.Instance, error) {
+	if instance == nil {
+		return nil, nil
+	}
+
+	i := *instance
+
+	for field, value := range instanceSecrets(&i) {
+		b, err := store.keys.decryptBytes(field, *value)
+		if err != nil {
+			return nil, err
+		}
+		*value = b
+	}
+
+	return &i, nil
+}
+
+func playgroundSecrets(p *types.Playground) map[string]*string {
+	secrets := map[string]*string{
+		secretField(KindPlayground, p.Id, "docker_client_secret"): &p.DockerClientSecret,
+		secretField(KindPlayground, p.Id, "github_client_secret"): &p.GithubClientSecret,
+		secretField(KindPlayground, p.Id, "google_client_secret"): &p.GoogleClientSecret,
+		secretField(KindPlayground, p.Id, "azure_client_secret"):  &p.AzureClientSecret,
+		secretField(KindPlayground, p.Id, "oidc_client_secret"):   &p.OIDCClientSecret,
+	}
+
+	for i := range p.Webhooks {
+		secrets[secretField(KindPlayground, p.Id, fmt.Sprintf("webhooks.%d.secret", i))] = &p.Webhooks[i].Secret
+	}
+
+	return secrets
+}
+
+func (store *encryptedStorage) encryptPlayground(playground *types.Playground) (*types.Playground, error) {
+	p := *playground
+	p.Webhooks = append([]types.Webhook(nil), p.Webhooks...)
+
+	for field, value := range playgroundSecrets(&p) {
+		if err := store.keys.encryptString(field, value); err != nil {
+			return nil, err
+		}
+	}
+
+	return &p, nil
+}
+
+func (store *encryptedStorage) decryptPlayground(playground *types.Playground) (*types.Playground, error) {
+	if playground == nil {
+		return nil, nil
+	}
+
+	p := *playground
+	p.Webhooks = append([]types.Webhook(nil), p.Webhooks...)
+
+	for field, value := range playgroundSecrets(&p) {
+		if err := store.keys.decryptString(field, value); err != nil {
+			return nil, err
+		}
+	}
+
+	return &p, nil
+}
+
+func (store *encryptedStorage) InstanceGet(name string) (*types.Instance, error) {
+	instance, err := store.StorageApi.InstanceGet(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.decryptInstance(instance)
+}
+
+func (store *encryptedStorage) InstanceFindBySessionId(sessionId string) ([]*types.Instance, error) {
+	instances, err := store.StorageApi.InstanceFindBySessionId(sessionId)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.decryptInstances(instances)
+}
+
+func (store *encryptedStorage) InstanceFindByImage(image string, page Page) ([]*types.Instance, string, error) {
+	instances, next, err := store.StorageApi.InstanceFindByImage(image, page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	instances, err = store.decryptInstances(instances)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return instances, next, nil
+}
+
+func (store *encryptedStorage) decryptInstances(instances []*types.Instance) ([]*types.Instance, error) {
+	decrypted := make([]*types.Instance, len(instances))
+
+	for n, instance := range instances {
+		i, err := store.decryptInstance(instance)
+		if err != nil {
+			return nil, err
+		}
+
+		decrypted[n] = i
+	}
+
+	return decrypted, nil
+}
+
+func (store *encryptedStorage) InstancePut(instance *types.Instance) error {
+	i, err := store.encryptInstance(instance)
+	if err != nil {
+		return err
+	}
+
+	return store.StorageApi.InstancePut(i)
+}
+
+func (store *encryptedStorage) PlaygroundGet(id string) (*types.Playground, error) {
+	playground, err := store.StorageApi.PlaygroundGet(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.decryptPlayground(playground)
+}
+
+func (store *encryptedStorage) PlaygroundGetAll() ([]*types.Playground, error) {
+	playgrounds, err := store.StorageApi.PlaygroundGetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	decrypted := make([]*types.Playground, len(playgrounds))
+
+	for n, playground := range playgrounds {
+		p, err := store.decryptPlayground(playground)
+		if err != nil {
+			return nil, err
+		}
+
+		decrypted[n] = p
+	}
+
+	return decrypted, nil
+}
+
+func (store *encryptedStorage) PlaygroundPut(playground *types.Playground) error {
+	p, err := store.encryptPlayground(playground)
+	if err != nil {
+		return err
+	}
+
+	return store.StorageApi.PlaygroundPut(p)
+}
+
+// Watch decrypts the records carried by the events of the wrapped storage.
+// Events whose record cannot be decrypted are dropped.
+func (store *encryptedStorage) Watch(kind Kind, filter WatchFilter) (*Watch, error) {
+	inner, err := store.StorageApi.Watch(kind, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	hub := NewWatchHub()
+
+	w, err := hub.Watch(kind, nil)
+	if err != nil {
+		inner.Close()
+		return nil, err
+	}
+
+	go func() {
+		defer inner.Close()
+
+		var err error
+
+		for {
+			select {
+			case e, ok := <-inner.C:
+				if !ok {
+					w.Close()
+					return
+				}
+
+				if e.Instance != nil {
+					if e.Instance, err = store.decryptInstance(e.Instance); err != nil {
+						continue
+					}
+				}
+
+				if e.Playground != nil {
+					if e.Playground, err = store.decryptPlayground(e.Playground); err != nil {
+						continue
+					}
+				}
+
+				hub.Publish(e)
+			case <-w.done:
+				return
+			}
+		}
+	}()
+
+	return w, nil
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/dimaskiddo/play-with-docker/pwd/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestKey(t *testing.T) string {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	assert.Nil(t, err)
+
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func TestEncryptedStorage(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "session")
+
+	oldKey := newTestKey(t)
+	keys, err := ReadKeyring(oldKey, "")
+	assert.Nil(t, err)
+
+	fs, err := NewFileStorage(path)
+	assert.Nil(t, err)
+	s := NewEncryptedStorage(fs, keys)
+
+	session := &types.Session{Id: "s1"}
+	instance := &types.Instance{Name: "i1", SessionId: session.Id, ServerKey: []byte("server key"), Key: []byte("key"), CACert: []byte("ca cert"), Cert: []byte("cert")}
+	playground := &types.Playground{Id: "p1", GithubClientID: "github id", GithubClientSecret: "github secret", OIDCClientSecret: "oidc secret", Webhooks: []types.Webhook{{URL: "http://lms", Secret: "webhook secret"}}}
+
+	w, err := s.Watch(KindInstance, nil)
+	assert.Nil(t, err)
+	defer w.Close()
+
+	assert.Nil(t, s.SessionPut(session))
+	assert.Nil(t, s.InstancePut(instance))
+	assert.Nil(t, s.PlaygroundPut(playground))
+
+	assert.Equal(t, []byte("server key"), instance.ServerKey)
+	assert.Equal(t, "webhook secret", playground.Webhooks[0].Secret)
+	assert.Equal(t, instance, nextEvent(t, w).Instance)
+
+	raw, err := fs.InstanceGet(instance.Name)
+	assert.Nil(t, err)
+	assert.True(t, isSealed(raw.ServerKey))
+	assert.Equal(t, instance.Cert, raw.Cert)
+
+	journal, err := ioutil.ReadFile(journalPath(path))
+	assert.Nil(t, err)
+	for _, secret := range []string{"server key", "ca cert", "github secret", "oidc secret", "webhook secret"} {
+		assert.False(t, bytes.Contains(journal, []byte(secret)), secret)
+		assert.False(t, bytes.Contains(journal, []byte(base64.StdEncoding.EncodeToString([]byte(secret)))), secret)
+	}
+	assert.True(t, bytes.Contains(journal, []byte("github id")))
+
+	found, err := s.InstanceGet(instance.Name)
+	assert.Nil(t, err)
+	assert.Equal(t, instance, found)
+
+	foundPlayground, err := s.PlaygroundGet(playground.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, playground, foundPlayground)
+
+	// Rotate: the new key encrypts, the old one still decrypts.
+	newKey := newTestKey(t)
+	keyFile := filepath.Join(dir, "keys")
+	assert.Nil(t, ioutil.WriteFile(keyFile, []byte(newKey+"\n# retired after rekeying\n"+oldKey+"\n"), 0600))
+
+	keys, err = ReadKeyring("", keyFile)
+	assert.Nil(t, err)
+	s = NewEncryptedStorage(fs, keys)
+
+	found, err = s.InstanceGet(instance.Name)
+	assert.Nil(t, err)
+	assert.Equal(t, instance, found)
+	assert.Nil(t, s.InstancePut(found))
+
+	keys, err = ReadKeyring(newKey, "")
+	assert.Nil(t, err)
+	s = NewEncryptedStorage(fs, keys)
+
+	found, err = s.InstanceGet(instance.Name)
+	assert.Nil(t, err)
+	assert.Equal(t, instance, found)
+
+	_, err = s.PlaygroundGet(playground.Id)
+	assert.NotNil(t, err)
+
+	// A sealed value moved to another instance does not decrypt.
+	other := &types.Instance{Name: "i2", SessionId: session.Id, Key: []byte("other key")}
+	assert.Nil(t, s.InstancePut(other))
+
+	raw, err = fs.InstanceGet(other.Name)
+	assert.Nil(t, err)
+	sealed, err := fs.InstanceGet(instance.Name)
+	assert.Nil(t, err)
+	raw.Key = sealed.Key
+	assert.Nil(t, fs.InstancePut(raw))
+
+	_, err = s.InstanceGet(other.Name)
+	assert.NotNil(t, err)
+}
+
+func TestEncryptedStorageClearText(t *testing.T) {
+	fs, err := NewFileStorage(filepath.Join(t.TempDir(), "session"))
+	assert.Nil(t, err)
+
+	playground := &types.Playground{Id: "p1", GithubClientSecret: "github secret"}
+	assert.Nil(t, fs.PlaygroundPut(playground))
+
+	keys, err := ReadKeyring(newTestKey(t), "")
+	assert.Nil(t, err)
+	s := NewEncryptedStorage(fs, keys)
+
+	found, err := s.PlaygroundGet(playground.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, playground, found)
+}
+
+func TestReadKeyring(t *testing.T) {
+	keys, err := ReadKeyring("", "")
+	assert.Nil(t, err)
+	assert.Nil(t, keys)
+
+	_, err = ReadKeyring(base64.StdEncoding.EncodeToString([]byte("short")), "")
+	assert.NotNil(t, err)
+
+	_, err = ReadKeyring("not base64!", "")
+	assert.NotNil(t, err)
+}
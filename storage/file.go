@@ -3,19 +3,28 @@ package storage
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/dimaskiddo/play-with-docker/pwd/types"
 )
 
 type storage struct {
-	rw   sync.Mutex
-	path string
-	db   *DB
+	rw       sync.Mutex
+	path     string
+	db       *DB
+	journal  *os.File
+	offset   int64
+	snapshot os.FileInfo
+	pending  int
+	hub      *WatchHub
+	tailing  bool
 }
 
 type DB struct {
+	Version                     int                               `json:"version"`
 	Sessions                    map[string]*types.Session         `json:"sessions"`
 	Instances                   map[string]*types.Instance        `json:"instances"`
 	Clients                     map[string]*types.Client          `json:"clients"`
@@ -27,10 +36,31 @@ type DB struct {
 	InstancesBySessionId        map[string][]string               `json:"instances_by_session_id"`
 	ClientsBySessionId          map[string][]string               `json:"clients_by_session_id"`
 	UsersByProvider             map[string]string                 `json:"users_by_providers"`
+	Leases                      map[string]*types.Lease           `json:"leases,omitempty"`
+
+	hub *WatchHub
+}
+
+func newDB() *DB {
+	return &DB{
+		Version:                     SchemaVersion,
+		Sessions:                    map[string]*types.Session{},
+		Instances:                   map[string]*types.Instance{},
+		Clients:                     map[string]*types.Client{},
+		WindowsInstances:            map[string]*types.WindowsInstance{},
+		LoginRequests:               map[string]*types.LoginRequest{},
+		Users:                       map[string]*types.User{},
+		Playgrounds:                 map[string]*types.Playground{},
+		WindowsInstancesBySessionId: map[string][]string{},
+		InstancesBySessionId:        map[string][]string{},
+		ClientsBySessionId:          map[string][]string{},
+		UsersByProvider:             map[string]string{},
+		Leases:                      map[string]*types.Lease{},
+	}
 }
 
 func NewFileStorage(path string) (StorageApi, error) {
-	s := &storage{path: path}
+	s := &storage{path: path, hub: NewWatchHub()}
 
 	err := s.load()
 	if err != nil {
@@ -40,48 +70,273 @@ func NewFileStorage(path string) (StorageApi, error) {
 	return s, nil
 }
 
+// load reads the last snapshot, replays the journal on top of it and runs any
+// pending migrations. If anything changed it is folded into a fresh snapshot
+// right away.
 func (store *storage) load() error {
-	file, err := os.Open(store.path)
-
+	f, err := os.OpenFile(journalPath(store.path), os.O_RDWR|os.O_APPEND, 0)
 	if err == nil {
-		decoder := json.NewDecoder(file)
-		err = decoder.Decode(&store.db)
+		store.journal = f
 
-		if err != nil {
+		if err := lockFile(f); err != nil {
 			return err
 		}
+		defer unlockFile(f)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	db, info, err := readSnapshot(store.path)
+	if err != nil {
+		return err
+	}
+
+	n, offset, err := replayJournal(journalPath(store.path), db, 0, true)
+	if err != nil {
+		return err
+	}
+
+	m, err := db.migrate()
+	if err != nil {
+		return err
+	}
+
+	db.hub = store.hub
+	store.db = db
+	store.offset = offset
+	store.snapshot = info
+
+	if n > 0 || m > 0 {
+		return store.compact()
+	}
+
+	return nil
+}
+
+func readSnapshot(path string) (*DB, os.FileInfo, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return newDB(), nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var db *DB
+
+	err = json.NewDecoder(file).Decode(&db)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decode %s: %v", path, err)
+	}
+
+	return db, info, nil
+}
+
+// lockForUpdate locks the storage for this process and, through the journal,
+// for any other process sharing it. Changes those processes made are applied
+// before returning, so updates always start from the latest state.
+func (store *storage) lockForUpdate() (func(), error) {
+	store.rw.Lock()
+
+	if store.journal == nil {
+		f, err := openJournal(journalPath(store.path))
+		if err != nil {
+			store.rw.Unlock()
+			return nil, err
+		}
+
+		store.journal = f
+	}
+
+	if err := lockFile(store.journal); err != nil {
+		store.rw.Unlock()
+		return nil, err
+	}
+
+	unlock := func() {
+		unlockFile(store.journal)
+		store.rw.Unlock()
+	}
+
+	if err := store.catchUp(); err != nil {
+		unlock()
+		return nil, err
+	}
+
+	return unlock, nil
+}
+
+// catchUp applies what other processes wrote since the last call. It must be
+// called with the journal locked.
+func (store *storage) catchUp() error {
+	info, err := os.Stat(store.path)
+	if os.IsNotExist(err) {
+		info, err = nil, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if (info == nil) != (store.snapshot == nil) || (info != nil && !os.SameFile(info, store.snapshot)) {
+		return store.reload()
+	}
+
+	n, offset, err := replayJournal(journalPath(store.path), store.db, store.offset, false)
+	if err != nil {
+		return err
+	}
+
+	store.offset = offset
+	store.pending += n
+
+	return nil
+}
+
+// reload replaces the DB after another process compacted the storage and
+// publishes the differences with the previous one.
+func (store *storage) reload() error {
+	db, info, err := readSnapshot(store.path)
+	if err != nil {
+		return err
+	}
+
+	n, offset, err := replayJournal(journalPath(store.path), db, 0, false)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.migrate()
+	if err != nil {
+		return err
+	}
+
+	db.hub = store.hub
+	publishDiff(store.hub, store.db, db)
+
+	store.db = db
+	store.offset = offset
+	store.snapshot = info
+	store.pending = n
+
+	return nil
+}
+
+// compact writes the whole DB as a new snapshot and empties the journal.
+func (store *storage) compact() error {
+	err := writeFileAtomic(store.path, func(f *os.File) error {
+		return json.NewEncoder(f).Encode(&store.db)
+	})
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(store.path)
+	if err != nil {
+		return err
+	}
+
+	if store.journal != nil {
+		err = store.journal.Truncate(0)
 	} else {
-		store.db = &DB{
-			Sessions:                    map[string]*types.Session{},
-			Instances:                   map[string]*types.Instance{},
-			Clients:                     map[string]*types.Client{},
-			WindowsInstances:            map[string]*types.WindowsInstance{},
-			LoginRequests:               map[string]*types.LoginRequest{},
-			Users:                       map[string]*types.User{},
-			Playgrounds:                 map[string]*types.Playground{},
-			WindowsInstancesBySessionId: map[string][]string{},
-			InstancesBySessionId:        map[string][]string{},
-			ClientsBySessionId:          map[string][]string{},
-			UsersByProvider:             map[string]string{},
+		err = os.Truncate(journalPath(store.path), 0)
+		if os.IsNotExist(err) {
+			err = nil
 		}
 	}
+	if err != nil {
+		return err
+	}
 
-	file.Close()
+	store.snapshot = info
+	store.offset = 0
+	store.pending = 0
 
 	return nil
 }
 
-func (store *storage) save() error {
-	file, err := os.Create(store.path)
+// save appends the change to the journal and only then applies it to the
+// in-memory state, so a failed write leaves both as they were.
+func (store *storage) save(op Op, kind Kind, id string, value interface{}, apply func()) error {
+	n, err := appendJournal(store.journal, op, kind, id, value)
 	if err != nil {
+		// Drop what may have been written, later entries would follow it.
+		if terr := store.journal.Truncate(store.offset); terr != nil {
+			log.Printf("Error truncating journal of %s. Got: %v\n", store.path, terr)
+		}
+
 		return err
 	}
-	defer file.Close()
 
-	encoder := json.NewEncoder(file)
-	err = encoder.Encode(&store.db)
+	store.offset += int64(n)
+	apply()
+
+	store.pending++
+	if store.pending >= journalCompactEvery {
+		// The change is in the journal already, compacting is retried later.
+		if err := store.compact(); err != nil {
+			log.Printf("Error compacting storage %s. Got: %v\n", store.path, err)
+		}
+	}
+
+	return nil
+}
+
+func (store *storage) Watch(kind Kind, filter WatchFilter) (*Watch, error) {
+	w, err := store.hub.Watch(kind, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	if !store.tailing {
+		store.tailing = true
+		go store.tail(journalTailInterval)
+	}
 
-	return err
+	return w, nil
+}
+
+// tail follows the journal while there are watches, so they also see the
+// changes made by other processes sharing the storage.
+func (store *storage) tail(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		store.rw.Lock()
+
+		if !store.hub.Watching() {
+			store.tailing = false
+			store.rw.Unlock()
+			return
+		}
+
+		if store.journal == nil {
+			if f, err := os.OpenFile(journalPath(store.path), os.O_RDWR|os.O_APPEND, 0); err == nil {
+				store.journal = f
+			}
+		}
+
+		if store.journal != nil {
+			if err := lockFile(store.journal); err == nil {
+				if err := store.catchUp(); err != nil {
+					log.Printf("Error following storage journal. Got: %v\n", err)
+				}
+
+				unlockFile(store.journal)
+			}
+		}
+
+		store.rw.Unlock()
+	}
 }
 
 func (store *storage) SessionGet(id string) (*types.Session, error) {
@@ -112,41 +367,75 @@ func (store *storage) SessionGetAll() ([]*types.Session, error) {
 }
 
 func (store *storage) SessionPut(session *types.Session) error {
-	store.rw.Lock()
-	defer store.rw.Unlock()
-
-	store.db.Sessions[session.Id] = session
+	unlock, err := store.lockForUpdate()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
-	return store.save()
+	return store.save(OpPut, KindSession, session.Id, session, func() {
+		store.db.sessionPut(session)
+	})
 }
 
-func (store *storage) SessionDelete(id string) error {
-	store.rw.Lock()
-	defer store.rw.Unlock()
+func (store *storage) SessionTouch(id string, at time.Time) error {
+	unlock, err := store.lockForUpdate()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
-	_, found := store.db.Sessions[id]
+	s, found := store.db.Sessions[id]
 	if !found {
-		return nil
+		return NotFoundError
 	}
 
-	for _, i := range store.db.WindowsInstancesBySessionId[id] {
-		delete(store.db.WindowsInstances, i)
+	// The stored session is shared with the callers of SessionGet, so it is
+	// replaced instead of changed.
+	touched := *s
+	touched.LastActivity = at
+	touched.IdleWarnedAt = time.Time{}
+
+	return store.save(OpPut, KindSession, id, &touched, func() {
+		store.db.sessionPut(&touched)
+	})
+}
+
+func (store *storage) SessionIdleWarn(id string, at time.Time) error {
+	unlock, err := store.lockForUpdate()
+	if err != nil {
+		return err
 	}
+	defer unlock()
 
-	store.db.WindowsInstancesBySessionId[id] = []string{}
-	for _, i := range store.db.InstancesBySessionId[id] {
-		delete(store.db.Instances, i)
+	s, found := store.db.Sessions[id]
+	if !found {
+		return NotFoundError
 	}
 
-	store.db.InstancesBySessionId[id] = []string{}
-	for _, i := range store.db.ClientsBySessionId[id] {
-		delete(store.db.Clients, i)
+	warned := *s
+	warned.IdleWarnedAt = at
+
+	return store.save(OpPut, KindSession, id, &warned, func() {
+		store.db.sessionPut(&warned)
+	})
+}
+
+func (store *storage) SessionDelete(id string) error {
+	unlock, err := store.lockForUpdate()
+	if err != nil {
+		return err
 	}
+	defer unlock()
 
-	store.db.ClientsBySessionId[id] = []string{}
-	delete(store.db.Sessions, id)
+	_, found := store.db.Sessions[id]
+	if !found {
+		return nil
+	}
 
-	return store.save()
+	return store.save(OpDelete, KindSession, id, nil, func() {
+		store.db.sessionDelete(id)
+	})
 }
 
 func (store *storage) SessionCount() (int, error) {
@@ -156,6 +445,48 @@ func (store *storage) SessionCount() (int, error) {
 	return len(store.db.Sessions), nil
 }
 
+func (store *storage) SessionFindByUserId(userId string, page Page) ([]*types.Session, string, error) {
+	return store.sessionFind(page, func(s *types.Session) bool {
+		return s.UserId == userId
+	})
+}
+
+func (store *storage) SessionFindByPlaygroundId(playgroundId string, page Page) ([]*types.Session, string, error) {
+	return store.sessionFind(page, func(s *types.Session) bool {
+		return s.PlaygroundId == playgroundId
+	})
+}
+
+func (store *storage) SessionFindExpiringBefore(t time.Time, page Page) ([]*types.Session, string, error) {
+	return store.sessionFind(page, func(s *types.Session) bool {
+		return !s.ExpiresAt.IsZero() && s.ExpiresAt.Before(t)
+	})
+}
+
+func (store *storage) sessionFind(page Page, match func(s *types.Session) bool) ([]*types.Session, string, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	ids := []string{}
+	for id, s := range store.db.Sessions {
+		if match(s) {
+			ids = append(ids, id)
+		}
+	}
+
+	ids, next, err := pageKeys(ids, page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	sessions := make([]*types.Session, len(ids))
+	for i, id := range ids {
+		sessions[i] = store.db.Sessions[id]
+	}
+
+	return sessions, next, nil
+}
+
 func (store *storage) InstanceGet(name string) (*types.Instance, error) {
 	store.rw.Lock()
 	defer store.rw.Unlock()
@@ -183,59 +514,68 @@ func (store *storage) InstanceFindBySessionId(sessionId string) ([]*types.Instan
 }
 
 func (store *storage) InstancePut(instance *types.Instance) error {
-	store.rw.Lock()
-	defer store.rw.Unlock()
+	unlock, err := store.lockForUpdate()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	_, found := store.db.Sessions[string(instance.SessionId)]
 	if !found {
 		return NotFoundError
 	}
 
-	store.db.Instances[instance.Name] = instance
-	found = false
+	return store.save(OpPut, KindInstance, instance.Name, instance, func() {
+		store.db.instancePut(instance)
+	})
+}
 
-	for _, i := range store.db.InstancesBySessionId[string(instance.SessionId)] {
-		if i == instance.Name {
-			found = true
-			break
-		}
+func (store *storage) InstanceDelete(name string) error {
+	unlock, err := store.lockForUpdate()
+	if err != nil {
+		return err
 	}
+	defer unlock()
 
+	_, found := store.db.Instances[name]
 	if !found {
-		store.db.InstancesBySessionId[string(instance.SessionId)] = append(store.db.InstancesBySessionId[string(instance.SessionId)], instance.Name)
+		return nil
 	}
 
-	return store.save()
+	return store.save(OpDelete, KindInstance, name, nil, func() {
+		store.db.instanceDelete(name)
+	})
 }
 
-func (store *storage) InstanceDelete(name string) error {
+func (store *storage) InstanceCount() (int, error) {
 	store.rw.Lock()
 	defer store.rw.Unlock()
 
-	instance, found := store.db.Instances[name]
-	if !found {
-		return nil
-	}
+	return len(store.db.Instances), nil
+}
 
-	instances := store.db.InstancesBySessionId[string(instance.SessionId)]
-	for n, i := range instances {
-		if i == name {
-			instances = append(instances[:n], instances[n+1:]...)
-			break
+func (store *storage) InstanceFindByImage(image string, page Page) ([]*types.Instance, string, error) {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+
+	names := []string{}
+	for name, i := range store.db.Instances {
+		if i.Image == image {
+			names = append(names, name)
 		}
 	}
 
-	store.db.InstancesBySessionId[string(instance.SessionId)] = instances
-	delete(store.db.Instances, name)
-
-	return store.save()
-}
+	names, next, err := pageKeys(names, page)
+	if err != nil {
+		return nil, "", err
+	}
 
-func (store *storage) InstanceCount() (int, error) {
-	store.rw.Lock()
-	defer store.rw.Unlock()
+	instances := make([]*types.Instance, len(names))
+	for i, name := range names {
+		instances[i] = store.db.Instances[name]
+	}
 
-	return len(store.db.Instances), nil
+	return instances, next, nil
 }
 
 func (store *storage) WindowsInstanceGetAll() ([]*types.WindowsInstance, error) {
@@ -252,52 +592,37 @@ func (store *storage) WindowsInstanceGetAll() ([]*types.WindowsInstance, error)
 }
 
 func (store *storage) WindowsInstancePut(instance *types.WindowsInstance) error {
-	store.rw.Lock()
-	defer store.rw.Unlock()
+	unlock, err := store.lockForUpdate()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	_, found := store.db.Sessions[string(instance.SessionId)]
 	if !found {
 		return NotFoundError
 	}
 
-	store.db.WindowsInstances[instance.Id] = instance
-	found = false
-
-	for _, i := range store.db.WindowsInstancesBySessionId[string(instance.SessionId)] {
-		if i == instance.Id {
-			found = true
-			break
-		}
-	}
-
-	if !found {
-		store.db.WindowsInstancesBySessionId[string(instance.SessionId)] = append(store.db.WindowsInstancesBySessionId[string(instance.SessionId)], instance.Id)
-	}
-
-	return store.save()
+	return store.save(OpPut, KindWindowsInstance, instance.Id, instance, func() {
+		store.db.windowsInstancePut(instance)
+	})
 }
 
 func (store *storage) WindowsInstanceDelete(id string) error {
-	store.rw.Lock()
-	defer store.rw.Unlock()
+	unlock, err := store.lockForUpdate()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
-	instance, found := store.db.WindowsInstances[id]
+	_, found := store.db.WindowsInstances[id]
 	if !found {
 		return nil
 	}
 
-	instances := store.db.WindowsInstancesBySessionId[string(instance.SessionId)]
-	for n, i := range instances {
-		if i == id {
-			instances = append(instances[:n], instances[n+1:]...)
-			break
-		}
-	}
-
-	store.db.WindowsInstancesBySessionId[string(instance.SessionId)] = instances
-	delete(store.db.WindowsInstances, id)
-
-	return store.save()
+	return store.save(OpDelete, KindWindowsInstance, id, nil, func() {
+		store.db.windowsInstanceDelete(id)
+	})
 }
 
 func (store *storage) ClientGet(id string) (*types.Client, error) {
@@ -327,59 +652,69 @@ func (store *storage) ClientFindBySessionId(sessionId string) ([]*types.Client,
 }
 
 func (store *storage) ClientPut(client *types.Client) error {
-	store.rw.Lock()
-	defer store.rw.Unlock()
+	unlock, err := store.lockForUpdate()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	_, found := store.db.Sessions[string(client.SessionId)]
 	if !found {
 		return NotFoundError
 	}
 
-	store.db.Clients[client.Id] = client
-	found = false
+	return store.save(OpPut, KindClient, client.Id, client, func() {
+		store.db.clientPut(client)
+	})
+}
 
-	for _, i := range store.db.ClientsBySessionId[string(client.SessionId)] {
-		if i == client.Id {
-			found = true
-			break
-		}
+func (store *storage) ClientDelete(id string) error {
+	unlock, err := store.lockForUpdate()
+	if err != nil {
+		return err
 	}
+	defer unlock()
 
+	_, found := store.db.Clients[id]
 	if !found {
-		store.db.ClientsBySessionId[string(client.SessionId)] = append(store.db.ClientsBySessionId[string(client.SessionId)], client.Id)
+		return nil
 	}
 
-	return store.save()
+	return store.save(OpDelete, KindClient, id, nil, func() {
+		store.db.clientDelete(id)
+	})
 }
 
-func (store *storage) ClientDelete(id string) error {
+func (store *storage) ClientCount() (int, error) {
 	store.rw.Lock()
 	defer store.rw.Unlock()
 
-	client, found := store.db.Clients[id]
-	if !found {
-		return nil
-	}
+	return len(store.db.Clients), nil
+}
 
-	clients := store.db.ClientsBySessionId[string(client.SessionId)]
-	for n, i := range clients {
-		if i == client.Id {
-			clients = append(clients[:n], clients[n+1:]...)
-			break
-		}
+func (store *storage) ClientDeleteExpired(now time.Time) (int, error) {
+	unlock, err := store.lockForUpdate()
+	if err != nil {
+		return 0, err
 	}
+	defer unlock()
 
-	store.db.ClientsBySessionId[string(client.SessionId)] = clients
-	delete(store.db.Clients, id)
+	count := 0
+	for id, client := range store.db.Clients {
+		if client.ExpiresAt.IsZero() || client.ExpiresAt.After(now) {
+			continue
+		}
 
-	return store.save()
-}
+		if err := store.save(OpDelete, KindClient, id, nil, func() {
+			store.db.clientDelete(id)
+		}); err != nil {
+			return count, err
+		}
 
-func (store *storage) ClientCount() (int, error) {
-	store.rw.Lock()
-	defer store.rw.Unlock()
+		count++
+	}
 
-	return len(store.db.Clients), nil
+	return count, nil
 }
 
 func (store *storage) LoginRequestGet(id string) (*types.LoginRequest, error) {
@@ -394,19 +729,94 @@ func (store *storage) LoginRequestGet(id string) (*types.LoginRequest, error) {
 }
 
 func (store *storage) LoginRequestPut(loginRequest *types.LoginRequest) error {
-	store.rw.Lock()
-	defer store.rw.Unlock()
+	unlock, err := store.lockForUpdate()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
-	store.db.LoginRequests[loginRequest.Id] = loginRequest
-	return store.save()
+	return store.save(OpPut, KindLoginRequest, loginRequest.Id, loginRequest, func() {
+		store.db.LoginRequests[loginRequest.Id] = loginRequest
+	})
 }
 
 func (store *storage) LoginRequestDelete(id string) error {
-	store.rw.Lock()
-	defer store.rw.Unlock()
+	unlock, err := store.lockForUpdate()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return store.save(OpDelete, KindLoginRequest, id, nil, func() {
+		delete(store.db.LoginRequests, id)
+	})
+}
+
+func (store *storage) LoginRequestDeleteExpired(now time.Time) (int, error) {
+	unlock, err := store.lockForUpdate()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	count := 0
+	for id, lr := range store.db.LoginRequests {
+		if lr.ExpiresAt.IsZero() || lr.ExpiresAt.After(now) {
+			continue
+		}
+
+		if err := store.save(OpDelete, KindLoginRequest, id, nil, func() {
+			delete(store.db.LoginRequests, id)
+		}); err != nil {
+			return count, err
+		}
+
+		count++
+	}
+
+	return count, nil
+}
+
+func (db *DB) leasePut(lease *types.Lease) {
+	// Snapshots written before leases existed have none.
+	if db.Leases == nil {
+		db.Leases = map[string]*types.Lease{}
+	}
+
+	db.Leases[lease.Name] = lease
+}
+
+func (store *storage) LeaseAcquire(name, holder string, ttl time.Duration) (*types.Lease, error) {
+	unlock, err := store.lockForUpdate()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	lease, taken := takeLease(store.db.Leases[name], name, holder, ttl, time.Now())
+	if !taken {
+		return lease, nil
+	}
+
+	return lease, store.save(OpPut, KindLease, name, lease, func() {
+		store.db.leasePut(lease)
+	})
+}
+
+func (store *storage) LeaseRelease(name, holder string) error {
+	unlock, err := store.lockForUpdate()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if lease, found := store.db.Leases[name]; !found || lease.Holder != holder {
+		return nil
+	}
 
-	delete(store.db.LoginRequests, id)
-	return store.save()
+	return store.save(OpDelete, KindLease, name, nil, func() {
+		delete(store.db.Leases, name)
+	})
 }
 
 func (store *storage) UserGet(id string) (*types.User, error) {
@@ -436,13 +846,15 @@ func (store *storage) UserFindByProvider(providerName, providerUserId string) (*
 }
 
 func (store *storage) UserPut(user *types.User) error {
-	store.rw.Lock()
-	defer store.rw.Unlock()
-
-	store.db.UsersByProvider[fmt.Sprintf("%s_%s", user.Provider, user.ProviderUserId)] = user.Id
-	store.db.Users[user.Id] = user
+	unlock, err := store.lockForUpdate()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
-	return store.save()
+	return store.save(OpPut, KindUser, user.Id, user, func() {
+		store.db.userPut(user)
+	})
 }
 
 func (store *storage) PlaygroundGet(id string) (*types.Playground, error) {
@@ -472,10 +884,131 @@ func (store *storage) PlaygroundGetAll() ([]*types.Playground, error) {
 }
 
 func (store *storage) PlaygroundPut(playground *types.Playground) error {
-	store.rw.Lock()
-	defer store.rw.Unlock()
+	unlock, err := store.lockForUpdate()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return store.save(OpPut, KindPlayground, playground.Id, playground, func() {
+		store.db.playgroundPut(playground)
+	})
+}
+
+func (db *DB) notify(e WatchEvent) {
+	if db.hub != nil {
+		db.hub.Publish(e)
+	}
+}
+
+func (db *DB) sessionPut(session *types.Session) {
+	db.Sessions[session.Id] = session
+	db.notify(WatchEvent{Kind: KindSession, Op: OpPut, Id: session.Id, Session: session})
+}
+
+func (db *DB) sessionDelete(id string) {
+	for _, i := range db.WindowsInstancesBySessionId[id] {
+		delete(db.WindowsInstances, i)
+	}
+
+	delete(db.WindowsInstancesBySessionId, id)
+	for _, i := range db.InstancesBySessionId[id] {
+		if instance, found := db.Instances[i]; found {
+			delete(db.Instances, i)
+			db.notify(WatchEvent{Kind: KindInstance, Op: OpDelete, Id: i, Instance: instance})
+		}
+	}
+
+	delete(db.InstancesBySessionId, id)
+	for _, i := range db.ClientsBySessionId[id] {
+		if client, found := db.Clients[i]; found {
+			delete(db.Clients, i)
+			db.notify(WatchEvent{Kind: KindClient, Op: OpDelete, Id: i, Client: client})
+		}
+	}
+
+	delete(db.ClientsBySessionId, id)
+	if session, found := db.Sessions[id]; found {
+		delete(db.Sessions, id)
+		db.notify(WatchEvent{Kind: KindSession, Op: OpDelete, Id: id, Session: session})
+	}
+}
+
+func (db *DB) instancePut(instance *types.Instance) {
+	db.Instances[instance.Name] = instance
+	db.InstancesBySessionId[instance.SessionId] = indexAdd(db.InstancesBySessionId[instance.SessionId], instance.Name)
+	db.notify(WatchEvent{Kind: KindInstance, Op: OpPut, Id: instance.Name, Instance: instance})
+}
+
+func (db *DB) instanceDelete(name string) {
+	instance, found := db.Instances[name]
+	if !found {
+		return
+	}
+
+	db.InstancesBySessionId[instance.SessionId] = indexRemove(db.InstancesBySessionId[instance.SessionId], name)
+	delete(db.Instances, name)
+	db.notify(WatchEvent{Kind: KindInstance, Op: OpDelete, Id: name, Instance: instance})
+}
+
+func (db *DB) windowsInstancePut(instance *types.WindowsInstance) {
+	db.WindowsInstances[instance.Id] = instance
+	db.WindowsInstancesBySessionId[instance.SessionId] = indexAdd(db.WindowsInstancesBySessionId[instance.SessionId], instance.Id)
+}
+
+func (db *DB) windowsInstanceDelete(id string) {
+	instance, found := db.WindowsInstances[id]
+	if !found {
+		return
+	}
+
+	db.WindowsInstancesBySessionId[instance.SessionId] = indexRemove(db.WindowsInstancesBySessionId[instance.SessionId], id)
+	delete(db.WindowsInstances, id)
+}
+
+func (db *DB) clientPut(client *types.Client) {
+	db.Clients[client.Id] = client
+	db.ClientsBySessionId[client.SessionId] = indexAdd(db.ClientsBySessionId[client.SessionId], client.Id)
+	db.notify(WatchEvent{Kind: KindClient, Op: OpPut, Id: client.Id, Client: client})
+}
+
+func (db *DB) clientDelete(id string) {
+	client, found := db.Clients[id]
+	if !found {
+		return
+	}
+
+	db.ClientsBySessionId[client.SessionId] = indexRemove(db.ClientsBySessionId[client.SessionId], id)
+	delete(db.Clients, id)
+	db.notify(WatchEvent{Kind: KindClient, Op: OpDelete, Id: id, Client: client})
+}
+
+func (db *DB) playgroundPut(playground *types.Playground) {
+	db.Playgrounds[playground.Id] = playground
+	db.notify(WatchEvent{Kind: KindPlayground, Op: OpPut, Id: playground.Id, Playground: playground})
+}
 
-	store.db.Playgrounds[playground.Id] = playground
+func (db *DB) userPut(user *types.User) {
+	db.UsersByProvider[fmt.Sprintf("%s_%s", user.Provider, user.ProviderUserId)] = user.Id
+	db.Users[user.Id] = user
+}
+
+func indexAdd(ids []string, id string) []string {
+	for _, i := range ids {
+		if i == id {
+			return ids
+		}
+	}
+
+	return append(ids, id)
+}
+
+func indexRemove(ids []string, id string) []string {
+	for n, i := range ids {
+		if i == id {
+			return append(ids[:n], ids[n+1:]...)
+		}
+	}
 
-	return store.save()
+	return ids
 }
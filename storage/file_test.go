@@ -5,7 +5,9 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/dimaskiddo/play-with-docker/pwd/types"
 	"github.com/stretchr/testify/assert"
@@ -21,6 +23,7 @@ func TestSessionPut(t *testing.T) {
 	os.Remove(tmpfile.Name())
 
 	defer os.Remove(tmpfile.Name())
+	defer os.Remove(journalPath(tmpfile.Name()))
 
 	storage, err := NewFileStorage(tmpfile.Name())
 
@@ -32,6 +35,7 @@ func TestSessionPut(t *testing.T) {
 	assert.Nil(t, err)
 
 	expectedDB := &DB{
+		Version:                     SchemaVersion,
 		Sessions:                    map[string]*types.Session{s.Id: s},
 		Instances:                   map[string]*types.Instance{},
 		Clients:                     map[string]*types.Client{},
@@ -45,6 +49,9 @@ func TestSessionPut(t *testing.T) {
 		UsersByProvider:             map[string]string{},
 	}
 
+	storage, err = NewFileStorage(tmpfile.Name())
+	assert.Nil(t, err)
+
 	var loadedDB *DB
 
 	file, err := os.Open(tmpfile.Name())
@@ -151,6 +158,7 @@ func TestSessionDelete(t *testing.T) {
 	os.Remove(tmpfile.Name())
 
 	defer os.Remove(tmpfile.Name())
+	defer os.Remove(journalPath(tmpfile.Name()))
 
 	storage, err := NewFileStorage(tmpfile.Name())
 
@@ -219,6 +227,7 @@ func TestInstancePut(t *testing.T) {
 
 	os.Remove(tmpfile.Name())
 	defer os.Remove(tmpfile.Name())
+	defer os.Remove(journalPath(tmpfile.Name()))
 
 	storage, err := NewFileStorage(tmpfile.Name())
 
@@ -234,6 +243,7 @@ func TestInstancePut(t *testing.T) {
 	assert.Nil(t, err)
 
 	expectedDB := &DB{
+		Version:                     SchemaVersion,
 		Sessions:                    map[string]*types.Session{s.Id: s},
 		Instances:                   map[string]*types.Instance{i.Name: i},
 		Clients:                     map[string]*types.Client{},
@@ -246,6 +256,9 @@ func TestInstancePut(t *testing.T) {
 		ClientsBySessionId:          map[string][]string{},
 		UsersByProvider:             map[string]string{},
 	}
+	storage, err = NewFileStorage(tmpfile.Name())
+	assert.Nil(t, err)
+
 	var loadedDB *DB
 
 	file, err := os.Open(tmpfile.Name())
@@ -270,6 +283,7 @@ func TestInstanceDelete(t *testing.T) {
 
 	os.Remove(tmpfile.Name())
 	defer os.Remove(tmpfile.Name())
+	defer os.Remove(journalPath(tmpfile.Name()))
 
 	storage, err := NewFileStorage(tmpfile.Name())
 
@@ -382,6 +396,7 @@ func TestWindowsInstancePut(t *testing.T) {
 
 	os.Remove(tmpfile.Name())
 	defer os.Remove(tmpfile.Name())
+	defer os.Remove(journalPath(tmpfile.Name()))
 
 	storage, err := NewFileStorage(tmpfile.Name())
 
@@ -397,6 +412,7 @@ func TestWindowsInstancePut(t *testing.T) {
 	assert.Nil(t, err)
 
 	expectedDB := &DB{
+		Version:                     SchemaVersion,
 		Sessions:                    map[string]*types.Session{s.Id: s},
 		Instances:                   map[string]*types.Instance{},
 		Clients:                     map[string]*types.Client{},
@@ -409,6 +425,9 @@ func TestWindowsInstancePut(t *testing.T) {
 		ClientsBySessionId:          map[string][]string{},
 		UsersByProvider:             map[string]string{},
 	}
+	storage, err = NewFileStorage(tmpfile.Name())
+	assert.Nil(t, err)
+
 	var loadedDB *DB
 
 	file, err := os.Open(tmpfile.Name())
@@ -433,6 +452,7 @@ func TestWindowsInstanceDelete(t *testing.T) {
 
 	os.Remove(tmpfile.Name())
 	defer os.Remove(tmpfile.Name())
+	defer os.Remove(journalPath(tmpfile.Name()))
 
 	storage, err := NewFileStorage(tmpfile.Name())
 
@@ -461,6 +481,7 @@ func TestWindowsInstanceDelete(t *testing.T) {
 func TestClientGet(t *testing.T) {
 	c := &types.Client{SessionId: "aaabbbccc", Id: "c1"}
 	expectedDB := &DB{
+		Version:                     SchemaVersion,
 		Sessions:                    map[string]*types.Session{},
 		Instances:                   map[string]*types.Instance{},
 		Clients:                     map[string]*types.Client{c.Id: c},
@@ -504,6 +525,7 @@ func TestClientPut(t *testing.T) {
 
 	os.Remove(tmpfile.Name())
 	defer os.Remove(tmpfile.Name())
+	defer os.Remove(journalPath(tmpfile.Name()))
 
 	storage, err := NewFileStorage(tmpfile.Name())
 
@@ -519,6 +541,7 @@ func TestClientPut(t *testing.T) {
 	assert.Nil(t, err)
 
 	expectedDB := &DB{
+		Version:                     SchemaVersion,
 		Sessions:                    map[string]*types.Session{s.Id: s},
 		Instances:                   map[string]*types.Instance{},
 		Clients:                     map[string]*types.Client{c.Id: c},
@@ -531,6 +554,9 @@ func TestClientPut(t *testing.T) {
 		ClientsBySessionId:          map[string][]string{c.SessionId: []string{c.Id}},
 		UsersByProvider:             map[string]string{},
 	}
+	storage, err = NewFileStorage(tmpfile.Name())
+	assert.Nil(t, err)
+
 	var loadedDB *DB
 
 	file, err := os.Open(tmpfile.Name())
@@ -555,6 +581,7 @@ func TestClientDelete(t *testing.T) {
 
 	os.Remove(tmpfile.Name())
 	defer os.Remove(tmpfile.Name())
+	defer os.Remove(journalPath(tmpfile.Name()))
 
 	storage, err := NewFileStorage(tmpfile.Name())
 
@@ -584,6 +611,7 @@ func TestClientFindBySessionId(t *testing.T) {
 	c1 := &types.Client{SessionId: "aaabbbccc", Id: "c1"}
 	c2 := &types.Client{SessionId: "aaabbbccc", Id: "c2"}
 	expectedDB := &DB{
+		Version:                     SchemaVersion,
 		Sessions:                    map[string]*types.Session{},
 		Instances:                   map[string]*types.Instance{},
 		Clients:                     map[string]*types.Client{c1.Id: c1, c2.Id: c2},
@@ -665,6 +693,7 @@ func TestPlaygroundPut(t *testing.T) {
 
 	os.Remove(tmpfile.Name())
 	defer os.Remove(tmpfile.Name())
+	defer os.Remove(journalPath(tmpfile.Name()))
 
 	storage, err := NewFileStorage(tmpfile.Name())
 
@@ -676,6 +705,7 @@ func TestPlaygroundPut(t *testing.T) {
 	assert.Nil(t, err)
 
 	expectedDB := &DB{
+		Version:                     SchemaVersion,
 		Sessions:                    map[string]*types.Session{},
 		Instances:                   map[string]*types.Instance{},
 		Clients:                     map[string]*types.Client{},
@@ -688,6 +718,9 @@ func TestPlaygroundPut(t *testing.T) {
 		ClientsBySessionId:          map[string][]string{},
 		UsersByProvider:             map[string]string{},
 	}
+	storage, err = NewFileStorage(tmpfile.Name())
+	assert.Nil(t, err)
+
 	var loadedDB *DB
 
 	file, err := os.Open(tmpfile.Name())
@@ -741,3 +774,115 @@ func TestPlaygroundGetAll(t *testing.T) {
 	assert.Subset(t, []*types.Playground{p1, p2}, found)
 	assert.Len(t, found, 2)
 }
+
+func TestDeleteExpired(t *testing.T) {
+	storage, err := NewFileStorage(filepath.Join(t.TempDir(), "pwd"))
+	assert.Nil(t, err)
+
+	testDeleteExpired(t, storage)
+}
+
+func testDeleteExpired(t *testing.T, storage StorageApi) {
+	now := time.Now()
+
+	s := &types.Session{Id: "aaabbbccc"}
+	expired := &types.Client{Id: "c1", SessionId: s.Id, ExpiresAt: now.Add(-time.Second)}
+	alive := &types.Client{Id: "c2", SessionId: s.Id, ExpiresAt: now.Add(time.Minute)}
+	untimed := &types.Client{Id: "c3", SessionId: s.Id}
+
+	assert.Nil(t, storage.SessionPut(s))
+	assert.Nil(t, storage.ClientPut(expired))
+	assert.Nil(t, storage.ClientPut(alive))
+	assert.Nil(t, storage.ClientPut(untimed))
+
+	assert.Nil(t, storage.LoginRequestPut(&types.LoginRequest{Id: "lr1", ExpiresAt: now}))
+	assert.Nil(t, storage.LoginRequestPut(&types.LoginRequest{Id: "lr2", ExpiresAt: now.Add(time.Minute)}))
+
+	count, err := storage.ClientDeleteExpired(now)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	clients, err := storage.ClientFindBySessionId(s.Id)
+	assert.Nil(t, err)
+	assert.Len(t, clients, 2)
+	for _, c := range clients {
+		assert.Contains(t, []string{alive.Id, untimed.Id}, c.Id)
+	}
+
+	count, err = storage.LoginRequestDeleteExpired(now)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	_, err = storage.LoginRequestGet("lr1")
+	assert.True(t, NotFound(err))
+
+	_, err = storage.LoginRequestGet("lr2")
+	assert.Nil(t, err)
+}
+
+func TestSessionTouch(t *testing.T) {
+	storage, err := NewFileStorage(filepath.Join(t.TempDir(), "pwd"))
+	assert.Nil(t, err)
+
+	testSessionTouch(t, storage)
+}
+
+func testSessionTouch(t *testing.T, storage StorageApi) {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	assert.True(t, NotFound(storage.SessionTouch("aaabbbccc", now)))
+
+	s := &types.Session{Id: "aaabbbccc", IdleWarnedAt: now.Add(-time.Minute)}
+	assert.Nil(t, storage.SessionPut(s))
+
+	// A copy read before the touch does not see it.
+	stale, err := storage.SessionGet(s.Id)
+	assert.Nil(t, err)
+
+	assert.Nil(t, storage.SessionTouch(s.Id, now))
+	assert.False(t, stale.LastActivity.Equal(now))
+
+	// Changes made meanwhile are kept.
+	extended := &types.Session{Id: s.Id, IdleWarnedAt: s.IdleWarnedAt, Extensions: 1}
+	assert.Nil(t, storage.SessionPut(extended))
+	assert.Nil(t, storage.SessionTouch(s.Id, now.Add(time.Second)))
+
+	found, err := storage.SessionGet(s.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, found.Extensions)
+	assert.True(t, found.LastActivity.Equal(now.Add(time.Second)))
+	assert.True(t, found.IdleWarnedAt.IsZero())
+}
+
+func TestSessionIdleWarn(t *testing.T) {
+	storage, err := NewFileStorage(filepath.Join(t.TempDir(), "pwd"))
+	assert.Nil(t, err)
+
+	testSessionIdleWarn(t, storage)
+}
+
+func testSessionIdleWarn(t *testing.T, storage StorageApi) {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	assert.True(t, NotFound(storage.SessionIdleWarn("aaabbbccc", now)))
+
+	s := &types.Session{Id: "aaabbbccc"}
+	assert.Nil(t, storage.SessionPut(s))
+
+	// Changes made meanwhile are kept.
+	extended := &types.Session{Id: s.Id, Extensions: 1}
+	assert.Nil(t, storage.SessionPut(extended))
+	assert.Nil(t, storage.SessionIdleWarn(s.Id, now))
+
+	found, err := storage.SessionGet(s.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, found.Extensions)
+	assert.True(t, found.IdleWarnedAt.Equal(now))
+
+	assert.Nil(t, storage.SessionIdleWarn(s.Id, time.Time{}))
+
+	found, err = storage.SessionGet(s.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, found.Extensions)
+	assert.True(t, found.IdleWarnedAt.IsZero())
+}
@@ -0,0 +1,15 @@
+//go:build windows
+
+package storage
+
+import "os"
+
+// Windows has no advisory locks, so sharing a file storage between processes
+// is not supported there.
+func lockFile(f *os.File) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
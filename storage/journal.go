@@ -0,0 +1,246 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dimaskiddo/play-with-docker/pwd/types"
+)
+
+// Number of journal entries after which the file storage folds the journal
+// into a new snapshot.
+const journalCompactEvery = 1000
+
+// How often the file storage checks the journal for changes made by other
+// processes while it has watches.
+var journalTailInterval = 500 * time.Millisecond
+
+type journalEntry struct {
+	Op    Op              `json:"op"`
+	Kind  Kind            `json:"kind"`
+	Id    string          `json:"id"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+func journalPath(path string) string {
+	return path + ".journal"
+}
+
+func openJournal(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
+}
+
+// appendJournal writes an entry and returns its length in bytes.
+func appendJournal(f *os.File, op Op, kind Kind, id string, value interface{}) (int, error) {
+	e := journalEntry{Op: op, Kind: kind, Id: id}
+
+	if value != nil {
+		b, err := json.Marshal(value)
+		if err != nil {
+			return 0, err
+		}
+
+		e.Value = b
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := f.Write(append(b, '\n'))
+	if err != nil {
+		return n, err
+	}
+
+	return n, f.Sync()
+}
+
+// replayJournal applies every complete entry of the journal at path, starting
+// at offset, to db. It returns how many were applied and the offset right
+// after the last one. A trailing entry without its newline was cut short by a
+// crash or is still being written by another process, so it is skipped and,
+// when repair is set, dropped from the file.
+func replayJournal(path string, db *DB, offset int64, repair bool) (int, int64, error) {
+	flags := os.O_RDONLY
+	if repair {
+		flags = os.O_RDWR
+	}
+
+	f, err := os.OpenFile(path, flags, 0)
+	if os.IsNotExist(err) {
+		return 0, offset, nil
+	}
+	if err != nil {
+		return 0, offset, err
+	}
+	defer f.Close()
+
+	_, err = f.Seek(offset, io.SeekStart)
+	if err != nil {
+		return 0, offset, err
+	}
+
+	r := bufio.NewReader(f)
+
+	n := 0
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 && repair {
+				return n, offset, f.Truncate(offset)
+			}
+
+			return n, offset, nil
+		}
+		if err != nil {
+			return n, offset, err
+		}
+
+		offset += int64(len(line))
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		var e journalEntry
+		err = json.Unmarshal(line, &e)
+		if err != nil {
+			return n, offset, fmt.Errorf("journal %s: entry %d: %v", path, n+1, err)
+		}
+
+		err = db.apply(&e)
+		if err != nil {
+			return n, offset, fmt.Errorf("journal %s: entry %d: %v", path, n+1, err)
+		}
+
+		n++
+	}
+}
+
+func (db *DB) apply(e *journalEntry) error {
+	if e.Op == OpDelete {
+		switch e.Kind {
+		case KindSession:
+			db.sessionDelete(e.Id)
+		case KindInstance:
+			db.instanceDelete(e.Id)
+		case KindWindowsInstance:
+			db.windowsInstanceDelete(e.Id)
+		case KindClient:
+			db.clientDelete(e.Id)
+		case KindLoginRequest:
+			delete(db.LoginRequests, e.Id)
+		case KindLease:
+			delete(db.Leases, e.Id)
+		default:
+			return fmt.Errorf("cannot delete %s", e.Kind)
+		}
+
+		return nil
+	}
+
+	if e.Op != OpPut {
+		return fmt.Errorf("unknown operation %s", e.Op)
+	}
+
+	switch e.Kind {
+	case KindSession:
+		s := &types.Session{}
+		if err := json.Unmarshal(e.Value, s); err != nil {
+			return err
+		}
+		db.sessionPut(s)
+	case KindInstance:
+		i := &types.Instance{}
+		if err := json.Unmarshal(e.Value, i); err != nil {
+			return err
+		}
+		db.instancePut(i)
+	case KindWindowsInstance:
+		i := &types.WindowsInstance{}
+		if err := json.Unmarshal(e.Value, i); err != nil {
+			return err
+		}
+		db.windowsInstancePut(i)
+	case KindClient:
+		c := &types.Client{}
+		if err := json.Unmarshal(e.Value, c); err != nil {
+			return err
+		}
+		db.clientPut(c)
+	case KindLoginRequest:
+		lr := &types.LoginRequest{}
+		if err := json.Unmarshal(e.Value, lr); err != nil {
+			return err
+		}
+		db.LoginRequests[lr.Id] = lr
+	case KindUser:
+		u := &types.User{}
+		if err := json.Unmarshal(e.Value, u); err != nil {
+			return err
+		}
+		db.userPut(u)
+	case KindPlayground:
+		p := &types.Playground{}
+		if err := json.Unmarshal(e.Value, p); err != nil {
+			return err
+		}
+		db.playgroundPut(p)
+	case KindLease:
+		l := &types.Lease{}
+		if err := json.Unmarshal(e.Value, l); err != nil {
+			return err
+		}
+		db.leasePut(l)
+	default:
+		return fmt.Errorf("unknown kind %s", e.Kind)
+	}
+
+	return nil
+}
+
+// writeFileAtomic writes path through a temporary file in the same directory
+// which is synced and renamed over path, so readers either see the previous
+// content or the new one, never a partial file.
+func writeFileAtomic(path string, write func(f *os.File) error) error {
+	dir := filepath.Dir(path)
+
+	f, err := ioutil.TempFile(dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	err = write(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(f.Name(), path)
+	if err != nil {
+		return err
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dimaskiddo/play-with-docker/pwd/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournalReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session")
+
+	s, err := NewFileStorage(path)
+	assert.Nil(t, err)
+
+	s1 := &types.Session{Id: "session1"}
+	s2 := &types.Session{Id: "session2"}
+	i := &types.Instance{Name: "i1", SessionId: s1.Id}
+
+	assert.Nil(t, s.SessionPut(s1))
+	assert.Nil(t, s.SessionPut(s2))
+	assert.Nil(t, s.InstancePut(i))
+	assert.Nil(t, s.SessionDelete(s2.Id))
+
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	s, err = NewFileStorage(path)
+	assert.Nil(t, err)
+
+	found, err := s.SessionGet(s1.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, s1, found)
+
+	_, err = s.SessionGet(s2.Id)
+	assert.True(t, NotFound(err))
+
+	instances, err := s.InstanceFindBySessionId(s1.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Instance{i}, instances)
+
+	info, err := os.Stat(journalPath(path))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), info.Size())
+}
+
+func TestJournalWriteError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session")
+
+	s, err := NewFileStorage(path)
+	assert.Nil(t, err)
+
+	s1 := &types.Session{Id: "session1"}
+	assert.Nil(t, s.SessionPut(s1))
+
+	// Writes to a journal opened read only fail.
+	store := s.(*storage)
+	store.journal.Close()
+	store.journal, err = os.Open(journalPath(path))
+	assert.Nil(t, err)
+	defer store.journal.Close()
+
+	assert.NotNil(t, s.InstancePut(&types.Instance{Name: "i1", SessionId: s1.Id}))
+	assert.NotNil(t, s.SessionDelete(s1.Id))
+
+	found, err := s.SessionGet(s1.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, s1, found)
+
+	_, err = s.InstanceGet("i1")
+	assert.True(t, NotFound(err))
+}
+
+func TestJournalTornEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session")
+
+	s, err := NewFileStorage(path)
+	assert.Nil(t, err)
+	assert.Nil(t, s.SessionPut(&types.Session{Id: "session1"}))
+
+	f, err := os.OpenFile(journalPath(path), os.O_WRONLY|os.O_APPEND, 0)
+	assert.Nil(t, err)
+	_, err = f.WriteString(`{"op":"put","kind":"session","id":"sess`)
+	assert.Nil(t, err)
+	f.Close()
+
+	s, err = NewFileStorage(path)
+	assert.Nil(t, err)
+
+	count, err := s.SessionCount()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestJournalCorruptEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session")
+
+	err := ioutil.WriteFile(journalPath(path), []byte("{not json\n"), 0600)
+	assert.Nil(t, err)
+
+	_, err = NewFileStorage(path)
+	assert.NotNil(t, err)
+}
+
+func TestJournalCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session")
+
+	s, err := NewFileStorage(path)
+	assert.Nil(t, err)
+
+	p := &types.Playground{Id: "p1"}
+	for n := 0; n < journalCompactEvery; n++ {
+		assert.Nil(t, s.PlaygroundPut(p))
+	}
+
+	info, err := os.Stat(journalPath(path))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), info.Size())
+
+	file, err := os.Open(path)
+	assert.Nil(t, err)
+	defer file.Close()
+
+	var loadedDB *DB
+	err = json.NewDecoder(file).Decode(&loadedDB)
+	assert.Nil(t, err)
+	assert.Equal(t, p, loadedDB.Playgrounds[p.Id])
+
+	matches, err := filepath.Glob(path + ".tmp*")
+	assert.Nil(t, err)
+	assert.Empty(t, matches)
+}
@@ -0,0 +1,242 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Prefix of the values sealed by a Keyring. Values without it are stored in
+// clear text, as written before encryption was enabled.
+const sealedPrefix = "pwdenc:v1:"
+
+// Keyring holds the keys used to encrypt secrets at rest. The primary key
+// encrypts, every key decrypts, so a new key can be made primary while data
+// encrypted with the previous ones is still readable.
+type Keyring struct {
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+func NewKeyring() *Keyring {
+	return &Keyring{keys: map[string]cipher.AEAD{}}
+}
+
+// Add adds a 32 bytes AES key. The first key added is the primary one.
+func (k *Keyring) Add(key []byte) error {
+	if len(key) != 32 {
+		return fmt.Errorf("storage key must be 32 bytes long, got %d", len(key))
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(key)
+	id := hex.EncodeToString(sum[:4])
+
+	k.keys[id] = aead
+	if k.primary == "" {
+		k.primary = id
+	}
+
+	return nil
+}
+
+// ReadKeyring builds a Keyring from a base64 encoded key and a file with one
+// such key per line. The key, or else the first one in the file, is the
+// primary one. It returns nil if neither is set.
+func ReadKeyring(key, keyFile string) (*Keyring, error) {
+	if key == "" && keyFile == "" {
+		return nil, nil
+	}
+
+	k := NewKeyring()
+
+	if key != "" {
+		if err := k.addEncoded(key); err != nil {
+			return nil, err
+		}
+	}
+
+	if keyFile != "" {
+		b, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		s := bufio.NewScanner(bytes.NewReader(b))
+		for n := 1; s.Scan(); n++ {
+			line := strings.TrimSpace(s.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			if err := k.addEncoded(line); err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", keyFile, n, err)
+			}
+		}
+	}
+
+	if k.primary == "" {
+		return nil, fmt.Errorf("%s has no keys", keyFile)
+	}
+
+	return k, nil
+}
+
+func (k *Keyring) addEncoded(key string) error {
+	b, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return fmt.Errorf("storage key is not base64 encoded: %v", err)
+	}
+
+	return k.Add(b)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts value with a random data key, which is in turn encrypted with
+// the primary key and stored along with it. field is authenticated so sealed
+// values cannot be moved between fields or records.
+func (k *Keyring) seal(field string, value []byte) ([]byte, error) {
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, err
+	}
+
+	data, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, err := sealWith(k.keys[k.primary], dataKey, []byte(field))
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := sealWith(data, value, []byte(field))
+	if err != nil {
+		return nil, err
+	}
+
+	enc := base64.RawStdEncoding
+	return []byte(sealedPrefix + k.primary + ":" + enc.EncodeToString(wrapped) + ":" + enc.EncodeToString(sealed)), nil
+}
+
+func (k *Keyring) open(field string, value []byte) ([]byte, error) {
+	parts := strings.Split(strings.TrimPrefix(string(value), sealedPrefix), ":")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%s: malformed encrypted value", field)
+	}
+
+	key, found := k.keys[parts[0]]
+	if !found {
+		return nil, fmt.Errorf("%s: encrypted with unknown key %s", field, parts[0])
+	}
+
+	enc := base64.RawStdEncoding
+
+	wrapped, err := enc.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", field, err)
+	}
+
+	sealed, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", field, err)
+	}
+
+	dataKey, err := openWith(key, wrapped, []byte(field))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", field, err)
+	}
+
+	data, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := openWith(data, sealed, []byte(field))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", field, err)
+	}
+
+	return b, nil
+}
+
+func sealWith(aead cipher.AEAD, plain, ad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plain, ad), nil
+}
+
+func openWith(aead cipher.AEAD, sealed, ad []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("encrypted value is too short")
+	}
+
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], ad)
+}
+
+func isSealed(value []byte) bool {
+	return bytes.HasPrefix(value, []byte(sealedPrefix))
+}
+
+// encryptBytes seals value unless it is empty or already sealed, which is the
+// case for records imported from an archive.
+func (k *Keyring) encryptBytes(field string, value []byte) ([]byte, error) {
+	if len(value) == 0 || isSealed(value) {
+		return value, nil
+	}
+
+	return k.seal(field, value)
+}
+
+func (k *Keyring) decryptBytes(field string, value []byte) ([]byte, error) {
+	if !isSealed(value) {
+		return value, nil
+	}
+
+	return k.open(field, value)
+}
+
+func (k *Keyring) encryptString(field string, value *string) error {
+	b, err := k.encryptBytes(field, []byte(*value))
+	if err != nil {
+		return err
+	}
+
+	*value = string(b)
+	return nil
+}
+
+func (k *Keyring) decryptString(field string, value *string) error {
+	b, err := k.decryptBytes(field, []byte(*value))
+	if err != nil {
+		return err
+	}
+
+	*value = string(b)
+	return nil
+}
@@ -0,0 +1,17 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/dimaskiddo/play-with-docker/pwd/types"
+)
+
+// takeLease returns the lease name held by holder until ttl after now if
+// current, the stored lease if any, lets holder have it.
+func takeLease(current *types.Lease, name, holder string, ttl time.Duration, now time.Time) (*types.Lease, bool) {
+	if current != nil && current.Holder != holder && current.ExpiresAt.After(now) {
+		return current, false
+	}
+
+	return &types.Lease{Name: name, Holder: holder, ExpiresAt: now.Add(ttl)}, true
+}
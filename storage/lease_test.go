@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func testLease(t *testing.T, s StorageApi) {
+	lease, err := s.LeaseAcquire("scheduler", "r1", 100*time.Millisecond)
+	assert.Nil(t, err)
+	assert.Equal(t, "r1", lease.Holder)
+
+	lease, err = s.LeaseAcquire("scheduler", "r2", 100*time.Millisecond)
+	assert.Nil(t, err)
+	assert.Equal(t, "r1", lease.Holder)
+
+	// Renewed by its holder.
+	renewed, err := s.LeaseAcquire("scheduler", "r1", time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, "r1", renewed.Holder)
+	assert.True(t, renewed.ExpiresAt.After(lease.ExpiresAt))
+
+	// Only released by its holder.
+	assert.Nil(t, s.LeaseRelease("scheduler", "r2"))
+	lease, err = s.LeaseAcquire("scheduler", "r2", 100*time.Millisecond)
+	assert.Nil(t, err)
+	assert.Equal(t, "r1", lease.Holder)
+
+	assert.Nil(t, s.LeaseRelease("scheduler", "r1"))
+	lease, err = s.LeaseAcquire("scheduler", "r2", 100*time.Millisecond)
+	assert.Nil(t, err)
+	assert.Equal(t, "r2", lease.Holder)
+
+	// Taken over once expired.
+	time.Sleep(150 * time.Millisecond)
+	lease, err = s.LeaseAcquire("scheduler", "r1", time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, "r1", lease.Holder)
+
+	assert.Nil(t, s.LeaseRelease("other", "r1"))
+}
+
+func TestLease(t *testing.T) {
+	s, err := NewFileStorage(filepath.Join(t.TempDir(), "session"))
+	assert.Nil(t, err)
+
+	testLease(t, s)
+}
+
+func TestLeaseSharedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session")
+
+	s1, err := NewFileStorage(path)
+	assert.Nil(t, err)
+	s2, err := NewFileStorage(path)
+	assert.Nil(t, err)
+
+	lease, err := s1.LeaseAcquire("scheduler", "r1", time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, "r1", lease.Holder)
+
+	lease, err = s2.LeaseAcquire("scheduler", "r2", time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, "r1", lease.Holder)
+}
+
+func TestBoltLease(t *testing.T) {
+	testLease(t, newBoltTestStorage(t, nil))
+}
+
+func TestRedisLease(t *testing.T) {
+	testLease(t, newRedisTestStorage(t, miniredis.RunT(t)))
+}
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// SchemaVersion is the layout version of the DB written by this release.
+const SchemaVersion = 2
+
+// Migration upgrades a DB from Version-1 to Version.
+type Migration struct {
+	Version     int
+	Description string
+	up          func(db *DB) error
+}
+
+// migrations must be kept sorted by version and only ever be appended to.
+var migrations = []Migration{
+	{1, "Rebuild session indexes from stored instances and clients", rebuildSessionIndexes},
+	{2, "Expire login requests and clients stored without an expiry", expireUntimed},
+}
+
+// PendingMigrations returns the migrations needed to bring a DB at version up
+// to SchemaVersion.
+func PendingMigrations(version int) []Migration {
+	pending := []Migration{}
+
+	for _, m := range migrations {
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+
+	return pending
+}
+
+// FileSchemaVersion returns the schema version of the file storage snapshot at
+// path without loading it.
+func FileSchemaVersion(path string) (int, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return SchemaVersion, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var db struct {
+		Version int `json:"version"`
+	}
+
+	err = json.NewDecoder(file).Decode(&db)
+	if err != nil {
+		return 0, fmt.Errorf("decode %s: %v", path, err)
+	}
+
+	return db.Version, nil
+}
+
+// migrate runs every pending migration on db in order and returns how many
+// were applied.
+func (db *DB) migrate() (int, error) {
+	if db.Version > SchemaVersion {
+		return 0, fmt.Errorf("storage schema version %d is newer than the supported version %d", db.Version, SchemaVersion)
+	}
+
+	pending := PendingMigrations(db.Version)
+
+	for _, m := range pending {
+		err := m.up(db)
+		if err != nil {
+			return 0, fmt.Errorf("migration %d: %v", m.Version, err)
+		}
+
+		db.Version = m.Version
+	}
+
+	return len(pending), nil
+}
+
+// Before the schema was versioned, moving an instance to another session or
+// an interrupted write could leave index entries pointing to records that are
+// gone, which the FindBySessionId methods return as nil.
+func rebuildSessionIndexes(db *DB) error {
+	instances := map[string]string{}
+	for name, i := range db.Instances {
+		instances[name] = i.SessionId
+	}
+	db.InstancesBySessionId = rebuildIndex(db.InstancesBySessionId, instances)
+
+	windowsInstances := map[string]string{}
+	for id, i := range db.WindowsInstances {
+		windowsInstances[id] = i.SessionId
+	}
+	db.WindowsInstancesBySessionId = rebuildIndex(db.WindowsInstancesBySessionId, windowsInstances)
+
+	clients := map[string]string{}
+	for id, c := range db.Clients {
+		clients[id] = c.SessionId
+	}
+	db.ClientsBySessionId = rebuildIndex(db.ClientsBySessionId, clients)
+
+	return nil
+}
+
+func rebuildIndex(index map[string][]string, sessionIds map[string]string) map[string][]string {
+	rebuilt := map[string][]string{}
+
+	for sessionId, ids := range index {
+		rebuilt[sessionId] = []string{}
+
+		for _, id := range ids {
+			if sessionIds[id] == sessionId {
+				rebuilt[sessionId] = indexAdd(rebuilt[sessionId], id)
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(sessionIds))
+	for id := range sessionIds {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		rebuilt[sessionIds[id]] = indexAdd(rebuilt[sessionIds[id]], id)
+	}
+
+	return rebuilt
+}
+
+// Login requests and clients stored before they had a TTL never expire, and
+// none of them can belong to a flow or socket that survived the upgrade.
+func expireUntimed(db *DB) error {
+	now := time.Now()
+
+	for _, lr := range db.LoginRequests {
+		if lr.ExpiresAt.IsZero() {
+			lr.ExpiresAt = now
+		}
+	}
+
+	for _, c := range db.Clients {
+		if c.ExpiresAt.IsZero() {
+			c.ExpiresAt = now
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/dimaskiddo/play-with-docker/pwd/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPendingMigrations(t *testing.T) {
+	assert.Len(t, PendingMigrations(0), SchemaVersion)
+	assert.Empty(t, PendingMigrations(SchemaVersion))
+}
+
+func TestMigrateLegacyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session")
+
+	legacy := `{
+		"sessions": {"s1": {"id": "s1"}, "s2": {"id": "s2"}},
+		"instances": {"i1": {"name": "i1", "session_id": "s2"}},
+		"clients": {"c1": {"id": "c1", "session_id": "s1"}},
+		"instances_by_session_id": {"s1": ["i1", "gone"]},
+		"clients_by_session_id": {}
+	}`
+	err := ioutil.WriteFile(path, []byte(legacy), 0600)
+	assert.Nil(t, err)
+
+	version, err := FileSchemaVersion(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, version)
+
+	s, err := NewFileStorage(path)
+	assert.Nil(t, err)
+
+	instances, err := s.InstanceFindBySessionId("s1")
+	assert.Nil(t, err)
+	assert.Empty(t, instances)
+
+	instances, err = s.InstanceFindBySessionId("s2")
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Instance{{Name: "i1", SessionId: "s2"}}, instances)
+
+	clients, err := s.ClientFindBySessionId("s1")
+	assert.Nil(t, err)
+	assert.Len(t, clients, 1)
+	assert.Equal(t, "c1", clients[0].Id)
+	assert.False(t, clients[0].ExpiresAt.IsZero())
+
+	version, err = FileSchemaVersion(path)
+	assert.Nil(t, err)
+	assert.Equal(t, SchemaVersion, version)
+}
+
+func TestMigrateNewerVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session")
+
+	err := ioutil.WriteFile(path, []byte(`{"version": 1000}`), 0600)
+	assert.Nil(t, err)
+
+	_, err = NewFileStorage(path)
+	assert.NotNil(t, err)
+}
+
+func TestMigrateBolt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.db")
+
+	s, err := NewBoltStorage(path)
+	assert.Nil(t, err)
+	s.(*boltStorage).db.Close()
+
+	version, err := BoltSchemaVersion(path)
+	assert.Nil(t, err)
+	assert.Equal(t, SchemaVersion, version)
+}
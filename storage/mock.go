@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"time"
+
 	"github.com/dimaskiddo/play-with-docker/pwd/types"
 	"github.com/stretchr/testify/mock"
 )
@@ -24,6 +26,16 @@ func (m *Mock) SessionPut(session *types.Session) error {
 	return args.Error(0)
 }
 
+func (m *Mock) SessionTouch(id string, at time.Time) error {
+	args := m.Called(id, at)
+	return args.Error(0)
+}
+
+func (m *Mock) SessionIdleWarn(id string, at time.Time) error {
+	args := m.Called(id, at)
+	return args.Error(0)
+}
+
 func (m *Mock) SessionDelete(id string) error {
 	args := m.Called(id)
 	return args.Error(0)
@@ -34,6 +46,21 @@ func (m *Mock) SessionCount() (int, error) {
 	return args.Int(0), args.Error(1)
 }
 
+func (m *Mock) SessionFindByUserId(userId string, page Page) ([]*types.Session, string, error) {
+	args := m.Called(userId, page)
+	return args.Get(0).([]*types.Session), args.String(1), args.Error(2)
+}
+
+func (m *Mock) SessionFindByPlaygroundId(playgroundId string, page Page) ([]*types.Session, string, error) {
+	args := m.Called(playgroundId, page)
+	return args.Get(0).([]*types.Session), args.String(1), args.Error(2)
+}
+
+func (m *Mock) SessionFindExpiringBefore(t time.Time, page Page) ([]*types.Session, string, error) {
+	args := m.Called(t, page)
+	return args.Get(0).([]*types.Session), args.String(1), args.Error(2)
+}
+
 func (m *Mock) InstanceGet(name string) (*types.Instance, error) {
 	args := m.Called(name)
 	return args.Get(0).(*types.Instance), args.Error(1)
@@ -59,6 +86,11 @@ func (m *Mock) InstanceCount() (int, error) {
 	return args.Int(0), args.Error(1)
 }
 
+func (m *Mock) InstanceFindByImage(image string, page Page) ([]*types.Instance, string, error) {
+	args := m.Called(image, page)
+	return args.Get(0).([]*types.Instance), args.String(1), args.Error(2)
+}
+
 func (m *Mock) WindowsInstanceGetAll() ([]*types.WindowsInstance, error) {
 	args := m.Called()
 	return args.Get(0).([]*types.WindowsInstance), args.Error(1)
@@ -99,6 +131,11 @@ func (m *Mock) ClientCount() (int, error) {
 	return args.Int(0), args.Error(1)
 }
 
+func (m *Mock) ClientDeleteExpired(now time.Time) (int, error) {
+	args := m.Called(now)
+	return args.Int(0), args.Error(1)
+}
+
 func (m *Mock) LoginRequestGet(id string) (*types.LoginRequest, error) {
 	args := m.Called(id)
 	return args.Get(0).(*types.LoginRequest), args.Error(1)
@@ -114,6 +151,11 @@ func (m *Mock) LoginRequestDelete(id string) error {
 	return args.Error(0)
 }
 
+func (m *Mock) LoginRequestDeleteExpired(now time.Time) (int, error) {
+	args := m.Called(now)
+	return args.Int(0), args.Error(1)
+}
+
 func (m *Mock) UserGet(id string) (*types.User, error) {
 	args := m.Called(id)
 	return args.Get(0).(*types.User), args.Error(1)
@@ -143,3 +185,18 @@ func (m *Mock) PlaygroundPut(playground *types.Playground) error {
 	args := m.Called(playground)
 	return args.Error(0)
 }
+
+func (m *Mock) LeaseAcquire(name, holder string, ttl time.Duration) (*types.Lease, error) {
+	args := m.Called(name, holder, ttl)
+	return args.Get(0).(*types.Lease), args.Error(1)
+}
+
+func (m *Mock) LeaseRelease(name, holder string) error {
+	args := m.Called(name, holder)
+	return args.Error(0)
+}
+
+func (m *Mock) Watch(kind Kind, filter WatchFilter) (*Watch, error) {
+	args := m.Called(kind, filter)
+	return args.Get(0).(*Watch), args.Error(1)
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"encoding/base64"
+	"errors"
+	"sort"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	DefaultPageLimit = 100
+	MaxPageLimit     = 1000
+)
+
+var InvalidCursorError = errors.New("InvalidCursor")
+
+// Page selects a slice of the results of a query, which are ordered by their
+// primary key. Cursor is empty for the first page and otherwise the one
+// returned along with the previous page. A Limit of zero means
+// DefaultPageLimit.
+type Page struct {
+	Cursor string
+	Limit  int
+}
+
+func (p Page) limit() int {
+	if p.Limit <= 0 {
+		return DefaultPageLimit
+	}
+	if p.Limit > MaxPageLimit {
+		return MaxPageLimit
+	}
+
+	return p.Limit
+}
+
+// after returns the key the page starts after, or an empty string for the
+// first page.
+func (p Page) after() (string, error) {
+	if p.Cursor == "" {
+		return "", nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(p.Cursor)
+	if err != nil || len(b) == 0 {
+		return "", InvalidCursorError
+	}
+
+	return string(b), nil
+}
+
+func cursorFor(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+// pageKeys sorts keys and returns the ones that belong to page, together with
+// the cursor of the next page, which is empty when there are no more.
+func pageKeys(keys []string, page Page) ([]string, string, error) {
+	after, err := page.after()
+	if err != nil {
+		return nil, "", err
+	}
+
+	sort.Strings(keys)
+
+	start := sort.SearchStrings(keys, after)
+	if start < len(keys) && keys[start] == after {
+		start++
+	}
+	keys = keys[start:]
+
+	if len(keys) <= page.limit() {
+		return keys, "", nil
+	}
+
+	keys = keys[:page.limit()]
+
+	return keys, cursorFor(keys[len(keys)-1]), nil
+}
+
+// boltPage walks bucket in key order from the page cursor. match decodes a
+// value and returns nil when it is not part of the results.
+func boltPage(tx *bolt.Tx, bucket []byte, page Page, match func(v []byte) (interface{}, error)) ([]interface{}, string, error) {
+	after, err := page.after()
+	if err != nil {
+		return nil, "", err
+	}
+
+	c := tx.Bucket(bucket).Cursor()
+
+	k, v := c.First()
+	if after != "" {
+		k, v = c.Seek([]byte(after))
+		if k != nil && string(k) == after {
+			k, v = c.Next()
+		}
+	}
+
+	results := []interface{}{}
+	last := ""
+	for ; k != nil; k, v = c.Next() {
+		r, err := match(v)
+		if err != nil {
+			return nil, "", err
+		}
+		if r == nil {
+			continue
+		}
+
+		if len(results) == page.limit() {
+			return results, cursorFor(last), nil
+		}
+
+		results = append(results, r)
+		last = string(k)
+	}
+
+	return results, "", nil
+}
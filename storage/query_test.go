@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dimaskiddo/play-with-docker/pwd/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func testQuery(t *testing.T, s StorageApi) {
+	now := time.Now()
+
+	for n := 0; n < 5; n++ {
+		session := &types.Session{Id: fmt.Sprintf("s%d", n), UserId: "u1", PlaygroundId: "p1", ExpiresAt: now.Add(time.Duration(n-2) * time.Hour)}
+		if n%2 == 1 {
+			session.UserId = "u2"
+		}
+		assert.Nil(t, s.SessionPut(session))
+
+		image := "franela/dind"
+		if n == 4 {
+			image = "alpine"
+		}
+		assert.Nil(t, s.InstancePut(&types.Instance{Name: fmt.Sprintf("i%d", n), SessionId: session.Id, Image: image}))
+	}
+	assert.Nil(t, s.SessionPut(&types.Session{Id: "s5", UserId: "u1", PlaygroundId: "p2"}))
+
+	ids := func(sessions []*types.Session) []string {
+		r := []string{}
+		for _, s := range sessions {
+			r = append(r, s.Id)
+		}
+		return r
+	}
+
+	sessions, next, err := s.SessionFindByUserId("u1", Page{Limit: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"s0", "s2"}, ids(sessions))
+	assert.NotEmpty(t, next)
+
+	sessions, next, err = s.SessionFindByUserId("u1", Page{Cursor: next, Limit: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"s4", "s5"}, ids(sessions))
+	assert.Empty(t, next)
+
+	sessions, next, err = s.SessionFindByPlaygroundId("p2", Page{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"s5"}, ids(sessions))
+	assert.Empty(t, next)
+
+	sessions, next, err = s.SessionFindExpiringBefore(now, Page{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"s0", "s1"}, ids(sessions))
+	assert.Empty(t, next)
+
+	sessions, _, err = s.SessionFindByUserId("nobody", Page{})
+	assert.Nil(t, err)
+	assert.Empty(t, sessions)
+
+	instances, next, err := s.InstanceFindByImage("franela/dind", Page{Limit: 3})
+	assert.Nil(t, err)
+	assert.Len(t, instances, 3)
+	assert.Equal(t, "i2", instances[2].Name)
+
+	instances, next, err = s.InstanceFindByImage("franela/dind", Page{Cursor: next, Limit: 3})
+	assert.Nil(t, err)
+	assert.Len(t, instances, 1)
+	assert.Equal(t, "i3", instances[0].Name)
+	assert.Empty(t, next)
+
+	_, _, err = s.SessionFindByUserId("u1", Page{Cursor: "!"})
+	assert.Equal(t, InvalidCursorError, err)
+}
+
+func TestQuery(t *testing.T) {
+	s, err := NewFileStorage(filepath.Join(t.TempDir(), "session"))
+	assert.Nil(t, err)
+
+	testQuery(t, s)
+}
+
+func TestBoltQuery(t *testing.T) {
+	testQuery(t, newBoltTestStorage(t, nil))
+}
@@ -0,0 +1,1315 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dimaskiddo/play-with-docker/pwd/types"
+	"github.com/redis/go-redis/v9"
+)
+
+// Number of times an update is retried when another replica changed the
+// records it read before it could commit.
+const redisMaxRetries = 50
+
+var ConflictError = errors.New("Conflict")
+
+// redisStorage keeps every record as a JSON string under
+// <prefix><kind>:<id>, together with a set of all the ids of each kind and
+// the secondary indexes as sets. Updates run in WATCH/MULTI transactions so
+// that concurrent replicas never leave the indexes out of sync with the
+// records, and publish the changes for the watches of every replica.
+type redisStorage struct {
+	client *redis.Client
+	prefix string
+	hub    *WatchHub
+
+	mx  sync.Mutex
+	sub *redis.PubSub
+}
+
+// NewRedisStorage connects to the Redis server at url, such as
+// redis://localhost:6379/0, and keeps every key under prefix. It fails if the
+// storage has pending migrations, since other replicas may be serving from
+// it: they are run by MigrateRedis.
+func NewRedisStorage(url, prefix string) (StorageApi, error) {
+	store, err := newRedisStorage(url, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	err = store.checkVersion()
+	if err != nil {
+		store.close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+func newRedisStorage(url, prefix string) (*redisStorage, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	client := redis.NewClient(opts)
+
+	err = client.Ping(context.Background()).Err()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &redisStorage{client: client, prefix: prefix, hub: NewWatchHub()}, nil
+}
+
+// RedisSchemaVersion returns the schema version of the storage at url.
+func RedisSchemaVersion(url, prefix string) (int, error) {
+	store, err := newRedisStorage(url, prefix)
+	if err != nil {
+		return 0, err
+	}
+	defer store.close()
+
+	return store.schemaVersion()
+}
+
+// MigrateRedis runs the pending migrations of the storage at url. It rewrites
+// every record, so the replicas using it must be stopped meanwhile.
+func MigrateRedis(url, prefix string) error {
+	store, err := newRedisStorage(url, prefix)
+	if err != nil {
+		return err
+	}
+	defer store.close()
+
+	return store.migrate()
+}
+
+// ExportRedis reads every record of the storage at url. It does not stop
+// other replicas, so records changed while it runs may or may not be included.
+func ExportRedis(url, prefix string) (*DB, error) {
+	store, err := newRedisStorage(url, prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer store.close()
+
+	db, err := store.dump()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.migrate()
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func (store *redisStorage) close() error {
+	store.mx.Lock()
+	if store.sub != nil {
+		store.sub.Close()
+	}
+	store.mx.Unlock()
+
+	return store.client.Close()
+}
+
+func (store *redisStorage) key(kind Kind, id string) string {
+	return store.prefix + string(kind) + ":" + id
+}
+
+func (store *redisStorage) allKey(kind Kind) string {
+	return store.prefix + "all:" + string(kind)
+}
+
+func (store *redisStorage) sessionIndexKey(sessionId string, kind Kind) string {
+	return store.prefix + "idx:session:" + sessionId + ":" + string(kind)
+}
+
+func (store *redisStorage) userSessionsKey(userId string) string {
+	return store.prefix + "idx:user:" + userId + ":session"
+}
+
+func (store *redisStorage) playgroundSessionsKey(playgroundId string) string {
+	return store.prefix + "idx:playground:" + playgroundId + ":session"
+}
+
+func (store *redisStorage) expiryKey() string {
+	return store.prefix + "idx:expiry:session"
+}
+
+func (store *redisStorage) imageInstancesKey(image string) string {
+	return store.prefix + "idx:image:" + image + ":instance"
+}
+
+func (store *redisStorage) providerKey() string {
+	return store.prefix + "idx:provider:user"
+}
+
+func (store *redisStorage) versionKey() string {
+	return store.prefix + "version"
+}
+
+func (store *redisStorage) changesKey() string {
+	return store.prefix + "changes"
+}
+
+// schemaVersion returns 0 for records written before the version was stored
+// and SchemaVersion if there are no records at all.
+func (store *redisStorage) schemaVersion() (int, error) {
+	ctx := context.Background()
+
+	v, err := store.client.Get(ctx, store.versionKey()).Int()
+	if err != redis.Nil {
+		return v, err
+	}
+
+	keys := []string{}
+	for _, kind := range []Kind{KindSession, KindInstance, KindClient, KindWindowsInstance, KindLoginRequest, KindUser, KindPlayground} {
+		keys = append(keys, store.allKey(kind))
+	}
+
+	n, err := store.client.Exists(ctx, keys...).Result()
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return SchemaVersion, nil
+	}
+
+	return 0, nil
+}
+
+// checkVersion marks an empty storage with SchemaVersion and fails if the
+// storage is at any other version.
+func (store *redisStorage) checkVersion() error {
+	version, err := store.schemaVersion()
+	if err != nil {
+		return err
+	}
+
+	if version > SchemaVersion {
+		return fmt.Errorf("storage schema version %d is newer than the supported version %d", version, SchemaVersion)
+	}
+	if version < SchemaVersion {
+		return fmt.Errorf("storage schema version %d is older than %d, run the storage migrate command with the replicas stopped", version, SchemaVersion)
+	}
+
+	return store.client.SetNX(context.Background(), store.versionKey(), SchemaVersion, 0).Err()
+}
+
+func (store *redisStorage) migrate() error {
+	version, err := store.schemaVersion()
+	if err != nil {
+		return err
+	}
+
+	if version == SchemaVersion {
+		return store.client.SetNX(context.Background(), store.versionKey(), SchemaVersion, 0).Err()
+	}
+
+	db, err := store.dump()
+	if err != nil {
+		return err
+	}
+
+	_, err = db.migrate()
+	if err != nil {
+		return err
+	}
+
+	return store.restore(db)
+}
+
+// get decodes the record of kind with id from c, which is either the client
+// or a transaction, into v.
+func (store *redisStorage) get(c redis.Cmdable, kind Kind, id string, v interface{}) error {
+	b, err := c.Get(context.Background(), store.key(kind, id)).Bytes()
+	if err == redis.Nil {
+		return NotFoundError
+	}
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+// getAll returns the encoded records of kind with the given ids, skipping the
+// ones that do not exist.
+func (store *redisStorage) getAll(c redis.Cmdable, kind Kind, ids []string) ([][]byte, error) {
+	if len(ids) == 0 {
+		return [][]byte{}, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = store.key(kind, id)
+	}
+
+	values, err := c.MGet(context.Background(), keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	records := [][]byte{}
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			records = append(records, []byte(s))
+		}
+	}
+
+	return records, nil
+}
+
+func (store *redisStorage) members(c redis.Cmdable, key string) ([]string, error) {
+	ids, err := c.SMembers(context.Background(), key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(ids)
+
+	return ids, nil
+}
+
+func (store *redisStorage) set(pipe redis.Pipeliner, kind Kind, id string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	pipe.Set(ctx, store.key(kind, id), b, 0)
+	pipe.SAdd(ctx, store.allKey(kind), id)
+
+	return nil
+}
+
+func (store *redisStorage) del(pipe redis.Pipeliner, kind Kind, id string) {
+	ctx := context.Background()
+	pipe.Del(ctx, store.key(kind, id))
+	pipe.SRem(ctx, store.allKey(kind), id)
+}
+
+// update runs fn in a transaction that fails if any of keys is changed by
+// someone else before it commits, in which case it is retried. fn reads
+// through tx and returns the writes to commit along with the resulting
+// events.
+//
+// Only keys are watched, which the callers set to the keys they write. This
+// keeps the records and their indexes consistent, but a caller that reads a
+// record, changes it and puts it back through separate calls still loses the
+// updates made by other replicas in between.
+func (store *redisStorage) update(fn func(tx *redis.Tx) (func(pipe redis.Pipeliner) error, []WatchEvent, error), keys ...string) error {
+	ctx := context.Background()
+
+	for n := 0; n < redisMaxRetries; n++ {
+		err := store.client.Watch(ctx, func(tx *redis.Tx) error {
+			writes, events, err := fn(tx)
+			if err != nil || writes == nil {
+				return err
+			}
+
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				if err := writes(pipe); err != nil {
+					return err
+				}
+
+				for _, e := range events {
+					b, err := json.Marshal(e)
+					if err != nil {
+						return err
+					}
+
+					pipe.Publish(ctx, store.changesKey(), b)
+				}
+
+				return nil
+			})
+
+			return err
+		}, keys...)
+		if err == redis.TxFailedErr {
+			continue
+		}
+
+		return err
+	}
+
+	return ConflictError
+}
+
+func (store *redisStorage) Watch(kind Kind, filter WatchFilter) (*Watch, error) {
+	w, err := store.hub.Watch(kind, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	store.mx.Lock()
+	defer store.mx.Unlock()
+
+	if store.sub == nil {
+		ctx := context.Background()
+
+		sub := store.client.Subscribe(ctx, store.changesKey())
+		if _, err := sub.Receive(ctx); err != nil {
+			sub.Close()
+			w.Close()
+			return nil, err
+		}
+
+		store.sub = sub
+		go store.follow(sub)
+	}
+
+	return w, nil
+}
+
+// follow delivers the changes published by every replica, including this one,
+// to the local watches.
+func (store *redisStorage) follow(sub *redis.PubSub) {
+	for msg := range sub.Channel() {
+		var e WatchEvent
+		if err := json.Unmarshal([]byte(msg.Payload), &e); err != nil {
+			log.Printf("Error decoding storage change. Got: %v\n", err)
+			continue
+		}
+
+		store.hub.Publish(e)
+	}
+}
+
+func (store *redisStorage) SessionGet(id string) (*types.Session, error) {
+	var session *types.Session
+
+	err := store.get(store.client, KindSession, id, &session)
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func (store *redisStorage) SessionGetAll() ([]*types.Session, error) {
+	ids, err := store.members(store.client, store.allKey(KindSession))
+	if err != nil {
+		return nil, err
+	}
+
+	return store.sessions(ids)
+}
+
+func (store *redisStorage) sessions(ids []string) ([]*types.Session, error) {
+	records, err := store.getAll(store.client, KindSession, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]*types.Session, len(records))
+	for i, b := range records {
+		if err := json.Unmarshal(b, &sessions[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return sessions, nil
+}
+
+func (store *redisStorage) SessionPut(session *types.Session) error {
+	return store.update(func(tx *redis.Tx) (func(pipe redis.Pipeliner) error, []WatchEvent, error) {
+		var old *types.Session
+		if err := store.get(tx, KindSession, session.Id, &old); err != nil && !NotFound(err) {
+			return nil, nil, err
+		}
+
+		writes := func(pipe redis.Pipeliner) error {
+			ctx := context.Background()
+
+			if old != nil {
+				pipe.SRem(ctx, store.userSessionsKey(old.UserId), old.Id)
+				pipe.SRem(ctx, store.playgroundSessionsKey(old.PlaygroundId), old.Id)
+			}
+
+			pipe.SAdd(ctx, store.userSessionsKey(session.UserId), session.Id)
+			pipe.SAdd(ctx, store.playgroundSessionsKey(session.PlaygroundId), session.Id)
+
+			if session.ExpiresAt.IsZero() {
+				pipe.ZRem(ctx, store.expiryKey(), session.Id)
+			} else {
+				pipe.ZAdd(ctx, store.expiryKey(), redis.Z{Score: float64(session.ExpiresAt.UnixMilli()), Member: session.Id})
+			}
+
+			return store.set(pipe, KindSession, session.Id, session)
+		}
+
+		return writes, []WatchEvent{{Kind: KindSession, Op: OpPut, Id: session.Id, Session: session}}, nil
+	}, store.key(KindSession, session.Id))
+}
+
+// SessionTouch reads the session in the transaction, so it is retried if
+// another replica changes it meanwhile. The indexes do not depend on the
+// fields it changes.
+func (store *redisStorage) SessionTouch(id string, at time.Time) error {
+	return store.update(func(tx *redis.Tx) (func(pipe redis.Pipeliner) error, []WatchEvent, error) {
+		var session *types.Session
+		if err := store.get(tx, KindSession, id, &session); err != nil {
+			return nil, nil, err
+		}
+
+		session.LastActivity = at
+		session.IdleWarnedAt = time.Time{}
+
+		writes := func(pipe redis.Pipeliner) error {
+			return store.set(pipe, KindSession, id, session)
+		}
+
+		return writes, []WatchEvent{{Kind: KindSession, Op: OpPut, Id: id, Session: session}}, nil
+	}, store.key(KindSession, id))
+}
+
+func (store *redisStorage) SessionIdleWarn(id string, at time.Time) error {
+	return store.update(func(tx *redis.Tx) (func(pipe redis.Pipeliner) error, []WatchEvent, error) {
+		var session *types.Session
+		if err := store.get(tx, KindSession, id, &session); err != nil {
+			return nil, nil, err
+		}
+
+		session.IdleWarnedAt = at
+
+		writes := func(pipe redis.Pipeliner) error {
+			return store.set(pipe, KindSession, id, session)
+		}
+
+		return writes, []WatchEvent{{Kind: KindSession, Op: OpPut, Id: id, Session: session}}, nil
+	}, store.key(KindSession, id))
+}
+
+func (store *redisStorage) SessionDelete(id string) error {
+	return store.update(func(tx *redis.Tx) (func(pipe redis.Pipeliner) error, []WatchEvent, error) {
+		var session *types.Session
+		if err := store.get(tx, KindSession, id, &session); err != nil {
+			if NotFound(err) {
+				return nil, nil, nil
+			}
+
+			return nil, nil, err
+		}
+
+		instances, err := store.members(tx, store.sessionIndexKey(id, KindInstance))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		windowsInstances, err := store.members(tx, store.sessionIndexKey(id, KindWindowsInstance))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		clients, err := store.members(tx, store.sessionIndexKey(id, KindClient))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		events := []WatchEvent{}
+		images := map[string]string{}
+
+		for _, name := range instances {
+			var i *types.Instance
+			if err := store.get(tx, KindInstance, name, &i); err == nil {
+				images[name] = i.Image
+				events = append(events, WatchEvent{Kind: KindInstance, Op: OpDelete, Id: name, Instance: i})
+			}
+		}
+
+		for _, clientId := range clients {
+			var c *types.Client
+			if err := store.get(tx, KindClient, clientId, &c); err == nil {
+				events = append(events, WatchEvent{Kind: KindClient, Op: OpDelete, Id: clientId, Client: c})
+			}
+		}
+
+		events = append(events, WatchEvent{Kind: KindSession, Op: OpDelete, Id: id, Session: session})
+
+		writes := func(pipe redis.Pipeliner) error {
+			ctx := context.Background()
+
+			for _, name := range instances {
+				store.del(pipe, KindInstance, name)
+				pipe.SRem(ctx, store.imageInstancesKey(images[name]), name)
+			}
+
+			for _, instanceId := range windowsInstances {
+				store.del(pipe, KindWindowsInstance, instanceId)
+			}
+
+			for _, clientId := range clients {
+				store.del(pipe, KindClient, clientId)
+			}
+
+			pipe.Del(ctx, store.sessionIndexKey(id, KindInstance), store.sessionIndexKey(id, KindWindowsInstance), store.sessionIndexKey(id, KindClient))
+			pipe.SRem(ctx, store.userSessionsKey(session.UserId), id)
+			pipe.SRem(ctx, store.playgroundSessionsKey(session.PlaygroundId), id)
+			pipe.ZRem(ctx, store.expiryKey(), id)
+			store.del(pipe, KindSession, id)
+
+			return nil
+		}
+
+		return writes, events, nil
+	}, store.key(KindSession, id), store.sessionIndexKey(id, KindInstance), store.sessionIndexKey(id, KindWindowsInstance), store.sessionIndexKey(id, KindClient))
+}
+
+func (store *redisStorage) SessionCount() (int, error) {
+	n, err := store.client.SCard(context.Background(), store.allKey(KindSession)).Result()
+	return int(n), err
+}
+
+func (store *redisStorage) SessionFindByUserId(userId string, page Page) ([]*types.Session, string, error) {
+	return store.sessionFind(store.userSessionsKey(userId), page)
+}
+
+func (store *redisStorage) SessionFindByPlaygroundId(playgroundId string, page Page) ([]*types.Session, string, error) {
+	return store.sessionFind(store.playgroundSessionsKey(playgroundId), page)
+}
+
+// SessionFindExpiringBefore compares expiry times to the millisecond.
+func (store *redisStorage) SessionFindExpiringBefore(t time.Time, page Page) ([]*types.Session, string, error) {
+	ids, err := store.client.ZRangeByScore(context.Background(), store.expiryKey(), &redis.ZRangeBy{
+		Min: "-inf",
+		Max: "(" + strconv.FormatInt(t.UnixMilli(), 10),
+	}).Result()
+	if err != nil {
+		return nil, "", err
+	}
+
+	return store.sessionPage(ids, page)
+}
+
+func (store *redisStorage) sessionFind(index string, page Page) ([]*types.Session, string, error) {
+	ids, err := store.members(store.client, index)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return store.sessionPage(ids, page)
+}
+
+func (store *redisStorage) sessionPage(ids []string, page Page) ([]*types.Session, string, error) {
+	ids, next, err := pageKeys(ids, page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	sessions, err := store.sessions(ids)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return sessions, next, nil
+}
+
+func (store *redisStorage) InstanceGet(name string) (*types.Instance, error) {
+	var instance *types.Instance
+
+	err := store.get(store.client, KindInstance, name, &instance)
+	if err != nil {
+		return nil, err
+	}
+
+	return instance, nil
+}
+
+func (store *redisStorage) instances(ids []string) ([]*types.Instance, error) {
+	records, err := store.getAll(store.client, KindInstance, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	instances := make([]*types.Instance, len(records))
+	for i, b := range records {
+		if err := json.Unmarshal(b, &instances[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return instances, nil
+}
+
+func (store *redisStorage) InstanceFindBySessionId(sessionId string) ([]*types.Instance, error) {
+	names, err := store.members(store.client, store.sessionIndexKey(sessionId, KindInstance))
+	if err != nil {
+		return nil, err
+	}
+
+	return store.instances(names)
+}
+
+func (store *redisStorage) InstanceFindByImage(image string, page Page) ([]*types.Instance, string, error) {
+	names, err := store.members(store.client, store.imageInstancesKey(image))
+	if err != nil {
+		return nil, "", err
+	}
+
+	names, next, err := pageKeys(names, page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	instances, err := store.instances(names)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return instances, next, nil
+}
+
+func (store *redisStorage) InstancePut(instance *types.Instance) error {
+	return store.update(func(tx *redis.Tx) (func(pipe redis.Pipeliner) error, []WatchEvent, error) {
+		n, err := tx.Exists(context.Background(), store.key(KindSession, instance.SessionId)).Result()
+		if err != nil {
+			return nil, nil, err
+		}
+		if n == 0 {
+			return nil, nil, NotFoundError
+		}
+
+		var old *types.Instance
+		if err := store.get(tx, KindInstance, instance.Name, &old); err != nil && !NotFound(err) {
+			return nil, nil, err
+		}
+
+		writes := func(pipe redis.Pipeliner) error {
+			ctx := context.Background()
+
+			if old != nil {
+				pipe.SRem(ctx, store.sessionIndexKey(old.SessionId, KindInstance), old.Name)
+				pipe.SRem(ctx, store.imageInstancesKey(old.Image), old.Name)
+			}
+
+			pipe.SAdd(ctx, store.sessionIndexKey(instance.SessionId, KindInstance), instance.Name)
+			pipe.SAdd(ctx, store.imageInstancesKey(instance.Image), instance.Name)
+
+			return store.set(pipe, KindInstance, instance.Name, instance)
+		}
+
+		return writes, []WatchEvent{{Kind: KindInstance, Op: OpPut, Id: instance.Name, Instance: instance}}, nil
+	}, store.key(KindSession, instance.SessionId), store.key(KindInstance, instance.Name))
+}
+
+func (store *redisStorage) InstanceDelete(name string) error {
+	return store.update(func(tx *redis.Tx) (func(pipe redis.Pipeliner) error, []WatchEvent, error) {
+		var instance *types.Instance
+		if err := store.get(tx, KindInstance, name, &instance); err != nil {
+			if NotFound(err) {
+				return nil, nil, nil
+			}
+
+			return nil, nil, err
+		}
+
+		writes := func(pipe redis.Pipeliner) error {
+			ctx := context.Background()
+
+			pipe.SRem(ctx, store.sessionIndexKey(instance.SessionId, KindInstance), name)
+			pipe.SRem(ctx, store.imageInstancesKey(instance.Image), name)
+			store.del(pipe, KindInstance, name)
+
+			return nil
+		}
+
+		return writes, []WatchEvent{{Kind: KindInstance, Op: OpDelete, Id: name, Instance: instance}}, nil
+	}, store.key(KindInstance, name))
+}
+
+func (store *redisStorage) InstanceCount() (int, error) {
+	n, err := store.client.SCard(context.Background(), store.allKey(KindInstance)).Result()
+	return int(n), err
+}
+
+func (store *redisStorage) WindowsInstanceGetAll() ([]*types.WindowsInstance, error) {
+	ids, err := store.members(store.client, store.allKey(KindWindowsInstance))
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := store.getAll(store.client, KindWindowsInstance, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	instances := make([]*types.WindowsInstance, len(records))
+	for i, b := range records {
+		if err := json.Unmarshal(b, &instances[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return instances, nil
+}
+
+func (store *redisStorage) WindowsInstancePut(instance *types.WindowsInstance) error {
+	return store.update(func(tx *redis.Tx) (func(pipe redis.Pipeliner) error, []WatchEvent, error) {
+		n, err := tx.Exists(context.Background(), store.key(KindSession, instance.SessionId)).Result()
+		if err != nil {
+			return nil, nil, err
+		}
+		if n == 0 {
+			return nil, nil, NotFoundError
+		}
+
+		writes := func(pipe redis.Pipeliner) error {
+			pipe.SAdd(context.Background(), store.sessionIndexKey(instance.SessionId, KindWindowsInstance), instance.Id)
+
+			return store.set(pipe, KindWindowsInstance, instance.Id, instance)
+		}
+
+		return writes, nil, nil
+	}, store.key(KindSession, instance.SessionId), store.key(KindWindowsInstance, instance.Id))
+}
+
+func (store *redisStorage) WindowsInstanceDelete(id string) error {
+	return store.update(func(tx *redis.Tx) (func(pipe redis.Pipeliner) error, []WatchEvent, error) {
+		var instance *types.WindowsInstance
+		if err := store.get(tx, KindWindowsInstance, id, &instance); err != nil {
+			if NotFound(err) {
+				return nil, nil, nil
+			}
+
+			return nil, nil, err
+		}
+
+		writes := func(pipe redis.Pipeliner) error {
+			pipe.SRem(context.Background(), store.sessionIndexKey(instance.SessionId, KindWindowsInstance), id)
+			store.del(pipe, KindWindowsInstance, id)
+
+			return nil
+		}
+
+		return writes, nil, nil
+	}, store.key(KindWindowsInstance, id))
+}
+
+func (store *redisStorage) ClientGet(id string) (*types.Client, error) {
+	var client *types.Client
+
+	err := store.get(store.client, KindClient, id, &client)
+	if err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+func (store *redisStorage) ClientFindBySessionId(sessionId string) ([]*types.Client, error) {
+	ids, err := store.members(store.client, store.sessionIndexKey(sessionId, KindClient))
+	if err != nil {
+		return nil, err
+	}
+
+	return store.clients(ids)
+}
+
+func (store *redisStorage) clients(ids []string) ([]*types.Client, error) {
+	records, err := store.getAll(store.client, KindClient, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	clients := make([]*types.Client, len(records))
+	for i, b := range records {
+		if err := json.Unmarshal(b, &clients[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return clients, nil
+}
+
+func (store *redisStorage) ClientPut(client *types.Client) error {
+	return store.update(func(tx *redis.Tx) (func(pipe redis.Pipeliner) error, []WatchEvent, error) {
+		n, err := tx.Exists(context.Background(), store.key(KindSession, client.SessionId)).Result()
+		if err != nil {
+			return nil, nil, err
+		}
+		if n == 0 {
+			return nil, nil, NotFoundError
+		}
+
+		writes := func(pipe redis.Pipeliner) error {
+			pipe.SAdd(context.Background(), store.sessionIndexKey(client.SessionId, KindClient), client.Id)
+
+			return store.set(pipe, KindClient, client.Id, client)
+		}
+
+		return writes, []WatchEvent{{Kind: KindClient, Op: OpPut, Id: client.Id, Client: client}}, nil
+	}, store.key(KindSession, client.SessionId), store.key(KindClient, client.Id))
+}
+
+func (store *redisStorage) ClientDelete(id string) error {
+	_, err := store.clientDelete(id, nil)
+	return err
+}
+
+// clientDelete deletes the client with id if expired is nil or returns true
+// for it, and reports whether it was deleted.
+func (store *redisStorage) clientDelete(id string, expired func(c *types.Client) bool) (bool, error) {
+	deleted := false
+
+	err := store.update(func(tx *redis.Tx) (func(pipe redis.Pipeliner) error, []WatchEvent, error) {
+		deleted = false
+
+		var client *types.Client
+		if err := store.get(tx, KindClient, id, &client); err != nil {
+			if NotFound(err) {
+				return nil, nil, nil
+			}
+
+			return nil, nil, err
+		}
+
+		if expired != nil && !expired(client) {
+			return nil, nil, nil
+		}
+
+		writes := func(pipe redis.Pipeliner) error {
+			pipe.SRem(context.Background(), store.sessionIndexKey(client.SessionId, KindClient), id)
+			store.del(pipe, KindClient, id)
+			deleted = true
+
+			return nil
+		}
+
+		return writes, []WatchEvent{{Kind: KindClient, Op: OpDelete, Id: id, Client: client}}, nil
+	}, store.key(KindClient, id))
+
+	return deleted, err
+}
+
+func (store *redisStorage) ClientCount() (int, error) {
+	n, err := store.client.SCard(context.Background(), store.allKey(KindClient)).Result()
+	return int(n), err
+}
+
+func (store *redisStorage) ClientDeleteExpired(now time.Time) (int, error) {
+	ids, err := store.members(store.client, store.allKey(KindClient))
+	if err != nil {
+		return 0, err
+	}
+
+	clients, err := store.clients(ids)
+	if err != nil {
+		return 0, err
+	}
+
+	expired := func(c *types.Client) bool {
+		return !c.ExpiresAt.IsZero() && !c.ExpiresAt.After(now)
+	}
+
+	count := 0
+	for _, c := range clients {
+		if !expired(c) {
+			continue
+		}
+
+		deleted, err := store.clientDelete(c.Id, expired)
+		if err != nil {
+			return count, err
+		}
+		if deleted {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (store *redisStorage) LoginRequestPut(loginRequest *types.LoginRequest) error {
+	return store.update(func(tx *redis.Tx) (func(pipe redis.Pipeliner) error, []WatchEvent, error) {
+		writes := func(pipe redis.Pipeliner) error {
+			return store.set(pipe, KindLoginRequest, loginRequest.Id, loginRequest)
+		}
+
+		return writes, nil, nil
+	})
+}
+
+func (store *redisStorage) LoginRequestGet(id string) (*types.LoginRequest, error) {
+	var loginRequest *types.LoginRequest
+
+	err := store.get(store.client, KindLoginRequest, id, &loginRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	return loginRequest, nil
+}
+
+func (store *redisStorage) LoginRequestDelete(id string) error {
+	return store.update(func(tx *redis.Tx) (func(pipe redis.Pipeliner) error, []WatchEvent, error) {
+		writes := func(pipe redis.Pipeliner) error {
+			store.del(pipe, KindLoginRequest, id)
+			return nil
+		}
+
+		return writes, nil, nil
+	})
+}
+
+func (store *redisStorage) LoginRequestDeleteExpired(now time.Time) (int, error) {
+	ids, err := store.members(store.client, store.allKey(KindLoginRequest))
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, id := range ids {
+		deleted := false
+
+		err := store.update(func(tx *redis.Tx) (func(pipe redis.Pipeliner) error, []WatchEvent, error) {
+			deleted = false
+
+			var loginRequest *types.LoginRequest
+			if err := store.get(tx, KindLoginRequest, id, &loginRequest); err != nil {
+				if NotFound(err) {
+					return nil, nil, nil
+				}
+
+				return nil, nil, err
+			}
+
+			if loginRequest.ExpiresAt.IsZero() || loginRequest.ExpiresAt.After(now) {
+				return nil, nil, nil
+			}
+
+			writes := func(pipe redis.Pipeliner) error {
+				store.del(pipe, KindLoginRequest, id)
+				deleted = true
+
+				return nil
+			}
+
+			return writes, nil, nil
+		}, store.key(KindLoginRequest, id))
+		if err != nil {
+			return count, err
+		}
+
+		if deleted {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (store *redisStorage) UserGet(id string) (*types.User, error) {
+	var user *types.User
+
+	err := store.get(store.client, KindUser, id, &user)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (store *redisStorage) UserFindByProvider(providerName, providerUserId string) (*types.User, error) {
+	id, err := store.client.HGet(context.Background(), store.providerKey(), fmt.Sprintf("%s_%s", providerName, providerUserId)).Result()
+	if err == redis.Nil {
+		return nil, NotFoundError
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return store.UserGet(id)
+}
+
+func (store *redisStorage) UserPut(user *types.User) error {
+	return store.update(func(tx *redis.Tx) (func(pipe redis.Pipeliner) error, []WatchEvent, error) {
+		writes := func(pipe redis.Pipeliner) error {
+			pipe.HSet(context.Background(), store.providerKey(), fmt.Sprintf("%s_%s", user.Provider, user.ProviderUserId), user.Id)
+
+			return store.set(pipe, KindUser, user.Id, user)
+		}
+
+		return writes, nil, nil
+	})
+}
+
+func (store *redisStorage) PlaygroundGet(id string) (*types.Playground, error) {
+	var playground *types.Playground
+
+	err := store.get(store.client, KindPlayground, id, &playground)
+	if err != nil {
+		return nil, err
+	}
+
+	return playground, nil
+}
+
+func (store *redisStorage) PlaygroundGetAll() ([]*types.Playground, error) {
+	ids, err := store.members(store.client, store.allKey(KindPlayground))
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := store.getAll(store.client, KindPlayground, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	playgrounds := make([]*types.Playground, len(records))
+	for i, b := range records {
+		if err := json.Unmarshal(b, &playgrounds[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return playgrounds, nil
+}
+
+func (store *redisStorage) PlaygroundPut(playground *types.Playground) error {
+	return store.update(func(tx *redis.Tx) (func(pipe redis.Pipeliner) error, []WatchEvent, error) {
+		writes := func(pipe redis.Pipeliner) error {
+			return store.set(pipe, KindPlayground, playground.Id, playground)
+		}
+
+		return writes, []WatchEvent{{Kind: KindPlayground, Op: OpPut, Id: playground.Id, Playground: playground}}, nil
+	})
+}
+
+// Leases are kept apart from the other records, under a key that expires
+// along with them.
+func (store *redisStorage) LeaseAcquire(name, holder string, ttl time.Duration) (*types.Lease, error) {
+	var lease *types.Lease
+	key := store.key(KindLease, name)
+
+	err := store.update(func(tx *redis.Tx) (func(pipe redis.Pipeliner) error, []WatchEvent, error) {
+		var current *types.Lease
+		if err := store.get(tx, KindLease, name, &current); err != nil && !NotFound(err) {
+			return nil, nil, err
+		}
+
+		var taken bool
+		lease, taken = takeLease(current, name, holder, ttl, time.Now())
+		if !taken {
+			return nil, nil, nil
+		}
+
+		b, err := json.Marshal(lease)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		writes := func(pipe redis.Pipeliner) error {
+			pipe.Set(context.Background(), key, b, ttl)
+			return nil
+		}
+
+		return writes, nil, nil
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return lease, nil
+}
+
+func (store *redisStorage) LeaseRelease(name, holder string) error {
+	key := store.key(KindLease, name)
+
+	return store.update(func(tx *redis.Tx) (func(pipe redis.Pipeliner) error, []WatchEvent, error) {
+		var lease *types.Lease
+		if err := store.get(tx, KindLease, name, &lease); err != nil {
+			if NotFound(err) {
+				return nil, nil, nil
+			}
+
+			return nil, nil, err
+		}
+
+		if lease.Holder != holder {
+			return nil, nil, nil
+		}
+
+		writes := func(pipe redis.Pipeliner) error {
+			pipe.Del(context.Background(), key)
+			return nil
+		}
+
+		return writes, nil, nil
+	}, key)
+}
+
+func (store *redisStorage) dump() (*DB, error) {
+	db := newDB()
+
+	records := []struct {
+		kind Kind
+		into interface{}
+	}{
+		{KindSession, &db.Sessions},
+		{KindInstance, &db.Instances},
+		{KindClient, &db.Clients},
+		{KindWindowsInstance, &db.WindowsInstances},
+		{KindLoginRequest, &db.LoginRequests},
+		{KindUser, &db.Users},
+		{KindPlayground, &db.Playgrounds},
+	}
+
+	for _, r := range records {
+		ids, err := store.members(store.client, store.allKey(r.kind))
+		if err != nil {
+			return nil, err
+		}
+
+		raw := map[string]json.RawMessage{}
+		for _, id := range ids {
+			b, err := store.client.Get(context.Background(), store.key(r.kind, id)).Bytes()
+			if err == redis.Nil {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			raw[id] = json.RawMessage(b)
+		}
+
+		encoded, err := json.Marshal(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(encoded, r.into); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, i := range db.Instances {
+		db.InstancesBySessionId[i.SessionId] = indexAdd(db.InstancesBySessionId[i.SessionId], i.Name)
+	}
+	for _, i := range db.WindowsInstances {
+		db.WindowsInstancesBySessionId[i.SessionId] = indexAdd(db.WindowsInstancesBySessionId[i.SessionId], i.Id)
+	}
+	for _, c := range db.Clients {
+		db.ClientsBySessionId[c.SessionId] = indexAdd(db.ClientsBySessionId[c.SessionId], c.Id)
+	}
+	for _, u := range db.Users {
+		db.UsersByProvider[fmt.Sprintf("%s_%s", u.Provider, u.ProviderUserId)] = u.Id
+	}
+
+	version, err := store.schemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	db.Version = version
+
+	return db, nil
+}
+
+// restore replaces the records and indexes under the prefix with the records
+// of db. Leases and the keys of anything else sharing the prefix, such as the
+// event broker, are kept. Other replicas must be stopped while it runs.
+func (store *redisStorage) restore(db *DB) error {
+	ctx := context.Background()
+
+	patterns := []string{store.prefix + "all:*", store.prefix + "idx:*", store.versionKey()}
+	for _, kind := range []Kind{KindSession, KindInstance, KindClient, KindWindowsInstance, KindLoginRequest, KindUser, KindPlayground} {
+		patterns = append(patterns, store.key(kind, "*"))
+	}
+
+	keys := []string{}
+	for _, pattern := range patterns {
+		iter := store.client.Scan(ctx, 0, pattern, 0).Iterator()
+		for iter.Next(ctx) {
+			keys = append(keys, iter.Val())
+		}
+		if err := iter.Err(); err != nil {
+			return err
+		}
+	}
+
+	_, err := store.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if len(keys) > 0 {
+			pipe.Del(ctx, keys...)
+		}
+
+		for _, s := range db.Sessions {
+			pipe.SAdd(ctx, store.userSessionsKey(s.UserId), s.Id)
+			pipe.SAdd(ctx, store.playgroundSessionsKey(s.PlaygroundId), s.Id)
+			if !s.ExpiresAt.IsZero() {
+				pipe.ZAdd(ctx, store.expiryKey(), redis.Z{Score: float64(s.ExpiresAt.UnixMilli()), Member: s.Id})
+			}
+
+			if err := store.set(pipe, KindSession, s.Id, s); err != nil {
+				return err
+			}
+		}
+
+		for _, i := range db.Instances {
+			pipe.SAdd(ctx, store.sessionIndexKey(i.SessionId, KindInstance), i.Name)
+			pipe.SAdd(ctx, store.imageInstancesKey(i.Image), i.Name)
+
+			if err := store.set(pipe, KindInstance, i.Name, i); err != nil {
+				return err
+			}
+		}
+
+		for _, i := range db.WindowsInstances {
+			pipe.SAdd(ctx, store.sessionIndexKey(i.SessionId, KindWindowsInstance), i.Id)
+
+			if err := store.set(pipe, KindWindowsInstance, i.Id, i); err != nil {
+				return err
+			}
+		}
+
+		for _, c := range db.Clients {
+			pipe.SAdd(ctx, store.sessionIndexKey(c.SessionId, KindClient), c.Id)
+
+			if err := store.set(pipe, KindClient, c.Id, c); err != nil {
+				return err
+			}
+		}
+
+		for _, lr := range db.LoginRequests {
+			if err := store.set(pipe, KindLoginRequest, lr.Id, lr); err != nil {
+				return err
+			}
+		}
+
+		for _, u := range db.Users {
+			pipe.HSet(ctx, store.providerKey(), fmt.Sprintf("%s_%s", u.Provider, u.ProviderUserId), u.Id)
+
+			if err := store.set(pipe, KindUser, u.Id, u); err != nil {
+				return err
+			}
+		}
+
+		for _, p := range db.Playgrounds {
+			if err := store.set(pipe, KindPlayground, p.Id, p); err != nil {
+				return err
+			}
+		}
+
+		pipe.Set(ctx, store.versionKey(), db.Version, 0)
+
+		return nil
+	})
+
+	return err
+}
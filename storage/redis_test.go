@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dimaskiddo/play-with-docker/pwd/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRedisTestStorage(t *testing.T, server *miniredis.Miniredis) *redisStorage {
+	s, err := NewRedisStorage("redis://"+server.Addr()+"/0", "pwd:")
+	assert.Nil(t, err)
+
+	store := s.(*redisStorage)
+	t.Cleanup(func() { store.close() })
+
+	return store
+}
+
+func TestRedisStorage(t *testing.T) {
+	store := newRedisTestStorage(t, miniredis.RunT(t))
+
+	s := &types.Session{Id: "s1", UserId: "u1"}
+	i := &types.Instance{Name: "i1", SessionId: s.Id, Image: "franela/dind"}
+	c := &types.Client{Id: "c1", SessionId: s.Id}
+	wi := &types.WindowsInstance{Id: "w1", SessionId: s.Id}
+	u := &types.User{Id: "u1", Provider: "github", ProviderUserId: "42"}
+	p := &types.Playground{Id: "p1", Domain: "localhost"}
+
+	assert.Equal(t, NotFoundError, store.InstancePut(i))
+
+	assert.Nil(t, store.SessionPut(s))
+	assert.Nil(t, store.InstancePut(i))
+	assert.Nil(t, store.ClientPut(c))
+	assert.Nil(t, store.WindowsInstancePut(wi))
+	assert.Nil(t, store.UserPut(u))
+	assert.Nil(t, store.PlaygroundPut(p))
+
+	found, err := store.SessionGet(s.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, s, found)
+
+	instances, err := store.InstanceFindBySessionId(s.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Instance{i}, instances)
+
+	clients, err := store.ClientFindBySessionId(s.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Client{c}, clients)
+
+	user, err := store.UserFindByProvider("github", "42")
+	assert.Nil(t, err)
+	assert.Equal(t, u, user)
+
+	playgrounds, err := store.PlaygroundGetAll()
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Playground{p}, playgrounds)
+
+	// Moving an instance to another image updates the image index.
+	i.Image = "alpine"
+	assert.Nil(t, store.InstancePut(i))
+	instances, _, err = store.InstanceFindByImage("franela/dind", Page{})
+	assert.Nil(t, err)
+	assert.Empty(t, instances)
+
+	assert.Nil(t, store.SessionDelete(s.Id))
+
+	_, err = store.InstanceGet(i.Name)
+	assert.True(t, NotFound(err))
+	_, err = store.ClientGet(c.Id)
+	assert.True(t, NotFound(err))
+
+	windowsInstances, err := store.WindowsInstanceGetAll()
+	assert.Nil(t, err)
+	assert.Empty(t, windowsInstances)
+
+	for _, count := range []func() (int, error){store.SessionCount, store.InstanceCount, store.ClientCount} {
+		n, err := count()
+		assert.Nil(t, err)
+		assert.Equal(t, 0, n)
+	}
+
+	sessions, _, err := store.SessionFindByUserId("u1", Page{})
+	assert.Nil(t, err)
+	assert.Empty(t, sessions)
+}
+
+func TestRedisConcurrentPuts(t *testing.T) {
+	server := miniredis.RunT(t)
+	a := newRedisTestStorage(t, server)
+	b := newRedisTestStorage(t, server)
+
+	assert.Nil(t, a.SessionPut(&types.Session{Id: "s1", UserId: "u1"}))
+
+	var wg sync.WaitGroup
+	for n := 0; n < 20; n++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+
+			store := a
+			if n%2 == 1 {
+				store = b
+			}
+
+			// Every put moves the session to another user, so the user index
+			// only stays consistent if the puts are serialized.
+			assert.Nil(t, store.SessionPut(&types.Session{Id: "s1", UserId: fmt.Sprintf("u%d", n)}))
+			assert.Nil(t, store.InstancePut(&types.Instance{Name: fmt.Sprintf("i%d", n), SessionId: "s1"}))
+		}(n)
+	}
+	wg.Wait()
+
+	s, err := a.SessionGet("s1")
+	assert.Nil(t, err)
+
+	indexed := 0
+	for n := 0; n < 20; n++ {
+		sessions, _, err := b.SessionFindByUserId(fmt.Sprintf("u%d", n), Page{})
+		assert.Nil(t, err)
+		indexed += len(sessions)
+	}
+	assert.Equal(t, 1, indexed)
+
+	sessions, _, err := b.SessionFindByUserId(s.UserId, Page{})
+	assert.Nil(t, err)
+	assert.Len(t, sessions, 1)
+
+	instances, err := b.InstanceFindBySessionId("s1")
+	assert.Nil(t, err)
+	assert.Len(t, instances, 20)
+}
+
+func TestRedisWatch(t *testing.T) {
+	testWatch(t, newRedisTestStorage(t, miniredis.RunT(t)))
+}
+
+func TestRedisWatchOtherReplica(t *testing.T) {
+	server := miniredis.RunT(t)
+	writer := newRedisTestStorage(t, server)
+	reader := newRedisTestStorage(t, server)
+
+	w, err := reader.Watch(KindSession, nil)
+	assert.Nil(t, err)
+	defer w.Close()
+
+	s1 := &types.Session{Id: "s1"}
+	assert.Nil(t, writer.SessionPut(s1))
+	assert.Equal(t, WatchEvent{Kind: KindSession, Op: OpPut, Id: s1.Id, Session: s1}, nextEvent(t, w))
+
+	assert.Nil(t, writer.SessionDelete(s1.Id))
+	assert.Equal(t, WatchEvent{Kind: KindSession, Op: OpDelete, Id: s1.Id, Session: s1}, nextEvent(t, w))
+}
+
+func TestRedisQuery(t *testing.T) {
+	testQuery(t, newRedisTestStorage(t, miniredis.RunT(t)))
+}
+
+func TestRedisDeleteExpired(t *testing.T) {
+	testDeleteExpired(t, newRedisTestStorage(t, miniredis.RunT(t)))
+}
+
+func TestMigrateRedis(t *testing.T) {
+	server := miniredis.RunT(t)
+	url := "redis://" + server.Addr() + "/0"
+
+	// A storage written before the first migration has no version nor
+	// session indexes.
+	server.Set("pwd:session:s1", `{"id":"s1"}`)
+	server.SAdd("pwd:all:session", "s1")
+	server.Set("pwd:instance:i1", `{"name":"i1","session_id":"s1"}`)
+	server.SAdd("pwd:all:instance", "i1")
+
+	// Leases and the keys of the event broker survive the migration.
+	server.Set("pwd:lease:scheduler", `{"name":"scheduler","holder":"a"}`)
+	server.Set("pwd:events", "stream")
+
+	version, err := RedisSchemaVersion(url, "pwd:")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, version)
+
+	// Replicas do not start until the storage is migrated.
+	_, err = NewRedisStorage(url, "pwd:")
+	assert.NotNil(t, err)
+
+	assert.Nil(t, MigrateRedis(url, "pwd:"))
+	assert.True(t, server.Exists("pwd:lease:scheduler"))
+	assert.True(t, server.Exists("pwd:events"))
+
+	store := newRedisTestStorage(t, server)
+
+	version, err = RedisSchemaVersion(url, "pwd:")
+	assert.Nil(t, err)
+	assert.Equal(t, SchemaVersion, version)
+
+	instances, err := store.InstanceFindBySessionId("s1")
+	assert.Nil(t, err)
+	assert.Len(t, instances, 1)
+
+	server.Set("pwd:version", fmt.Sprint(SchemaVersion+1))
+	_, err = NewRedisStorage(url, "pwd:")
+	assert.NotNil(t, err)
+}
+
+func TestRedisSessionTouch(t *testing.T) {
+	testSessionTouch(t, newRedisTestStorage(t, miniredis.RunT(t)))
+}
+
+func TestRedisSessionIdleWarn(t *testing.T) {
+	testSessionIdleWarn(t, newRedisTestStorage(t, miniredis.RunT(t)))
+}
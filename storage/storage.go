@@ -2,6 +2,7 @@ package storage
 
 import (
 	"errors"
+	"time"
 
 	"github.com/dimaskiddo/play-with-docker/pwd/types"
 )
@@ -16,14 +17,25 @@ type StorageApi interface {
 	SessionGet(id string) (*types.Session, error)
 	SessionGetAll() ([]*types.Session, error)
 	SessionPut(session *types.Session) error
+	// SessionTouch sets the last activity of the session to at and clears
+	// its idle warning, without overwriting the changes made meanwhile to
+	// its other fields.
+	SessionTouch(id string, at time.Time) error
+	// SessionIdleWarn sets the idle warning of the session to at, or clears
+	// it when at is zero, without overwriting its other fields.
+	SessionIdleWarn(id string, at time.Time) error
 	SessionDelete(id string) error
 	SessionCount() (int, error)
+	SessionFindByUserId(userId string, page Page) ([]*types.Session, string, error)
+	SessionFindByPlaygroundId(playgroundId string, page Page) ([]*types.Session, string, error)
+	SessionFindExpiringBefore(t time.Time, page Page) ([]*types.Session, string, error)
 
 	InstanceGet(name string) (*types.Instance, error)
 	InstanceFindBySessionId(sessionId string) ([]*types.Instance, error)
 	InstancePut(instance *types.Instance) error
 	InstanceDelete(name string) error
 	InstanceCount() (int, error)
+	InstanceFindByImage(image string, page Page) ([]*types.Instance, string, error)
 
 	WindowsInstanceGetAll() ([]*types.WindowsInstance, error)
 	WindowsInstancePut(instance *types.WindowsInstance) error
@@ -34,10 +46,12 @@ type StorageApi interface {
 	ClientPut(client *types.Client) error
 	ClientDelete(id string) error
 	ClientCount() (int, error)
+	ClientDeleteExpired(now time.Time) (int, error)
 
 	LoginRequestPut(loginRequest *types.LoginRequest) error
 	LoginRequestGet(id string) (*types.LoginRequest, error)
 	LoginRequestDelete(id string) error
+	LoginRequestDeleteExpired(now time.Time) (int, error)
 
 	UserFindByProvider(providerName, providerUserId string) (*types.User, error)
 	UserPut(user *types.User) error
@@ -46,4 +60,16 @@ type StorageApi interface {
 	PlaygroundGet(id string) (*types.Playground, error)
 	PlaygroundGetAll() ([]*types.Playground, error)
 	PlaygroundPut(playground *types.Playground) error
+
+	// LeaseAcquire takes the lease name for holder until ttl from now when it
+	// is free, expired or already held by holder. It returns the lease as
+	// stored afterwards, so holder has it only if it is its holder.
+	LeaseAcquire(name, holder string, ttl time.Duration) (*types.Lease, error)
+	// LeaseRelease frees the lease name if holder has it.
+	LeaseRelease(name, holder string) error
+
+	// Watch returns a feed of the changes to records of the given kind that
+	// match filter, including the ones made by other processes sharing the
+	// storage where the backend supports it.
+	Watch(kind Kind, filter WatchFilter) (*Watch, error)
 }
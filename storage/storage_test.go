@@ -0,0 +1,404 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/dimaskiddo/play-with-docker/pwd/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// storageFactory returns a new storage holding db, when not nil, and a
+// function returning what it persisted, so that the same tests run on the
+// other backends.
+type storageFactory func(t *testing.T, db *DB) (StorageApi, func() *DB)
+
+func testSessionPut(t *testing.T, newStorage storageFactory) {
+	storage, dump := newStorage(t, nil)
+
+	s := &types.Session{Id: "a session"}
+	err := storage.SessionPut(s)
+	assert.Nil(t, err)
+
+	expectedDB := newDB()
+	expectedDB.Sessions[s.Id] = s
+
+	assert.EqualValues(t, expectedDB, dump())
+}
+
+func testSessionGet(t *testing.T, newStorage storageFactory) {
+	expectedSession := &types.Session{Id: "aaabbbccc"}
+
+	db := newDB()
+	db.Sessions[expectedSession.Id] = expectedSession
+
+	storage, _ := newStorage(t, db)
+
+	_, err := storage.SessionGet("foobar")
+	assert.True(t, NotFound(err))
+
+	loadedSession, err := storage.SessionGet("aaabbbccc")
+	assert.Nil(t, err)
+	assert.Equal(t, expectedSession, loadedSession)
+}
+
+func testSessionGetAll(t *testing.T, newStorage storageFactory) {
+	s1 := &types.Session{Id: "aaabbbccc"}
+	s2 := &types.Session{Id: "dddeeefff"}
+
+	db := newDB()
+	db.Sessions[s1.Id] = s1
+	db.Sessions[s2.Id] = s2
+
+	storage, _ := newStorage(t, db)
+
+	sessions, err := storage.SessionGetAll()
+	assert.Nil(t, err)
+	assert.Subset(t, sessions, []*types.Session{s1, s2})
+	assert.Len(t, sessions, 2)
+
+	count, err := storage.SessionCount()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func testSessionDelete(t *testing.T, newStorage storageFactory) {
+	storage, dump := newStorage(t, nil)
+
+	s1 := &types.Session{Id: "session1"}
+	err := storage.SessionPut(s1)
+	assert.Nil(t, err)
+
+	i := &types.Instance{Name: "i1", SessionId: s1.Id}
+	err = storage.InstancePut(i)
+	assert.Nil(t, err)
+
+	c := &types.Client{Id: "c1", SessionId: s1.Id}
+	err = storage.ClientPut(c)
+	assert.Nil(t, err)
+
+	w := &types.WindowsInstance{Id: "w1", SessionId: s1.Id}
+	err = storage.WindowsInstancePut(w)
+	assert.Nil(t, err)
+
+	found, err := storage.SessionGet(s1.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, s1, found)
+
+	err = storage.SessionDelete(s1.Id)
+	assert.Nil(t, err)
+
+	found, err = storage.SessionGet(s1.Id)
+	assert.True(t, NotFound(err))
+	assert.Nil(t, found)
+
+	assert.EqualValues(t, newDB(), dump())
+}
+
+func testInstanceGet(t *testing.T, newStorage storageFactory) {
+	expectedInstance := &types.Instance{SessionId: "aaabbbccc", Name: "i1", IP: "10.0.0.1"}
+
+	db := newDB()
+	db.Instances[expectedInstance.Name] = expectedInstance
+	db.InstancesBySessionId[expectedInstance.SessionId] = []string{expectedInstance.Name}
+
+	storage, _ := newStorage(t, db)
+
+	foundInstance, err := storage.InstanceGet("i1")
+	assert.Nil(t, err)
+	assert.Equal(t, expectedInstance, foundInstance)
+
+	_, err = storage.InstanceGet("i2")
+	assert.True(t, NotFound(err))
+}
+
+func testInstancePut(t *testing.T, newStorage storageFactory) {
+	storage, dump := newStorage(t, nil)
+
+	s := &types.Session{Id: "aaabbbccc"}
+	i := &types.Instance{Name: "i1", IP: "10.0.0.1", SessionId: s.Id}
+
+	err := storage.InstancePut(i)
+	assert.True(t, NotFound(err))
+
+	err = storage.SessionPut(s)
+	assert.Nil(t, err)
+
+	err = storage.InstancePut(i)
+	assert.Nil(t, err)
+
+	expectedDB := newDB()
+	expectedDB.Sessions[s.Id] = s
+	expectedDB.Instances[i.Name] = i
+	expectedDB.InstancesBySessionId[i.SessionId] = []string{i.Name}
+
+	assert.EqualValues(t, expectedDB, dump())
+}
+
+func testInstanceDelete(t *testing.T, newStorage storageFactory) {
+	storage, _ := newStorage(t, nil)
+
+	s := &types.Session{Id: "session1"}
+	err := storage.SessionPut(s)
+	assert.Nil(t, err)
+
+	i := &types.Instance{Name: "i1", IP: "10.0.0.1", SessionId: s.Id}
+	err = storage.InstancePut(i)
+	assert.Nil(t, err)
+
+	found, err := storage.InstanceGet(i.Name)
+	assert.Nil(t, err)
+	assert.Equal(t, i, found)
+
+	err = storage.InstanceDelete(i.Name)
+	assert.Nil(t, err)
+
+	found, err = storage.InstanceGet(i.Name)
+	assert.True(t, NotFound(err))
+	assert.Nil(t, found)
+
+	instances, err := storage.InstanceFindBySessionId(s.Id)
+	assert.Nil(t, err)
+	assert.Empty(t, instances)
+}
+
+func testInstanceFindBySessionId(t *testing.T, newStorage storageFactory) {
+	i1 := &types.Instance{SessionId: "aaabbbccc", Name: "c1"}
+	i2 := &types.Instance{SessionId: "aaabbbccc", Name: "c2"}
+
+	db := newDB()
+	db.Instances[i1.Name] = i1
+	db.Instances[i2.Name] = i2
+	db.InstancesBySessionId[i1.SessionId] = []string{i1.Name, i2.Name}
+
+	storage, _ := newStorage(t, db)
+
+	instances, err := storage.InstanceFindBySessionId("aaabbbccc")
+	assert.Nil(t, err)
+	assert.Subset(t, instances, []*types.Instance{i1, i2})
+	assert.Len(t, instances, 2)
+
+	count, err := storage.InstanceCount()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func testWindowsInstanceGetAll(t *testing.T, newStorage storageFactory) {
+	i1 := &types.WindowsInstance{SessionId: "aaabbbccc", Id: "i1"}
+	i2 := &types.WindowsInstance{SessionId: "aaabbbccc", Id: "i2"}
+
+	db := newDB()
+	db.WindowsInstances[i1.Id] = i1
+	db.WindowsInstances[i2.Id] = i2
+	db.WindowsInstancesBySessionId[i1.SessionId] = []string{i1.Id, i2.Id}
+
+	storage, _ := newStorage(t, db)
+
+	instances, err := storage.WindowsInstanceGetAll()
+	assert.Nil(t, err)
+	assert.Subset(t, instances, []*types.WindowsInstance{i1, i2})
+	assert.Len(t, instances, 2)
+}
+
+func testWindowsInstancePut(t *testing.T, newStorage storageFactory) {
+	storage, dump := newStorage(t, nil)
+
+	s := &types.Session{Id: "aaabbbccc"}
+	i := &types.WindowsInstance{Id: "i1", SessionId: s.Id}
+
+	err := storage.SessionPut(s)
+	assert.Nil(t, err)
+
+	err = storage.WindowsInstancePut(i)
+	assert.Nil(t, err)
+
+	expectedDB := newDB()
+	expectedDB.Sessions[s.Id] = s
+	expectedDB.WindowsInstances[i.Id] = i
+	expectedDB.WindowsInstancesBySessionId[i.SessionId] = []string{i.Id}
+
+	assert.EqualValues(t, expectedDB, dump())
+}
+
+func testWindowsInstanceDelete(t *testing.T, newStorage storageFactory) {
+	storage, _ := newStorage(t, nil)
+
+	s := &types.Session{Id: "session1"}
+	err := storage.SessionPut(s)
+	assert.Nil(t, err)
+
+	i := &types.WindowsInstance{Id: "i1", SessionId: s.Id}
+	err = storage.WindowsInstancePut(i)
+	assert.Nil(t, err)
+
+	found, err := storage.WindowsInstanceGetAll()
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.WindowsInstance{i}, found)
+
+	err = storage.WindowsInstanceDelete(i.Id)
+	assert.Nil(t, err)
+
+	found, err = storage.WindowsInstanceGetAll()
+	assert.Nil(t, err)
+	assert.Empty(t, found)
+}
+
+func testClientGet(t *testing.T, newStorage storageFactory) {
+	c := &types.Client{SessionId: "aaabbbccc", Id: "c1"}
+
+	db := newDB()
+	db.Clients[c.Id] = c
+	db.ClientsBySessionId[c.SessionId] = []string{c.Id}
+
+	storage, _ := newStorage(t, db)
+
+	found, err := storage.ClientGet("c1")
+	assert.Nil(t, err)
+	assert.Equal(t, c, found)
+}
+
+func testClientPut(t *testing.T, newStorage storageFactory) {
+	storage, dump := newStorage(t, nil)
+
+	s := &types.Session{Id: "aaabbbccc"}
+	c := &types.Client{Id: "c1", SessionId: s.Id}
+
+	err := storage.ClientPut(c)
+	assert.True(t, NotFound(err))
+
+	err = storage.SessionPut(s)
+	assert.Nil(t, err)
+
+	err = storage.ClientPut(c)
+	assert.Nil(t, err)
+
+	expectedDB := newDB()
+	expectedDB.Sessions[s.Id] = s
+	expectedDB.Clients[c.Id] = c
+	expectedDB.ClientsBySessionId[c.SessionId] = []string{c.Id}
+
+	assert.EqualValues(t, expectedDB, dump())
+}
+
+func testClientDelete(t *testing.T, newStorage storageFactory) {
+	storage, _ := newStorage(t, nil)
+
+	s := &types.Session{Id: "session1"}
+	err := storage.SessionPut(s)
+	assert.Nil(t, err)
+
+	c := &types.Client{Id: "c1", SessionId: s.Id}
+	err = storage.ClientPut(c)
+	assert.Nil(t, err)
+
+	found, err := storage.ClientGet(c.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, c, found)
+
+	err = storage.ClientDelete(c.Id)
+	assert.Nil(t, err)
+
+	found, err = storage.ClientGet(c.Id)
+	assert.True(t, NotFound(err))
+	assert.Nil(t, found)
+
+	count, err := storage.ClientCount()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func testClientFindBySessionId(t *testing.T, newStorage storageFactory) {
+	c1 := &types.Client{SessionId: "aaabbbccc", Id: "c1"}
+	c2 := &types.Client{SessionId: "aaabbbccc", Id: "c2"}
+
+	db := newDB()
+	db.Clients[c1.Id] = c1
+	db.Clients[c2.Id] = c2
+	db.ClientsBySessionId[c1.SessionId] = []string{c1.Id, c2.Id}
+
+	storage, _ := newStorage(t, db)
+
+	clients, err := storage.ClientFindBySessionId("aaabbbccc")
+	assert.Nil(t, err)
+	assert.Subset(t, clients, []*types.Client{c1, c2})
+	assert.Len(t, clients, 2)
+}
+
+func testLoginRequest(t *testing.T, newStorage storageFactory) {
+	storage, _ := newStorage(t, nil)
+
+	lr := &types.LoginRequest{Id: "lr1", Provider: "github"}
+	err := storage.LoginRequestPut(lr)
+	assert.Nil(t, err)
+
+	found, err := storage.LoginRequestGet(lr.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, lr, found)
+
+	err = storage.LoginRequestDelete(lr.Id)
+	assert.Nil(t, err)
+
+	_, err = storage.LoginRequestGet(lr.Id)
+	assert.True(t, NotFound(err))
+}
+
+func testUserFindByProvider(t *testing.T, newStorage storageFactory) {
+	storage, _ := newStorage(t, nil)
+
+	u := &types.User{Id: "u1", Provider: "github", ProviderUserId: "42"}
+	err := storage.UserPut(u)
+	assert.Nil(t, err)
+
+	found, err := storage.UserGet(u.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, u, found)
+
+	found, err = storage.UserFindByProvider("github", "42")
+	assert.Nil(t, err)
+	assert.Equal(t, u, found)
+
+	_, err = storage.UserFindByProvider("google", "42")
+	assert.True(t, NotFound(err))
+}
+
+func testPlaygroundGet(t *testing.T, newStorage storageFactory) {
+	p := &types.Playground{Id: "aaabbbccc"}
+
+	db := newDB()
+	db.Playgrounds[p.Id] = p
+
+	storage, _ := newStorage(t, db)
+
+	found, err := storage.PlaygroundGet("aaabbbccc")
+	assert.Nil(t, err)
+	assert.Equal(t, p, found)
+}
+
+func testPlaygroundPut(t *testing.T, newStorage storageFactory) {
+	storage, dump := newStorage(t, nil)
+
+	p := &types.Playground{Id: "aaabbbccc"}
+
+	err := storage.PlaygroundPut(p)
+	assert.Nil(t, err)
+
+	expectedDB := newDB()
+	expectedDB.Playgrounds[p.Id] = p
+
+	assert.EqualValues(t, expectedDB, dump())
+}
+
+func testPlaygroundGetAll(t *testing.T, newStorage storageFactory) {
+	p1 := &types.Playground{Id: "aaabbbccc"}
+	p2 := &types.Playground{Id: "dddeeefff"}
+
+	db := newDB()
+	db.Playgrounds[p1.Id] = p1
+	db.Playgrounds[p2.Id] = p2
+
+	storage, _ := newStorage(t, db)
+
+	found, err := storage.PlaygroundGetAll()
+	assert.Nil(t, err)
+	assert.Subset(t, []*types.Playground{p1, p2}, found)
+	assert.Len(t, found, 2)
+}
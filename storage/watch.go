@@ -0,0 +1,259 @@
+package storage
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/dimaskiddo/play-with-docker/pwd/types"
+)
+
+type Op string
+
+const (
+	OpPut    Op = "put"
+	OpDelete Op = "delete"
+	// OpResync is sent to a watch that fell behind and missed some events.
+	// Its consumer has to read again what it watches.
+	OpResync Op = "resync"
+)
+
+// Number of events that can wait for a watch to read them before they are
+// dropped in favour of an OpResync event.
+var watchQueueSize = 1024
+
+type Kind string
+
+const (
+	KindSession         Kind = "session"
+	KindInstance        Kind = "instance"
+	KindWindowsInstance Kind = "windows_instance"
+	KindClient          Kind = "client"
+	KindLoginRequest    Kind = "login_request"
+	KindUser            Kind = "user"
+	KindPlayground      Kind = "playground"
+	KindLease           Kind = "lease"
+)
+
+// WatchEvent describes a record that was put or deleted. Only the field that
+// matches Kind is set; for deletes it holds the last stored value.
+type WatchEvent struct {
+	Kind       Kind
+	Op         Op
+	Id         string
+	Session    *types.Session
+	Instance   *types.Instance
+	Client     *types.Client
+	Playground *types.Playground
+}
+
+// SessionId returns the id of the session the changed record belongs to.
+func (e WatchEvent) SessionId() string {
+	switch {
+	case e.Session != nil:
+		return e.Session.Id
+	case e.Instance != nil:
+		return e.Instance.SessionId
+	case e.Client != nil:
+		return e.Client.SessionId
+	}
+
+	return ""
+}
+
+// WatchFilter selects the events delivered to a watch. A nil filter selects
+// all of them.
+type WatchFilter func(e WatchEvent) bool
+
+// WatchSession selects the events of the given session and its instances and
+// clients.
+func WatchSession(sessionId string) WatchFilter {
+	return func(e WatchEvent) bool {
+		return e.SessionId() == sessionId
+	}
+}
+
+var watchableKinds = map[Kind]bool{
+	KindSession:    true,
+	KindInstance:   true,
+	KindClient:     true,
+	KindPlayground: true,
+}
+
+// Watch delivers events on C, in the order they happened, until Close is
+// called. Up to watchQueueSize events queue up if C is not drained, so the
+// storage is never blocked by a slow consumer. Past that they are dropped and
+// an OpResync event is delivered instead.
+type Watch struct {
+	C <-chan WatchEvent
+
+	c      chan WatchEvent
+	kind   Kind
+	filter WatchFilter
+	hub    *WatchHub
+
+	mx     sync.Mutex
+	queue  []WatchEvent
+	resync bool
+	signal chan struct{}
+	done   chan struct{}
+}
+
+func (w *Watch) push(e WatchEvent) {
+	w.mx.Lock()
+	if len(w.queue) >= watchQueueSize {
+		w.queue = nil
+		w.resync = true
+	}
+	w.queue = append(w.queue, e)
+	w.mx.Unlock()
+
+	select {
+	case w.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (w *Watch) run() {
+	defer close(w.c)
+
+	for {
+		w.mx.Lock()
+		queue := w.queue
+		if w.resync {
+			queue = append([]WatchEvent{{Kind: w.kind, Op: OpResync}}, queue...)
+		}
+		w.queue = nil
+		w.resync = false
+		w.mx.Unlock()
+
+		for _, e := range queue {
+			select {
+			case w.c <- e:
+			case <-w.done:
+				return
+			}
+		}
+
+		select {
+		case <-w.signal:
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// Close stops the watch and closes C.
+func (w *Watch) Close() {
+	w.hub.remove(w)
+}
+
+// WatchHub fans out storage changes to the watches of a StorageApi
+// implementation.
+type WatchHub struct {
+	mx      sync.Mutex
+	watches map[*Watch]bool
+}
+
+func NewWatchHub() *WatchHub {
+	return &WatchHub{watches: map[*Watch]bool{}}
+}
+
+func (h *WatchHub) Watch(kind Kind, filter WatchFilter) (*Watch, error) {
+	if !watchableKinds[kind] {
+		return nil, fmt.Errorf("cannot watch %s", kind)
+	}
+
+	c := make(chan WatchEvent)
+	w := &Watch{
+		C:      c,
+		c:      c,
+		kind:   kind,
+		filter: filter,
+		hub:    h,
+		signal: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+
+	h.mx.Lock()
+	h.watches[w] = true
+	h.mx.Unlock()
+
+	go w.run()
+
+	return w, nil
+}
+
+func (h *WatchHub) remove(w *Watch) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	if h.watches[w] {
+		delete(h.watches, w)
+		close(w.done)
+	}
+}
+
+// Watching reports whether there is at least one open watch.
+func (h *WatchHub) Watching() bool {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	return len(h.watches) > 0
+}
+
+func (h *WatchHub) Publish(e WatchEvent) {
+	if !watchableKinds[e.Kind] {
+		return
+	}
+
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	for w := range h.watches {
+		if w.kind == e.Kind && (w.filter == nil || w.filter(e)) {
+			w.push(e)
+		}
+	}
+}
+
+// publishDiff publishes the changes between two versions of a DB, for when
+// the storage was replaced as a whole instead of entry by entry.
+func publishDiff(h *WatchHub, old, new *DB) {
+	for id, s := range new.Sessions {
+		if !reflect.DeepEqual(old.Sessions[id], s) {
+			h.Publish(WatchEvent{Kind: KindSession, Op: OpPut, Id: id, Session: s})
+		}
+	}
+	for id, i := range new.Instances {
+		if !reflect.DeepEqual(old.Instances[id], i) {
+			h.Publish(WatchEvent{Kind: KindInstance, Op: OpPut, Id: id, Instance: i})
+		}
+	}
+	for id, c := range new.Clients {
+		if !reflect.DeepEqual(old.Clients[id], c) {
+			h.Publish(WatchEvent{Kind: KindClient, Op: OpPut, Id: id, Client: c})
+		}
+	}
+	for id, p := range new.Playgrounds {
+		if !reflect.DeepEqual(old.Playgrounds[id], p) {
+			h.Publish(WatchEvent{Kind: KindPlayground, Op: OpPut, Id: id, Playground: p})
+		}
+	}
+
+	for id, i := range old.Instances {
+		if _, found := new.Instances[id]; !found {
+			h.Publish(WatchEvent{Kind: KindInstance, Op: OpDelete, Id: id, Instance: i})
+		}
+	}
+	for id, c := range old.Clients {
+		if _, found := new.Clients[id]; !found {
+			h.Publish(WatchEvent{Kind: KindClient, Op: OpDelete, Id: id, Client: c})
+		}
+	}
+	for id, s := range old.Sessions {
+		if _, found := new.Sessions[id]; !found {
+			h.Publish(WatchEvent{Kind: KindSession, Op: OpDelete, Id: id, Session: s})
+		}
+	}
+}
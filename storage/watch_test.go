@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dimaskiddo/play-with-docker/pwd/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func nextEvent(t *testing.T, w *Watch) WatchEvent {
+	t.Helper()
+
+	select {
+	case e := <-w.C:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a watch event")
+		return WatchEvent{}
+	}
+}
+
+func noEvent(t *testing.T, w *Watch) {
+	t.Helper()
+
+	select {
+	case e := <-w.C:
+		t.Fatalf("unexpected watch event %+v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func testWatch(t *testing.T, s StorageApi) {
+	w, err := s.Watch(KindInstance, WatchSession("s1"))
+	assert.Nil(t, err)
+	defer w.Close()
+
+	sessions, err := s.Watch(KindSession, nil)
+	assert.Nil(t, err)
+	defer sessions.Close()
+
+	s1 := &types.Session{Id: "s1"}
+	s2 := &types.Session{Id: "s2"}
+	i1 := &types.Instance{Name: "i1", SessionId: s1.Id}
+	i2 := &types.Instance{Name: "i2", SessionId: s2.Id}
+
+	assert.Nil(t, s.SessionPut(s1))
+	assert.Nil(t, s.SessionPut(s2))
+	assert.Nil(t, s.InstancePut(i1))
+	assert.Nil(t, s.InstancePut(i2))
+	assert.Nil(t, s.SessionDelete(s1.Id))
+
+	assert.Equal(t, WatchEvent{Kind: KindSession, Op: OpPut, Id: s1.Id, Session: s1}, nextEvent(t, sessions))
+	assert.Equal(t, WatchEvent{Kind: KindSession, Op: OpPut, Id: s2.Id, Session: s2}, nextEvent(t, sessions))
+	assert.Equal(t, WatchEvent{Kind: KindSession, Op: OpDelete, Id: s1.Id, Session: s1}, nextEvent(t, sessions))
+
+	assert.Equal(t, WatchEvent{Kind: KindInstance, Op: OpPut, Id: i1.Name, Instance: i1}, nextEvent(t, w))
+	assert.Equal(t, WatchEvent{Kind: KindInstance, Op: OpDelete, Id: i1.Name, Instance: i1}, nextEvent(t, w))
+	noEvent(t, w)
+
+	_, err = s.Watch(KindUser, nil)
+	assert.NotNil(t, err)
+}
+
+func TestWatch(t *testing.T) {
+	s, err := NewFileStorage(filepath.Join(t.TempDir(), "session"))
+	assert.Nil(t, err)
+
+	testWatch(t, s)
+}
+
+func TestBoltWatch(t *testing.T) {
+	testWatch(t, newBoltTestStorage(t, nil))
+}
+
+func TestWatchOtherProcess(t *testing.T) {
+	journalTailInterval = 10 * time.Millisecond
+	defer func() { journalTailInterval = 500 * time.Millisecond }()
+
+	path := filepath.Join(t.TempDir(), "session")
+
+	writer, err := NewFileStorage(path)
+	assert.Nil(t, err)
+
+	reader, err := NewFileStorage(path)
+	assert.Nil(t, err)
+
+	w, err := reader.Watch(KindSession, nil)
+	assert.Nil(t, err)
+	defer w.Close()
+
+	s1 := &types.Session{Id: "s1"}
+	s2 := &types.Session{Id: "s2"}
+
+	assert.Nil(t, writer.SessionPut(s1))
+	assert.Equal(t, WatchEvent{Kind: KindSession, Op: OpPut, Id: s1.Id, Session: s1}, nextEvent(t, w))
+
+	// Compacting replaces the snapshot, so the reader reloads it instead of
+	// following the journal.
+	assert.Nil(t, writer.SessionPut(s2))
+	store := writer.(*storage)
+	unlock, err := store.lockForUpdate()
+	assert.Nil(t, err)
+	assert.Nil(t, store.compact())
+	unlock()
+	assert.Nil(t, writer.SessionDelete(s1.Id))
+
+	events := []WatchEvent{nextEvent(t, w), nextEvent(t, w)}
+	assert.ElementsMatch(t, []WatchEvent{
+		{Kind: KindSession, Op: OpPut, Id: s2.Id, Session: s2},
+		{Kind: KindSession, Op: OpDelete, Id: s1.Id, Session: s1},
+	}, events)
+
+	// Updates from the reader start from the writer's changes.
+	assert.Nil(t, reader.InstancePut(&types.Instance{Name: "i1", SessionId: s2.Id}))
+	assert.Equal(t, NotFoundError, reader.InstancePut(&types.Instance{Name: "i2", SessionId: s1.Id}))
+}
+
+func TestWatchClose(t *testing.T) {
+	h := NewWatchHub()
+
+	w, err := h.Watch(KindPlayground, nil)
+	assert.Nil(t, err)
+	assert.True(t, h.Watching())
+
+	w.Close()
+	w.Close()
+	assert.False(t, h.Watching())
+
+	_, ok := <-w.C
+	assert.False(t, ok)
+}
+
+func TestWatchResync(t *testing.T) {
+	defer func(size int) { watchQueueSize = size }(watchQueueSize)
+	watchQueueSize = 2
+
+	put := func(id string) WatchEvent {
+		return WatchEvent{Kind: KindPlayground, Op: OpPut, Id: id, Playground: &types.Playground{Id: id}}
+	}
+
+	// Nothing reads the queue until the watch runs.
+	c := make(chan WatchEvent)
+	w := &Watch{C: c, c: c, kind: KindPlayground, signal: make(chan struct{}, 1), done: make(chan struct{})}
+	defer close(w.done)
+
+	w.push(put("p1"))
+	w.push(put("p2"))
+	w.push(put("p3"))
+
+	go w.run()
+
+	assert.Equal(t, WatchEvent{Kind: KindPlayground, Op: OpResync}, nextEvent(t, w))
+	assert.Equal(t, put("p3"), nextEvent(t, w))
+	noEvent(t, w)
+
+	w.push(put("p4"))
+	assert.Equal(t, put("p4"), nextEvent(t, w))
+}
+
+func TestWatchFailedWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session")
+
+	s, err := NewFileStorage(path)
+	assert.Nil(t, err)
+
+	w, err := s.Watch(KindSession, nil)
+	assert.Nil(t, err)
+	defer w.Close()
+
+	s1 := &types.Session{Id: "s1"}
+	assert.Nil(t, s.SessionPut(s1))
+	assert.Equal(t, WatchEvent{Kind: KindSession, Op: OpPut, Id: s1.Id, Session: s1}, nextEvent(t, w))
+
+	// Writes to a journal opened read only fail.
+	store := s.(*storage)
+	store.rw.Lock()
+	store.journal.Close()
+	store.journal, err = os.Open(journalPath(path))
+	store.rw.Unlock()
+	assert.Nil(t, err)
+
+	assert.NotNil(t, s.SessionPut(&types.Session{Id: "s2"}))
+	assert.NotNil(t, s.SessionDelete(s1.Id))
+	noEvent(t, w)
+}
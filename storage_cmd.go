@@ -0,0 +1,271 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/dimaskiddo/play-with-docker/config"
+	"github.com/dimaskiddo/play-with-docker/docker"
+	"github.com/dimaskiddo/play-with-docker/pwd/types"
+	"github.com/dimaskiddo/play-with-docker/storage"
+)
+
+// storageCommand runs the `storage` maintenance sub commands, which take the
+// same flags and environment as the server.
+func storageCommand(args []string) {
+	if len(args) == 0 {
+		log.Fatalf("Usage: %s storage migrate|export|import|rekey [flags]", os.Args[0])
+	}
+
+	os.Args = append([]string{os.Args[0]}, args[1:]...)
+
+	switch args[0] {
+	case "migrate":
+		dryRun := flag.Bool("dry-run", false, "Only Print Pending Storage Migrations")
+		config.ParseFlags()
+
+		migrateStorage(*dryRun)
+	case "export":
+		archive := flag.String("archive", "", "Path Where the Storage Archive will be Written")
+		config.ParseFlags()
+
+		exportStorage(*archive)
+	case "import":
+		archive := flag.String("archive", "", "Path of the Storage Archive to Import")
+		config.ParseFlags()
+
+		importStorage(*archive)
+	case "rekey":
+		config.ParseFlags()
+
+		rekeyStorage()
+	default:
+		log.Fatalf("Unknown storage command %s", args[0])
+	}
+}
+
+// storageTarget describes the storage the commands work on, leaving out the
+// password of the redis URL.
+func storageTarget() string {
+	switch config.SessionsStorage {
+	case "file":
+		return fmt.Sprintf("file %s", config.SessionsFile)
+	case "bolt":
+		return fmt.Sprintf("bolt %s", config.SessionsBoltFile)
+	case "redis":
+		target := config.SessionsRedisURL
+		if u, err := url.Parse(target); err == nil {
+			target = u.Redacted()
+		}
+
+		return fmt.Sprintf("redis %s with prefix %s", target, config.SessionsRedisPrefix)
+	}
+
+	return config.SessionsStorage
+}
+
+func migrateStorage(dryRun bool) {
+	var version int
+	var err error
+
+	switch config.SessionsStorage {
+	case "file":
+		version, err = storage.FileSchemaVersion(config.SessionsFile)
+	case "bolt":
+		version, err = storage.BoltSchemaVersion(config.SessionsBoltFile)
+	case "redis":
+		version, err = storage.RedisSchemaVersion(config.SessionsRedisURL, config.SessionsRedisPrefix)
+	default:
+		log.Fatalf("Unknown session storage backend %s", config.SessionsStorage)
+	}
+
+	if err != nil {
+		log.Fatal("Error reading storage schema version: ", err)
+	}
+
+	if version > storage.SchemaVersion {
+		log.Fatalf("Storage schema version %d is newer than the supported version %d", version, storage.SchemaVersion)
+	}
+
+	pending := storage.PendingMigrations(version)
+
+	fmt.Printf("Storage %s is at schema version %d, latest is %d\n", storageTarget(), version, storage.SchemaVersion)
+	for _, m := range pending {
+		fmt.Printf("  %d: %s\n", m.Version, m.Description)
+	}
+
+	if dryRun || len(pending) == 0 {
+		return
+	}
+
+	if config.SessionsStorage == "redis" {
+		err = storage.MigrateRedis(config.SessionsRedisURL, config.SessionsRedisPrefix)
+		if err != nil {
+			log.Fatal("Error migrating storage: ", err)
+		}
+	} else {
+		// Opening the storage runs the pending migrations.
+		initStorage()
+	}
+
+	fmt.Printf("Storage migrated to schema version %d\n", storage.SchemaVersion)
+}
+
+func exportStorage(archive string) {
+	if archive == "" {
+		log.Fatal("Missing -archive path")
+	}
+
+	var db *storage.DB
+	var err error
+
+	switch config.SessionsStorage {
+	case "file":
+		db, err = storage.ExportFile(config.SessionsFile)
+	case "bolt":
+		db, err = storage.ExportBolt(config.SessionsBoltFile)
+	case "redis":
+		db, err = storage.ExportRedis(config.SessionsRedisURL, config.SessionsRedisPrefix)
+	default:
+		log.Fatalf("Unknown session storage backend %s", config.SessionsStorage)
+	}
+
+	if err != nil {
+		log.Fatal("Error reading storage: ", err)
+	}
+
+	f, err := os.Create(archive)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	manifest, err := storage.WriteArchive(f, db, config.ExternalDataDir)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(archive)
+		log.Fatal("Error writing storage archive: ", err)
+	}
+
+	fmt.Printf("Exported %d sessions to %s\n", len(manifest.Sessions), archive)
+}
+
+func importStorage(archive string) {
+	if archive == "" {
+		log.Fatal("Missing -archive path")
+	}
+
+	f, err := os.Open(archive)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	s := initStorage()
+
+	manifest, db, err := storage.ImportArchive(f, s, config.ExternalDataDir)
+	if err != nil {
+		log.Fatal("Error importing storage archive: ", err)
+	}
+
+	fmt.Printf("Imported %d sessions from %s created at %s\n", len(manifest.Sessions), archive, manifest.CreatedAt.Format(time.RFC3339))
+
+	df := initDockerFactory(s)
+
+	orphaned := 0
+	for _, id := range manifest.Sessions {
+		problems := checkSession(df, s, db.Sessions[id])
+		if len(problems) == 0 {
+			continue
+		}
+
+		orphaned++
+		fmt.Printf("Session %s is orphaned:\n", id)
+		for _, p := range problems {
+			fmt.Printf("  %s\n", p)
+		}
+	}
+
+	if orphaned > 0 {
+		fmt.Printf("%d of %d sessions are orphaned\n", orphaned, len(manifest.Sessions))
+	}
+}
+
+// rekeyStorage rewrites every encrypted record, so it is encrypted with the
+// current primary key and the previous keys can be retired.
+func rekeyStorage() {
+	if config.SessionsKey == "" && config.SessionsKeyFile == "" {
+		log.Fatal("Missing -session-key or -session-key-file")
+	}
+
+	s := initStorage()
+
+	sessions, err := s.SessionGetAll()
+	if err != nil {
+		log.Fatal("Error reading sessions: ", err)
+	}
+
+	instances := 0
+	for _, session := range sessions {
+		is, err := s.InstanceFindBySessionId(session.Id)
+		if err != nil {
+			log.Fatalf("Error reading instances of session %s: %v", session.Id, err)
+		}
+
+		for _, i := range is {
+			if err := s.InstancePut(i); err != nil {
+				log.Fatalf("Error writing instance %s: %v", i.Name, err)
+			}
+		}
+
+		instances += len(is)
+	}
+
+	playgrounds, err := s.PlaygroundGetAll()
+	if err != nil {
+		log.Fatal("Error reading playgrounds: ", err)
+	}
+
+	for _, p := range playgrounds {
+		if err := s.PlaygroundPut(p); err != nil {
+			log.Fatalf("Error writing playground %s: %v", p.Id, err)
+		}
+	}
+
+	fmt.Printf("Encrypted %d instances and %d playgrounds with the primary key\n", instances, len(playgrounds))
+}
+
+// checkSession returns what is missing on this host for session to work.
+func checkSession(df docker.FactoryApi, s storage.StorageApi, session *types.Session) []string {
+	dockerClient, err := df.GetForSession(session)
+	if err != nil {
+		return []string{fmt.Sprintf("cannot connect to docker: %v", err)}
+	}
+
+	problems := []string{}
+
+	if _, err := dockerClient.NetworkInspect(session.Id); err != nil {
+		problems = append(problems, fmt.Sprintf("overlay network %s: %v", session.Id, err))
+	}
+
+	instances, err := s.InstanceFindBySessionId(session.Id)
+	if err != nil {
+		return append(problems, fmt.Sprintf("instances: %v", err))
+	}
+
+	for _, instance := range instances {
+		if _, err := dockerClient.ContainerIPs(instance.Name); err != nil {
+			problems = append(problems, fmt.Sprintf("instance container %s: %v", instance.Name, err))
+		}
+	}
+
+	return problems
+}
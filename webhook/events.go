@@ -0,0 +1,99 @@
+package webhook
+
+import (
+	"log"
+	"sync"
+
+	"github.com/dimaskiddo/play-with-docker/event"
+	"github.com/dimaskiddo/play-with-docker/storage"
+)
+
+type session struct {
+	playgroundId string
+	userId       string
+}
+
+// Subscribe sends the session and instance lifecycle events emitted on e to
+// the webhooks of the playground of their session. When replicas share the
+// events, each one is sent by a single replica.
+func Subscribe(d *Dispatcher, e event.EventApi, s storage.StorageApi) {
+	var mx sync.Mutex
+
+	// Sessions are remembered so the storage is not read for every event.
+	sessions := map[string]session{}
+
+	find := func(id string) (session, bool) {
+		mx.Lock()
+		defer mx.Unlock()
+
+		if found, ok := sessions[id]; ok {
+			return found, true
+		}
+
+		stored, err := s.SessionGet(id)
+		if err != nil {
+			return session{}, false
+		}
+
+		sessions[id] = session{playgroundId: stored.PlaygroundId, userId: stored.UserId}
+
+		return sessions[id], true
+	}
+
+	deliver := func(name event.EventType, sessionId string, found session, instance string) {
+		playground, err := s.PlaygroundGet(found.playgroundId)
+		if err != nil {
+			log.Printf("Cannot send webhooks for event %s, playground %s not found. Got: %v\n", name, found.playgroundId, err)
+			return
+		}
+
+		for _, hook := range playground.Webhooks {
+			if Wants(hook, name.String()) {
+				d.Send(hook, Payload{
+					Event:        name.String(),
+					PlaygroundId: playground.Id,
+					SessionId:    sessionId,
+					UserId:       found.userId,
+					Instance:     instance,
+				})
+			}
+		}
+	}
+
+	send := func(name event.EventType, sessionId, instance string) {
+		found, ok := find(sessionId)
+		if !ok {
+			log.Printf("Cannot send webhooks for event %s of unknown session %s\n", name, sessionId)
+			return
+		}
+
+		deliver(name, sessionId, found, instance)
+	}
+
+	event.SessionNewEvent.On(e, func(id string, _ event.Empty) {
+		send(event.SESSION_NEW, id, "")
+	}, event.Once())
+
+	event.SessionReadyEvent.On(e, func(id string, payload event.SessionReady) {
+		if payload.Ready {
+			send(event.SESSION_READY, id, "")
+		}
+	}, event.Once())
+
+	// The session is already deleted from the storage when it ends.
+	event.SessionEndEvent.On(e, func(id string, payload event.SessionEnd) {
+		deliver(event.SESSION_END, id, session{playgroundId: payload.PlaygroundId, userId: payload.UserId}, "")
+
+		mx.Lock()
+		delete(sessions, id)
+		mx.Unlock()
+	}, event.Once())
+
+	event.InstanceNewEvent.On(e, func(id string, payload event.InstanceNew) {
+		send(event.INSTANCE_NEW, id, payload.Name)
+	}, event.Once())
+
+	event.InstanceDeleteEvent.On(e, func(id string, payload event.InstanceDelete) {
+		send(event.INSTANCE_DELETE, id, payload.Name)
+	}, event.Once())
+}
@@ -0,0 +1,61 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dimaskiddo/play-with-docker/event"
+	"github.com/dimaskiddo/play-with-docker/pwd/types"
+	"github.com/dimaskiddo/play-with-docker/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscribe(t *testing.T) {
+	r := &receiver{}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	_s := &storage.Mock{}
+	_s.On("SessionGet", "s1").Return(&types.Session{Id: "s1", UserId: "u1", PlaygroundId: "p1"}, nil).Once()
+	_s.On("PlaygroundGet", "p1").Return(&types.Playground{Id: "p1", Webhooks: []types.Webhook{
+		{URL: server.URL, Secret: "secret", Events: []string{"session ready", "session end", "instance new"}},
+	}}, nil)
+
+	d := NewDispatcher(server.Client(), 1, time.Millisecond)
+	e := event.NewLocalBroker()
+	Subscribe(d, e, _s)
+
+	deliveries := func(n int) {
+		t.Helper()
+		assert.Eventually(t, func() bool { return len(d.Recent()) == n }, time.Second, 10*time.Millisecond)
+	}
+
+	event.SessionReadyEvent.Emit(e, "s1", event.SessionReady{Ready: false})
+	event.SessionReadyEvent.Emit(e, "s1", event.SessionReady{Ready: true})
+	deliveries(1)
+
+	event.InstanceNewEvent.Emit(e, "s1", event.InstanceNew{Name: "i1"})
+	event.InstanceDeleteEvent.Emit(e, "s1", event.InstanceDelete{Name: "i1"})
+	deliveries(2)
+
+	// The session is gone from the storage once it ended.
+	event.SessionEndEvent.Emit(e, "s2", event.SessionEnd{PlaygroundId: "p1", UserId: "u2"})
+	deliveries(3)
+	d.Wait()
+
+	events := map[string]Payload{}
+	for _, body := range r.bodies {
+		var p Payload
+		assert.Nil(t, json.Unmarshal(body, &p))
+		events[p.Event] = p
+	}
+
+	assert.Len(t, events, 3)
+	assert.Equal(t, "i1", events["instance new"].Instance)
+	assert.Equal(t, "s2", events["session end"].SessionId)
+	assert.Equal(t, "u2", events["session end"].UserId)
+	assert.Equal(t, "p1", events["session end"].PlaygroundId)
+	_s.AssertExpectations(t)
+}
@@ -0,0 +1,256 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dimaskiddo/play-with-docker/pwd/types"
+	"github.com/rs/xid"
+)
+
+const (
+	SignatureHeader = "X-PWD-Signature"
+	EventHeader     = "X-PWD-Event"
+	DeliveryHeader  = "X-PWD-Delivery"
+)
+
+const (
+	// Number of deliveries kept in each of the recent and dead letter lists.
+	historySize = 500
+
+	maxBackoff = 10 * time.Minute
+)
+
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// Payload is the JSON body posted to the webhooks.
+type Payload struct {
+	Id           string    `json:"id"`
+	Event        string    `json:"event"`
+	Time         time.Time `json:"time"`
+	PlaygroundId string    `json:"playground_id"`
+	SessionId    string    `json:"session_id"`
+	UserId       string    `json:"user_id,omitempty"`
+	Instance     string    `json:"instance,omitempty"`
+}
+
+type Attempt struct {
+	Time       time.Time `json:"time"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+type Delivery struct {
+	Id           string    `json:"id"`
+	Event        string    `json:"event"`
+	PlaygroundId string    `json:"playground_id"`
+	SessionId    string    `json:"session_id"`
+	URL          string    `json:"url"`
+	Status       string    `json:"status"`
+	Attempts     []Attempt `json:"attempts"`
+}
+
+// Dispatcher posts payloads to webhooks, retrying failed deliveries with
+// exponential backoff. Deliveries that still fail after the last attempt are
+// moved to the dead letter list. Both lists are kept in memory only.
+type Dispatcher struct {
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+
+	mx     sync.Mutex
+	recent []*Delivery
+	dead   []*Delivery
+	wg     sync.WaitGroup
+}
+
+// NewDispatcher returns a Dispatcher that makes up to maxAttempts attempts
+// per delivery, waiting backoff before the first retry and twice as long
+// before each of the next ones.
+func NewDispatcher(client *http.Client, maxAttempts int, backoff time.Duration) *Dispatcher {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	return &Dispatcher{client: client, maxAttempts: maxAttempts, backoff: backoff}
+}
+
+// Sign returns the value of the signature header of body: the hex encoded
+// HMAC-SHA256 of body keyed with secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Wants reports whether hook is sent the events named event.
+func Wants(hook types.Webhook, event string) bool {
+	if len(hook.Events) == 0 {
+		return true
+	}
+
+	for _, e := range hook.Events {
+		if e == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Send delivers payload to hook in the background.
+func (d *Dispatcher) Send(hook types.Webhook, payload Payload) {
+	if payload.Id == "" {
+		payload.Id = xid.New().String()
+	}
+	if payload.Time.IsZero() {
+		payload.Time = time.Now()
+	}
+
+	delivery := &Delivery{
+		Id:           payload.Id,
+		Event:        payload.Event,
+		PlaygroundId: payload.PlaygroundId,
+		SessionId:    payload.SessionId,
+		URL:          hook.URL,
+		Status:       StatusPending,
+		Attempts:     []Attempt{},
+	}
+
+	d.wg.Add(1)
+
+	d.mx.Lock()
+	d.recent = keep(append(d.recent, delivery))
+	d.mx.Unlock()
+
+	go func() {
+		defer d.wg.Done()
+		d.deliver(hook, payload, delivery)
+	}()
+}
+
+func keep(deliveries []*Delivery) []*Delivery {
+	if len(deliveries) > historySize {
+		return append([]*Delivery(nil), deliveries[len(deliveries)-historySize:]...)
+	}
+
+	return deliveries
+}
+
+func (d *Dispatcher) deliver(hook types.Webhook, payload Payload, delivery *Delivery) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error encoding webhook payload. Got: %v\n", err)
+		return
+	}
+
+	wait := d.backoff
+
+	for n := 1; ; n++ {
+		attempt := d.post(hook, payload, body)
+
+		d.mx.Lock()
+		delivery.Attempts = append(delivery.Attempts, attempt)
+		if attempt.Error == "" {
+			delivery.Status = StatusDelivered
+		} else if n >= d.maxAttempts {
+			delivery.Status = StatusFailed
+			d.dead = keep(append(d.dead, delivery))
+		}
+		status := delivery.Status
+		d.mx.Unlock()
+
+		if status != StatusPending {
+			if status == StatusFailed {
+				log.Printf("Giving up delivering webhook %s to %s after %d attempts. Got: %s\n", delivery.Id, hook.URL, n, attempt.Error)
+			}
+			return
+		}
+
+		time.Sleep(wait)
+
+		wait *= 2
+		if wait > maxBackoff {
+			wait = maxBackoff
+		}
+	}
+}
+
+func (d *Dispatcher) post(hook types.Webhook, payload Payload, body []byte) Attempt {
+	attempt := Attempt{Time: time.Now()}
+
+	req, err := http.NewRequest("POST", hook.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, payload.Event)
+	req.Header.Set(DeliveryHeader, payload.Id)
+	if hook.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(hook.Secret, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		attempt.Error = fmt.Sprintf("unexpected status %s", resp.Status)
+	}
+
+	return attempt
+}
+
+// Wait blocks until every delivery in progress succeeded or was given up.
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// Recent returns the last deliveries, oldest first.
+func (d *Dispatcher) Recent() []Delivery {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	return copyDeliveries(d.recent)
+}
+
+// DeadLetters returns the last deliveries that were given up, oldest first.
+func (d *Dispatcher) DeadLetters() []Delivery {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	return copyDeliveries(d.dead)
+}
+
+func copyDeliveries(deliveries []*Delivery) []Delivery {
+	r := make([]Delivery, len(deliveries))
+
+	for i, delivery := range deliveries {
+		r[i] = *delivery
+		r[i].Attempts = append([]Attempt{}, delivery.Attempts...)
+	}
+
+	return r
+}
@@ -0,0 +1,86 @@
+package webhook
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dimaskiddo/play-with-docker/pwd/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type receiver struct {
+	mx       sync.Mutex
+	failures int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *receiver) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	body, _ := ioutil.ReadAll(req.Body)
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+
+	if r.failures > 0 {
+		r.failures--
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	r := &receiver{failures: 2}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	d := NewDispatcher(server.Client(), 3, time.Millisecond)
+	hook := types.Webhook{URL: server.URL, Secret: "secret"}
+
+	d.Send(hook, Payload{Event: "session ready", PlaygroundId: "p1", SessionId: "s1"})
+	d.Wait()
+
+	assert.Len(t, r.requests, 3)
+	req := r.requests[2]
+	assert.Equal(t, "session ready", req.Header.Get(EventHeader))
+	assert.Equal(t, Sign("secret", r.bodies[2]), req.Header.Get(SignatureHeader))
+	assert.Equal(t, r.requests[0].Header.Get(DeliveryHeader), req.Header.Get(DeliveryHeader))
+
+	recent := d.Recent()
+	assert.Len(t, recent, 1)
+	assert.Equal(t, StatusDelivered, recent[0].Status)
+	assert.Len(t, recent[0].Attempts, 3)
+	assert.Equal(t, http.StatusServiceUnavailable, recent[0].Attempts[0].StatusCode)
+	assert.NotEmpty(t, recent[0].Attempts[0].Error)
+	assert.Empty(t, d.DeadLetters())
+}
+
+func TestDispatcherDeadLetter(t *testing.T) {
+	r := &receiver{failures: 10}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	d := NewDispatcher(server.Client(), 2, time.Millisecond)
+
+	d.Send(types.Webhook{URL: server.URL}, Payload{Event: "session end", SessionId: "s1"})
+	d.Wait()
+
+	assert.Len(t, r.requests, 2)
+	assert.Empty(t, r.requests[0].Header.Get(SignatureHeader))
+
+	dead := d.DeadLetters()
+	assert.Len(t, dead, 1)
+	assert.Equal(t, StatusFailed, dead[0].Status)
+	assert.Equal(t, "s1", dead[0].SessionId)
+	assert.Len(t, dead[0].Attempts, 2)
+}
+
+func TestWants(t *testing.T) {
+	assert.True(t, Wants(types.Webhook{}, "session end"))
+	assert.True(t, Wants(types.Webhook{Events: []string{"session ready", "session end"}}, "session end"))
+	assert.False(t, Wants(types.Webhook{Events: []string{"session ready"}}, "instance new"))
+}